@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/telemetry"
+)
+
+// raiseStressAlert records an anomaly, announces on the match's event stream
+// that there is a new alert, and emails the player's team staff about it if
+// the player shares their stress with them. The event stream is open to
+// anyone, so it only carries where to find the alert, not whose it is.
+func (app *application) raiseStressAlert(match *data.Match, anomaly *telemetry.Anomaly) {
+	alert := &data.StressAlert{
+		MatchID:  match.ID,
+		UserID:   anomaly.Sample.UserID,
+		RaisedAt: anomaly.Sample.At,
+		Stress:   anomaly.Sample.Stress,
+		Baseline: anomaly.Baseline,
+		StdDev:   anomaly.StdDev,
+		ZScore:   anomaly.ZScore,
+	}
+
+	err := app.models.Alert.Insert(alert)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	app.publish("match.stress_alert", envelope{"alert": envelope{
+		"id":        alert.ID,
+		"match_id":  alert.MatchID,
+		"raised_at": alert.RaisedAt,
+	}}, match.ID, match.TournamentID)
+
+	app.background(func() {
+		access, err := app.models.Consent.GetAccess(alert.UserID, []string{data.AudienceTeamStaff})
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		if !access[data.BiometricStress] {
+			return
+		}
+
+		emails, err := app.models.TeamUsers.GetStaffEmails(alert.UserID, alert.MatchID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		if len(emails) == 0 {
+			return
+		}
+
+		player, err := app.models.Users.Get(alert.UserID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		data := map[string]interface{}{
+			"matchID":    alert.MatchID,
+			"playerName": player.Name,
+			"raisedAt":   alert.RaisedAt.UTC().Format(time.RFC1123),
+			"stress":     alert.Stress,
+			"baseline":   alert.Baseline,
+			"zScore":     alert.ZScore,
+		}
+
+		for _, email := range emails {
+			err = app.mailer.Send(email, "stress_alert_en.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	})
+}
+
+func (app *application) listMatchAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	alerts, err := app.models.Alert.GetAllByMatch(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	viewer, err := app.newBiometricViewer(app.contextGetUser(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Only the alerts of players who share their stress with the viewer are
+	// listed.
+	visible := []*data.StressAlert{}
+
+	for _, alert := range alerts {
+		access, err := viewer.access(alert.UserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if access[data.BiometricStress] {
+			visible = append(visible, alert)
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"alerts": visible}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
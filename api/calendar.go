@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/ical"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// feedViewer works out who is asking for a calendar feed: the owner of the
+// calendar token in the query string or, failing that, the authenticated user.
+// Calendar clients can't send headers, which is why the token travels in the
+// URL. It writes the error response itself and returns nil if the request
+// carries neither.
+func (app *application) feedViewer(w http.ResponseWriter, r *http.Request) *data.User {
+	token := r.URL.Query().Get("token")
+
+	if token != "" {
+		v := validator.New()
+
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return nil
+		}
+
+		user, err := app.models.Users.GetForToken(data.ScopeCalendar, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return nil
+		}
+
+		return user
+	}
+
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		app.authenticationRequiredResponse(w, r)
+		return nil
+	}
+
+	return user
+}
+
+// isTournamentStaff reports whether the user runs tournaments, and so may see
+// every team's and tournament's schedule.
+func (app *application) isTournamentStaff(user *data.User) (bool, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include("admin") || permissions.Include("referee"), nil
+}
+
+func (app *application) writeCalendar(w http.ResponseWriter, r *http.Request, name string, entries []*data.CalendarEntry) {
+	now := time.Now()
+
+	cal := &ical.Calendar{Name: name}
+
+	for _, e := range entries {
+		summary := e.TournamentName
+		if e.HomeName != "" || e.AwayName != "" {
+			summary = fmt.Sprintf("%s: %s vs %s", e.TournamentName, orTBD(e.HomeName), orTBD(e.AwayName))
+		}
+		if e.Stage != "" {
+			summary += " (" + e.Stage + ")"
+		}
+
+		location := strings.TrimSpace(strings.Join([]string{e.Venue, e.Station}, " "))
+
+		cal.Events = append(cal.Events, ical.Event{
+			UID:      fmt.Sprintf("match-%d@maestro", e.MatchID),
+			Sequence: e.Sequence,
+			Stamp:    now,
+			Start:    e.ScheduledAt,
+			End:      e.ScheduledAt.Add(time.Duration(e.EstimatedMinutes) * time.Minute),
+			Summary:  summary,
+			Location: location,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	w.WriteHeader(http.StatusOK)
+
+	err := cal.Write(w)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func orTBD(name string) string {
+	if name == "" {
+		return "TBD"
+	}
+	return name
+}
+
+func (app *application) tournamentCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	viewer := app.feedViewer(w, r)
+	if viewer == nil {
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := app.isTournamentStaff(viewer)
+	if err == nil && !allowed {
+		allowed, err = app.models.Participant.IsEntered(id, viewer.ID)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !allowed {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	entries, err := app.models.Match.GetCalendarByTournament(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeCalendar(w, r, tournament.Name, entries)
+}
+
+func (app *application) teamCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	viewer := app.feedViewer(w, r)
+	if viewer == nil {
+		return
+	}
+
+	team, err := app.models.Team.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := app.isTournamentStaff(viewer)
+	if err == nil && !allowed {
+		allowed, err = app.models.TeamUsers.IsMember(id, viewer.ID)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !allowed {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	entries, err := app.models.Match.GetCalendarByTeam(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeCalendar(w, r, team.Name, entries)
+}
+
+func (app *application) userCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// A player's own feed is only ever served to them.
+	viewer := app.feedViewer(w, r)
+	if viewer == nil {
+		return
+	}
+
+	if viewer.ID != id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	entries, err := app.models.Match.GetCalendarByUser(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeCalendar(w, r, "Maestro matches", entries)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WrastAct/maestro/internal/analytics"
+	"github.com/WrastAct/maestro/internal/data"
+)
+
+// playerCareerHandler brings together a player's teams, tournaments, earnings
+// and record per game. The stress trend is only included for viewers the
+// player shares their stress with.
+func (app *application) playerCareerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	teams, err := app.models.Career.GetTeams(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tournaments, err := app.models.Career.GetTournaments(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	played, err := app.models.UserMatch.GetPlayedByUser(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var earnings float64
+	for _, t := range tournaments {
+		earnings += t.PrizeMoney
+	}
+
+	career := envelope{
+		"player": envelope{
+			"id":          user.ID,
+			"name":        user.Name,
+			"nationality": user.Nationality,
+		},
+		"teams":       teams,
+		"tournaments": tournaments,
+		"games":       analytics.Games(played, tournaments),
+		"earnings":    earnings,
+	}
+
+	viewer, err := app.newBiometricViewer(app.contextGetUser(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	access, err := viewer.access(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if access[data.BiometricStress] {
+		career["stress_trend"] = analytics.StressTrend(played)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"career": career}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// consentCacheTTL is how long a live stream keeps using what it worked out a
+// viewer may see of a player, and so how long a change of consent takes to
+// reach streams already open.
+const consentCacheTTL = time.Minute
+
+type cachedAccess struct {
+	access data.BiometricAccess
+	loaded time.Time
+}
+
+// biometricViewer works out which biometric data of players a user may see,
+// from the audiences the user belongs to for each player and what each player
+// has shared with them. It is not safe for concurrent use.
+type biometricViewer struct {
+	app             *application
+	user            *data.User
+	tournamentStaff bool
+	players         map[int64]cachedAccess
+}
+
+func (app *application) newBiometricViewer(user *data.User) (*biometricViewer, error) {
+	bv := &biometricViewer{
+		app:     app,
+		user:    user,
+		players: make(map[int64]cachedAccess),
+	}
+
+	if user.IsAnonymous() {
+		return bv, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	bv.tournamentStaff = permissions.Include("admin") || permissions.Include("referee")
+
+	return bv, nil
+}
+
+func (bv *biometricViewer) access(playerID int64) (data.BiometricAccess, error) {
+	if cached, ok := bv.players[playerID]; ok && time.Since(cached.loaded) < consentCacheTTL {
+		return cached.access, nil
+	}
+
+	audiences := []string{}
+
+	if !bv.user.IsAnonymous() {
+		if bv.user.ID == playerID {
+			audiences = append(audiences, data.AudienceSelf)
+		}
+
+		if bv.tournamentStaff {
+			audiences = append(audiences, data.AudienceTournamentStaff)
+		}
+
+		staff, err := bv.app.models.TeamUsers.IsStaffOf(bv.user.ID, playerID)
+		if err != nil {
+			return nil, err
+		}
+
+		if staff {
+			audiences = append(audiences, data.AudienceTeamStaff)
+		}
+	}
+
+	access, err := bv.app.models.Consent.GetAccess(playerID, audiences)
+	if err != nil {
+		return nil, err
+	}
+
+	bv.players[playerID] = cachedAccess{access: access, loaded: time.Now()}
+	return access, nil
+}
+
+// sampleView is a sample with the biometrics the viewer may not see left out
+// and listed as redacted.
+func sampleView(sample data.SensorSample, access data.BiometricAccess) envelope {
+	view := envelope{
+		"user_id":     sample.UserID,
+		"at":          sample.At,
+		"humidity":    sample.Humidity,
+		"temperature": sample.Temperature,
+		"pressure":    sample.Pressure,
+	}
+
+	if sample.Device != "" {
+		view["device"] = sample.Device
+	}
+
+	redacted := []string{}
+
+	if access[data.BiometricHeartRate] {
+		view["heart_rate"] = sample.HeartRate
+	} else {
+		redacted = append(redacted, data.BiometricHeartRate)
+	}
+
+	if access[data.BiometricStress] {
+		view["stress"] = sample.Stress
+	} else {
+		redacted = append(redacted, data.BiometricStress)
+	}
+
+	if len(redacted) > 0 {
+		view["redacted"] = redacted
+	}
+
+	return view
+}
+
+// consentOwner loads the player named by the :id parameter for a consent
+// request, which only the player and admins may make.
+func (app *application) consentOwner(w http.ResponseWriter, r *http.Request) *data.User {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	user := app.contextGetUser(r)
+
+	if user.ID != id {
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil
+		}
+
+		if !permissions.Include("admin") {
+			app.notPermittedResponse(w, r)
+			return nil
+		}
+	}
+
+	player, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return player
+}
+
+func (app *application) showConsentsHandler(w http.ResponseWriter, r *http.Request) {
+	player := app.consentOwner(w, r)
+	if player == nil {
+		return
+	}
+
+	consents, err := app.models.Consent.GetAllForUser(player.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user_id": player.ID, "consents": consents}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateConsentsHandler records a player's choices of who to share their
+// biometric data with. Only the player can make them.
+func (app *application) updateConsentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if user.ID != id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Consents []*data.Consent `json:"consents"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Consents) > 0, "consents", "must contain at least one consent")
+
+	seen := make(map[[2]string]bool)
+
+	for _, consent := range input.Consents {
+		cv := validator.New()
+		if data.ValidateConsent(cv, consent); !cv.Valid() {
+			for key, message := range cv.Errors {
+				v.AddError("consents", key+" "+message)
+			}
+			break
+		}
+
+		key := [2]string{consent.Data, consent.Audience}
+		v.Check(!seen[key], "consents", "must not contain the same data and audience twice")
+		seen[key] = true
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	changes, err := app.models.Consent.Set(user.ID, user.ID, input.Consents)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	consents, err := app.models.Consent.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user_id": user.ID, "consents": consents, "changes": changes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) consentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	player := app.consentOwner(w, r)
+	if player == nil {
+		return
+	}
+
+	changes, err := app.models.Consent.GetHistory(player.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user_id": player.ID, "history": changes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// matchBiometricsHandler summarises the biometrics of a match's players for
+// any user, counting only players who share them for public aggregates.
+func (app *application) matchBiometricsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	aggregates, err := app.models.UserMatch.GetBiometricAggregates(id, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"match_id": id, "biometrics": aggregates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) tournamentBiometricsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	aggregates, err := app.models.UserMatch.GetBiometricAggregates(0, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tournament_id": id, "biometrics": aggregates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// deviceCacheTTL is how long an ingestion stream keeps using a device it has
+// looked up, and so how long a new calibration or quarantine takes to reach
+// streams already open.
+const deviceCacheTTL = time.Minute
+
+type cachedDevice struct {
+	device *data.Device
+	loaded time.Time
+}
+
+// deviceResolver looks up the devices that samples name by serial while they
+// are ingested, and remembers which ones were heard from. It is not safe for
+// concurrent use; each stream or upload has its own.
+type deviceResolver struct {
+	app     *application
+	devices map[string]cachedDevice
+	seen    map[int64]bool
+}
+
+func (app *application) newDeviceResolver() *deviceResolver {
+	return &deviceResolver{
+		app:     app,
+		devices: make(map[string]cachedDevice),
+		seen:    make(map[int64]bool),
+	}
+}
+
+// lookup returns the device with a serial, or nil if there is none.
+func (dr *deviceResolver) lookup(serial string) (*data.Device, error) {
+	if cached, ok := dr.devices[serial]; ok && time.Since(cached.loaded) < deviceCacheTTL {
+		return cached.device, nil
+	}
+
+	device, err := dr.app.models.Device.GetBySerial(serial)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	dr.devices[serial] = cachedDevice{device: device, loaded: time.Now()}
+	return device, nil
+}
+
+// calibrateSample checks the device a sample names, if any, and applies its
+// calibration to the sample.
+func (dr *deviceResolver) calibrateSample(v *validator.Validator, sample *data.SensorSample) error {
+	if sample.Device == "" {
+		return nil
+	}
+
+	device, err := dr.lookup(sample.Device)
+	if err != nil {
+		return err
+	}
+
+	checkDevice(v, device, data.DeviceWearable)
+
+	if v.Valid() {
+		device.CalibrateSample(sample)
+		dr.seen[device.ID] = true
+	}
+	return nil
+}
+
+// touch records the devices heard from since it was last called as seen.
+func (dr *deviceResolver) touch() {
+	if len(dr.seen) == 0 {
+		return
+	}
+
+	ids := make([]int64, 0, len(dr.seen))
+	for id := range dr.seen {
+		ids = append(ids, id)
+	}
+
+	err := dr.app.models.Device.Touch(ids, time.Now())
+	if err != nil {
+		dr.app.logger.PrintError(err, nil)
+		return
+	}
+
+	dr.seen = make(map[int64]bool)
+}
+
+func checkDevice(v *validator.Validator, device *data.Device, deviceType string) {
+	if device == nil {
+		v.AddError("device", "must be a registered device")
+		return
+	}
+
+	v.Check(device.Type == deviceType, "device", "must be a "+deviceType+" device")
+	v.Check(!device.IsQuarantined(), "device", "is quarantined")
+}
+
+// checkDeviceLocation checks that the venue and station a device is assigned
+// to exist and belong together.
+func (app *application) checkDeviceLocation(device *data.Device, v *validator.Validator) error {
+	if device.VenueID > 0 {
+		_, err := app.models.Venue.Get(device.VenueID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("venue_id", "must refer to an existing venue")
+		case err != nil:
+			return err
+		}
+	}
+
+	if device.StationID > 0 {
+		station, err := app.models.Station.Get(device.StationID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("station_id", "must refer to an existing station")
+		case err != nil:
+			return err
+		default:
+			v.Check(station.VenueID == device.VenueID, "station_id", "must be at the device's venue")
+		}
+	}
+
+	return nil
+}
+
+func (app *application) deviceFromParam(w http.ResponseWriter, r *http.Request) *data.Device {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	device, err := app.models.Device.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	device.SetStatus(time.Now(), app.config.devices.offlineAfter)
+
+	return device
+}
+
+func (app *application) createDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Serial    string        `json:"serial"`
+		Type      string        `json:"type"`
+		Firmware  string        `json:"firmware"`
+		VenueID   int64         `json:"venue_id"`
+		StationID int64         `json:"station_id"`
+		Offsets   *data.Offsets `json:"offsets"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	device := &data.Device{
+		Serial:    input.Serial,
+		Type:      input.Type,
+		Firmware:  input.Firmware,
+		VenueID:   input.VenueID,
+		StationID: input.StationID,
+	}
+
+	if input.Offsets != nil {
+		now := time.Now()
+		device.Offsets = *input.Offsets
+		device.CalibratedAt = &now
+	}
+
+	v := validator.New()
+
+	if data.ValidateDevice(v, device); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.checkDeviceLocation(device, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Device.Insert(device)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateDevice):
+			v.AddError("serial", "a device with this serial is already registered")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	device.SetStatus(time.Now(), app.config.devices.offlineAfter)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"device": device}, app.etagHeader(device.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listDevicesHandler lists the registered devices, optionally those of one
+// ?venue_id= or with one ?status=.
+func (app *application) listDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	venueID := app.readInt(qs, "venue_id", 0, v)
+	status := app.readString(qs, "status", "")
+
+	v.Check(venueID >= 0, "venue_id", "must not be negative")
+	v.Check(validator.In(status, "", data.DeviceOnline, data.DeviceOffline, data.DeviceNeverSeen, data.DeviceQuarantined),
+		"status", "must be online, offline, never_seen or quarantined")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	devices, err := app.models.Device.GetAll(int64(venueID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	matching := []*data.Device{}
+
+	for _, device := range devices {
+		device.SetStatus(now, app.config.devices.offlineAfter)
+
+		if status == "" || device.Status == status {
+			matching = append(matching, device)
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"devices": matching}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.deviceFromParam(w, r)
+	if device == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"device": device}, app.etagHeader(device.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.deviceFromParam(w, r)
+	if device == nil {
+		return
+	}
+
+	if !app.ifMatch(r, device.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Serial    *string `json:"serial"`
+		Type      *string `json:"type"`
+		Firmware  *string `json:"firmware"`
+		VenueID   *int64  `json:"venue_id"`
+		StationID *int64  `json:"station_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Serial != nil {
+		device.Serial = *input.Serial
+	}
+
+	if input.Type != nil {
+		device.Type = *input.Type
+	}
+
+	if input.Firmware != nil {
+		device.Firmware = *input.Firmware
+	}
+
+	// Moving a device to another venue takes it off its station there,
+	// unless a new one is given too.
+	if input.VenueID != nil {
+		if *input.VenueID != device.VenueID {
+			device.StationID = 0
+		}
+		device.VenueID = *input.VenueID
+	}
+
+	if input.StationID != nil {
+		device.StationID = *input.StationID
+	}
+
+	v := validator.New()
+
+	if data.ValidateDevice(v, device); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.checkDeviceLocation(device, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Device.Update(device)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateDevice):
+			v.AddError("serial", "a device with this serial is already registered")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"device": device}, app.etagHeader(device.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// calibrateDeviceHandler replaces a device's calibration offsets. They apply
+// to data ingested from then on; what was stored before keeps the offsets it
+// was stored with.
+func (app *application) calibrateDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.deviceFromParam(w, r)
+	if device == nil {
+		return
+	}
+
+	if !app.ifMatch(r, device.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Offsets *data.Offsets `json:"offsets"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Offsets != nil, "offsets", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	now := time.Now()
+	device.Offsets = *input.Offsets
+	device.CalibratedAt = &now
+
+	if data.ValidateDevice(v, device); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Device.Update(device)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"device": device}, app.etagHeader(device.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deviceHeartbeatHandler lets a device report that it is up, and the firmware
+// it is running.
+func (app *application) deviceHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Serial   string `json:"serial"`
+		Firmware string `json:"firmware"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Serial != "", "serial", "must be provided")
+	v.Check(len(input.Firmware) <= 50, "firmware", "must not be more than 50 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	device, err := app.models.Device.GetBySerial(input.Serial)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("serial", "must be a registered device")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Device.Heartbeat(device, input.Firmware)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	device.SetStatus(time.Now(), app.config.devices.offlineAfter)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"device": device}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// quarantineDeviceHandler takes a device out of use and sets aside the data
+// it took since ?since=, or all of it, so that it no longer counts towards
+// players' records, charts or the environment of venues. The records of
+// decided matches that used the data are recomputed without it, and players
+// left with no samples in a match lose their stress average for it.
+func (app *application) quarantineDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.deviceFromParam(w, r)
+	if device == nil {
+		return
+	}
+
+	if device.IsQuarantined() {
+		app.deviceQuarantinedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason string     `json:"reason"`
+		Since  *time.Time `json:"since"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Reason != "", "reason", "must be provided")
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var since time.Time
+	if input.Since != nil {
+		since = *input.Since
+	}
+
+	result, err := app.models.Device.Quarantine(device, input.Reason, since)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.resummarizeMatches(result.Matches)
+
+	device.SetStatus(time.Now(), app.config.devices.offlineAfter)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"device": device, "quarantined": result}, app.etagHeader(device.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// releaseDeviceHandler returns a quarantined device to use and restores all
+// of its data.
+func (app *application) releaseDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.deviceFromParam(w, r)
+	if device == nil {
+		return
+	}
+
+	if !device.IsQuarantined() {
+		app.deviceNotQuarantinedResponse(w, r)
+		return
+	}
+
+	result, err := app.models.Device.Release(device)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.resummarizeMatches(result.Matches)
+
+	device.SetStatus(time.Now(), app.config.devices.offlineAfter)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"device": device, "restored": result}, app.etagHeader(device.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resummarizeMatches recomputes the players' records of those matches that
+// are decided, after the data they were computed from changed.
+func (app *application) resummarizeMatches(matchIDs []int64) {
+	for _, id := range matchIDs {
+		match, err := app.models.Match.Get(id)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"match_id": strconv.FormatInt(id, 10)})
+			continue
+		}
+
+		if match.IsDecided() {
+			app.summarizeSamples(match.ID)
+		}
+	}
+}
+
+// deviceUsageHandler traces where a device's data went: the matches it took
+// samples in and the stations it took readings at.
+func (app *application) deviceUsageHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.deviceFromParam(w, r)
+	if device == nil {
+		return
+	}
+
+	usage, err := app.models.Device.GetUsage(device.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"device": device, "usage": usage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
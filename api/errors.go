@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
+
+	"github.com/WrastAct/maestro/internal/data"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -56,6 +59,11 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since it was last fetched"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -81,3 +89,111 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "you don't have necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) seedingLockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "seeding can not be changed once matches have been generated"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) invalidTransitionResponse(w http.ResponseWriter, r *http.Request, from, to string) {
+	message := fmt.Sprintf("a tournament can not move from %s to %s", from, to)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) tournamentStatusResponse(w http.ResponseWriter, r *http.Request, status string) {
+	message := fmt.Sprintf("this action is not allowed while the tournament is %s", status)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) rosterLockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the team roster is locked while the team plays in a live tournament"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) membershipOverlapResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the user is already in this team, or another team of the same game, for some of these dates"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) captainTakenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the team already has a captain for some of these dates"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) scheduleConflictResponse(w http.ResponseWriter, r *http.Request, conflicts []*data.ScheduleConflict) {
+	message := map[string]interface{}{
+		"message":   "the match overlaps with matches already scheduled for the same participants or station",
+		"conflicts": conflicts,
+	}
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) notCaptainResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you are not a captain of a side allowed to do this"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) matchDecidedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the match already has a final result"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) reportOpenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the match already has a result waiting for confirmation or a referee"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) reportClosedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the report is no longer waiting for confirmation"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) disputeClosedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the dispute has already been resolved"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) vetoExistsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the match already has a veto running or completed"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) vetoClosedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the match has no veto in progress"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) notYourTurnResponse(w http.ResponseWriter, r *http.Request) {
+	message := "it is not your turn in the veto"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) matchNotLiveResponse(w http.ResponseWriter, r *http.Request) {
+	message := "telemetry can only be streamed while the match is live"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the request body must be one of %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) deviceQuarantinedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the device is already quarantined"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) deviceNotQuarantinedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the device is not quarantined"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) biometricAccessDeniedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the player has not shared this data with you"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) purgeRunningResponse(w http.ResponseWriter, r *http.Request) {
+	message := "expired data is already being purged, try again once it is done"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/events"
+)
+
+const (
+	// streamLifetime ends each event stream before the server's write timeout
+	// would cut it off. Clients reconnect on their own and resume from the
+	// last event ID they received.
+	streamLifetime = 25 * time.Second
+
+	streamHeartbeat = 10 * time.Second
+)
+
+// publish sends an event to the streams of a match and of its tournament.
+// A zero match ID only reaches the tournament stream.
+func (app *application) publish(typ string, payload envelope, matchID, tournamentID int64) {
+	topics := []string{events.TournamentTopic(tournamentID)}
+	if matchID > 0 {
+		topics = append(topics, events.MatchTopic(matchID))
+	}
+
+	err := app.events.Publish(typ, payload, topics...)
+	if err != nil && !errors.Is(err, events.ErrClosed) {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+func (app *application) publishMatch(typ string, match *data.Match) {
+	app.publish(typ, envelope{"match": match}, match.ID, match.TournamentID)
+}
+
+func (app *application) publishVeto(veto *data.Veto) {
+	app.publish("match.veto", envelope{"veto": veto}, veto.MatchID, veto.TournamentID)
+}
+
+// publishMatchByID loads the match and publishes it, for callers that only
+// changed it indirectly.
+func (app *application) publishMatchByID(typ string, id int64) {
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	app.publishMatch(typ, match)
+}
+
+func (app *application) matchEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.streamEvents(w, r, events.MatchTopic(id))
+}
+
+func (app *application) tournamentEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.streamEvents(w, r, events.TournamentTopic(id))
+}
+
+// streamEvents writes the events of a topic as Server-Sent Events until the
+// client goes away, the stream's lifetime is up or the server shuts down. A
+// Last-Event-ID header, or last_event_id query parameter for clients that
+// can't set headers, replays what was missed; if that's no longer possible a
+// "resync" event tells the client to reload its state.
+func (app *application) streamEvents(w http.ResponseWriter, r *http.Request, topic string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("streaming unsupported"))
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	var last uint64
+	if lastID != "" {
+		var err error
+		last, err = strconv.ParseUint(lastID, 10, 64)
+		if err != nil || last == 0 {
+			app.badRequestResponse(w, r, errors.New("invalid last event id"))
+			return
+		}
+	}
+
+	sub, replay, complete, err := app.events.Subscribe(topic, last)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "the server is shutting down")
+		return
+	}
+	defer app.events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 1000\n\n")
+
+	if !complete {
+		fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+	}
+
+	for _, e := range replay {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	lifetime := time.NewTimer(streamLifetime)
+	defer lifetime.Stop()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-lifetime.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+}
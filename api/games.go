@@ -10,7 +10,9 @@ import (
 
 func (app *application) createGameHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name string `json:"name"`
+		Name         string          `json:"name"`
+		MapPool      []string        `json:"map_pool"`
+		VetoSequence []data.VetoStep `json:"veto_sequence"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -20,7 +22,17 @@ func (app *application) createGameHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	game := &data.Game{
-		Name: input.Name,
+		Name:         input.Name,
+		MapPool:      input.MapPool,
+		VetoSequence: input.VetoSequence,
+	}
+
+	if game.MapPool == nil {
+		game.MapPool = []string{}
+	}
+
+	if game.VetoSequence == nil {
+		game.VetoSequence = []data.VetoStep{}
 	}
 
 	if err != nil {
@@ -43,7 +55,7 @@ func (app *application) createGameHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"game": game}, nil)
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"game": game}, app.etagHeader(game.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -67,7 +79,7 @@ func (app *application) showGameHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"game": game}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"game": game}, app.etagHeader(game.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -91,8 +103,15 @@ func (app *application) updateGameHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !app.ifMatch(r, game.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var input struct {
-		Name *string `json:"name"`
+		Name         *string          `json:"name"`
+		MapPool      *[]string        `json:"map_pool"`
+		VetoSequence *[]data.VetoStep `json:"veto_sequence"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -105,6 +124,14 @@ func (app *application) updateGameHandler(w http.ResponseWriter, r *http.Request
 		game.Name = *input.Name
 	}
 
+	if input.MapPool != nil {
+		game.MapPool = *input.MapPool
+	}
+
+	if input.VetoSequence != nil {
+		game.VetoSequence = *input.VetoSequence
+	}
+
 	v := validator.New()
 
 	if data.ValidateGame(v, game); !v.Valid() {
@@ -114,11 +141,16 @@ func (app *application) updateGameHandler(w http.ResponseWriter, r *http.Request
 
 	err = app.models.Game.Update(game)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"game": game}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"game": game}, app.etagHeader(game.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -131,11 +163,29 @@ func (app *application) deleteGameHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Game.Delete(id)
+	game, err := app.models.Game.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.ifMatch(r, game.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	err = app.models.Game.Delete(id, app.ifMatchVersion(r, game.Version))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func (app *application) createGameSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Game.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		MatchSchema  json.RawMessage `json:"match_schema"`
+		PlayerSchema json.RawMessage `json:"player_schema"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	schema := &data.GameSchema{
+		GameID:       id,
+		MatchSchema:  input.MatchSchema,
+		PlayerSchema: input.PlayerSchema,
+	}
+
+	if len(schema.MatchSchema) == 0 {
+		schema.MatchSchema = json.RawMessage("{}")
+	}
+
+	if len(schema.PlayerSchema) == 0 {
+		schema.PlayerSchema = json.RawMessage("{}")
+	}
+
+	v := validator.New()
+
+	if data.ValidateGameSchema(v, schema); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.GameSchema.Insert(schema)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"schema": schema}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listGameSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	schemas, err := app.models.GameSchema.GetAllByGame(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"schemas": schemas}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showGameSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("version"))
+	if err != nil || version < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	schema, err := app.models.GameSchema.Get(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"schema": schema}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// gameSchemaFor returns the schema results for a tournament's game have to
+// match: the given version if it's non-zero, otherwise the latest one. It
+// returns nil if the game has no schema.
+func (app *application) gameSchemaFor(tournamentID int64, version int) (*data.GameSchema, error) {
+	tournament, err := app.models.Tournament.Get(tournamentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema *data.GameSchema
+
+	if version > 0 {
+		schema, err = app.models.GameSchema.Get(tournament.GameID, version)
+	} else {
+		schema, err = app.models.GameSchema.GetLatest(tournament.GameID)
+	}
+
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return schema, err
+}
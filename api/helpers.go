@@ -1,28 +1,73 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
 
 type envelope map[string]interface{}
 
+func (app *application) etagHeader(version int) http.Header {
+	headers := make(http.Header)
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, version))
+	return headers
+}
+
+// ifMatch reports whether the request may act on a resource at the given
+// version. Requests without an If-Match header always may. Weak tags never
+// match, as If-Match requires a strong comparison.
+func (app *application) ifMatch(r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	current := fmt.Sprintf(`"%d"`, version)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersion returns the version a conditional delete should be bound
+// to, or 0 if the request isn't conditional.
+func (app *application) ifMatchVersion(r *http.Request, version int) int {
+	if r.Header.Get("If-Match") == "" {
+		return 0
+	}
+	return version
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 
 	js, err := json.MarshalIndent(data, "", "\t")
@@ -42,6 +87,37 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// writeCachedJSON writes data like writeJSON, tagged with a hash of its
+// content so that clients and caches can revalidate it cheaply. A request
+// whose If-None-Match already has the current tag gets an empty 304.
+func (app *application) writeCachedJSON(w http.ResponseWriter, r *http.Request, data envelope, maxAge time.Duration) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	sum := sha256.Sum256(js)
+	etag := fmt.Sprintf(`"%x"`, sum[:16])
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+	w.Header().Add("Vary", "Authorization")
+
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+	return nil
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 
 	maxBytes := 1_048_576
@@ -94,6 +170,81 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	csv := qs.Get(key)
+
+	if csv == "" {
+		return defaultValue
+	}
+
+	return strings.Split(csv, ",")
+}
+
+func (app *application) readDuration(qs url.Values, key string, defaultValue time.Duration, v *validator.Validator) time.Duration {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		v.AddError(key, "must be a duration such as 10s or 1m")
+		return defaultValue
+	}
+
+	return d
+}
+
+// readTime accepts either an RFC 3339 timestamp or a plain date, which is
+// taken to mean midnight UTC.
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t
+	}
+
+	t, err = time.Parse("2006-01-02", s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp or a date")
+		return defaultValue
+	}
+
+	return t
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 
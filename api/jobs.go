@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+)
+
+func (app *application) startJobs() {
+	app.every("auto-accept results", app.config.results.sweepInterval, func() error {
+		reports, err := app.models.Report.AutoAccept()
+		if err != nil {
+			return err
+		}
+
+		for _, report := range reports {
+			app.summarizeSamples(report.MatchID)
+			app.rateMatch(report.MatchID)
+			app.publishMatchByID("match.result", report.MatchID)
+		}
+
+		if len(reports) > 0 {
+			app.logger.PrintInfo("results auto-accepted", map[string]string{
+				"count": strconv.Itoa(len(reports)),
+			})
+		}
+		return nil
+	})
+
+	app.every("expire veto turns", app.config.veto.sweepInterval, func() error {
+		vetoes, err := app.models.Veto.ExpireTurns()
+		if err != nil {
+			return err
+		}
+
+		for _, veto := range vetoes {
+			app.publishVeto(veto)
+		}
+		return nil
+	})
+
+	app.every("prune events", time.Minute, func() error {
+		app.events.Prune()
+		return nil
+	})
+
+	app.every("prune stress baselines", time.Minute, func() error {
+		app.detector.Prune(10 * time.Minute)
+		return nil
+	})
+
+	app.every("refresh leaderboards", app.config.leaderboards.refreshInterval, app.refreshLeaderboards)
+
+	if app.config.retention.interval > 0 {
+		app.every("purge expired data", app.config.retention.interval, func() error {
+			_, err := app.purgeExpiredData(false, 0)
+			if errors.Is(err, data.ErrPurgeRunning) {
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// every runs fn on a fixed interval in the background until the server shuts
+// down. Failures are logged and the job carries on with the next tick.
+func (app *application) every(name string, interval time.Duration, fn func() error) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.done:
+				return
+			case <-ticker.C:
+				app.runJob(name, fn)
+			}
+		}
+	}()
+}
+
+func (app *application) runJob(name string, fn func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"job": name})
+		}
+	}()
+
+	err := fn()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": name})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// leaderboardState tracks whether the leaderboards are behind the data they
+// are built from. Changes only mark them stale; a job rebuilds them at most
+// once per interval, however many results come in meanwhile.
+type leaderboardState struct {
+	mu    sync.Mutex
+	stale bool
+}
+
+func (app *application) invalidateLeaderboards() {
+	app.leaderboards.mu.Lock()
+	app.leaderboards.stale = true
+	app.leaderboards.mu.Unlock()
+}
+
+func (app *application) refreshLeaderboards() error {
+	app.leaderboards.mu.Lock()
+	stale := app.leaderboards.stale
+	app.leaderboards.stale = false
+	app.leaderboards.mu.Unlock()
+
+	if !stale {
+		return nil
+	}
+
+	err := app.models.Leaderboard.Refresh()
+	if err != nil {
+		app.invalidateLeaderboards()
+		return err
+	}
+
+	return nil
+}
+
+// leaderboardHandler ranks the players or teams of a game, over a season or
+// all time, and optionally within a region. Pages are chained through the
+// next_cursor of the metadata.
+func (app *application) leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filter := data.LeaderboardFilter{
+		Type:     app.readString(qs, "type", data.LeaderboardPlayers),
+		GameID:   int64(app.readInt(qs, "game", 0, v)),
+		SeasonID: int64(app.readInt(qs, "season", 0, v)),
+		Region:   app.readString(qs, "region", ""),
+		Sort:     app.readString(qs, "sort", "elo"),
+		Limit:    app.readInt(qs, "limit", 25, v),
+	}
+
+	var cursor *data.LeaderboardCursor
+
+	if s := app.readString(qs, "cursor", ""); s != "" {
+		var err error
+
+		cursor, err = data.DecodeLeaderboardCursor(s)
+		if err != nil {
+			v.AddError("cursor", "must be the next_cursor of a previous page")
+		}
+	}
+
+	if data.ValidateLeaderboardFilter(v, filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err := app.models.Game.Get(filter.GameID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("game", "must refer to an existing game")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if filter.SeasonID > 0 {
+		season, err := app.models.Season.Get(filter.SeasonID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("season", "must refer to an existing season")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		v.Check(season.GameID == 0 || season.GameID == filter.GameID, "season", "must be a season of the game")
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	entries, next, err := app.models.Leaderboard.Get(filter, cursor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	metadata := envelope{"limit": filter.Limit}
+	if next != nil {
+		metadata["next_cursor"] = next.Encode()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"leaderboard": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -13,8 +13,10 @@ import (
 	"time"
 
 	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/events"
 	"github.com/WrastAct/maestro/internal/jsonlog"
 	"github.com/WrastAct/maestro/internal/mailer"
+	"github.com/WrastAct/maestro/internal/telemetry"
 
 	_ "github.com/lib/pq"
 )
@@ -48,14 +50,54 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	results struct {
+		confirmWindow time.Duration
+		sweepInterval time.Duration
+	}
+	veto struct {
+		sweepInterval time.Duration
+	}
+	events struct {
+		replaySize int
+		maxAge     time.Duration
+	}
+	telemetry struct {
+		rps   float64
+		burst int
+	}
+	samples struct {
+		maxUploadBytes int64
+		uploadTimeout  time.Duration
+	}
+	alerts struct {
+		zThreshold float64
+		cooldown   time.Duration
+	}
+	devices struct {
+		offlineAfter time.Duration
+	}
+	retention struct {
+		policies []data.RetentionPolicy
+		interval time.Duration
+	}
+	leaderboards struct {
+		refreshInterval time.Duration
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config        config
+	logger        *jsonlog.Logger
+	models        data.Models
+	mailer        mailer.Mailer
+	events        *events.Hub
+	telemetry     *telemetry.Hub
+	detector      *telemetry.Detector
+	retention     retentionStats
+	leaderboards  leaderboardState
+	stressReports stressReportCache
+	wg            sync.WaitGroup
+	done          chan struct{}
 }
 
 func main() {
@@ -84,7 +126,35 @@ func main() {
 		return nil
 	})
 
+	flag.DurationVar(&cfg.results.confirmWindow, "results-confirm-window", 24*time.Hour, "Time an opponent has to confirm or dispute a reported result")
+	flag.DurationVar(&cfg.results.sweepInterval, "results-sweep-interval", time.Minute, "How often unconfirmed results are checked for automatic acceptance")
+
+	flag.DurationVar(&cfg.veto.sweepInterval, "veto-sweep-interval", 5*time.Second, "How often timed out veto turns are played out")
+
+	flag.IntVar(&cfg.events.replaySize, "events-replay-size", 256, "Events kept per match or tournament stream for resuming clients")
+	flag.DurationVar(&cfg.events.maxAge, "events-max-age", 15*time.Minute, "How long events are kept for resuming clients")
+
+	flag.Float64Var(&cfg.telemetry.rps, "telemetry-rps", 20, "Maximum sensor samples per second on a single connection")
+	flag.IntVar(&cfg.telemetry.burst, "telemetry-burst", 40, "Maximum burst of sensor samples on a single connection")
+
+	flag.Int64Var(&cfg.samples.maxUploadBytes, "samples-max-upload", 256<<20, "Maximum size in bytes of a sensor sample upload")
+	flag.DurationVar(&cfg.samples.uploadTimeout, "samples-upload-timeout", 10*time.Minute, "Time allowed to receive and store a sensor sample upload")
+
+	flag.Float64Var(&cfg.alerts.zThreshold, "alerts-z-threshold", 3, "Stress z-score against a player's baseline that raises an alert")
+	flag.DurationVar(&cfg.alerts.cooldown, "alerts-cooldown", 2*time.Minute, "Minimum time between stress alerts for the same player")
+
+	flag.DurationVar(&cfg.devices.offlineAfter, "devices-offline-after", 2*time.Minute, "Time without a heartbeat or data after which a device is shown as offline")
+
+	cfg.retention.policies = defaultRetention()
+	flag.Func("retention", "How long data is kept, as target=age pairs such as samples=90d,tokens=0s (comma separated)", func(val string) error {
+		return parseRetention(cfg.retention.policies, val)
+	})
+	flag.DurationVar(&cfg.retention.interval, "retention-interval", time.Hour, "How often expired data is purged (0 disables purging)")
+
+	flag.DurationVar(&cfg.leaderboards.refreshInterval, "leaderboards-refresh-interval", 15*time.Second, "How often leaderboards are rebuilt once results change")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
+	recomputeRatings := flag.Bool("recompute-ratings", false, "Replay every finished match into the ratings of its game and exit")
 
 	flag.Parse()
 
@@ -96,6 +166,18 @@ func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	if cfg.results.sweepInterval <= 0 {
+		logger.PrintFatal(fmt.Errorf("-results-sweep-interval must be greater than zero"), nil)
+	}
+
+	if cfg.veto.sweepInterval <= 0 {
+		logger.PrintFatal(fmt.Errorf("-veto-sweep-interval must be greater than zero"), nil)
+	}
+
+	if cfg.leaderboards.refreshInterval <= 0 {
+		logger.PrintFatal(fmt.Errorf("-leaderboards-refresh-interval must be greater than zero"), nil)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -120,10 +202,24 @@ func main() {
 	}))
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:    cfg,
+		logger:    logger,
+		models:    data.NewModels(db),
+		mailer:    mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		events:    events.New(cfg.events.replaySize, 64, cfg.events.maxAge),
+		telemetry: telemetry.New(256),
+		detector:  telemetry.NewDetector(cfg.alerts.zThreshold, cfg.alerts.cooldown),
+		done:      make(chan struct{}),
+	}
+
+	expvar.Publish("retention", expvar.Func(app.retentionVars))
+
+	if *recomputeRatings {
+		err = app.recomputeAllRatings()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
 	}
 
 	err = app.serve()
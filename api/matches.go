@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/WrastAct/maestro/internal/data"
 	"github.com/WrastAct/maestro/internal/validator"
@@ -10,8 +13,19 @@ import (
 
 func (app *application) createMatchHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		TournamentID int64  `json:"tournament_id"`
-		MatchData    string `json:"data"`
+		TournamentID        int64           `json:"tournament_id"`
+		HomeParticipantID   int64           `json:"home_participant_id"`
+		AwayParticipantID   int64           `json:"away_participant_id"`
+		Stage               string          `json:"stage"`
+		TimeZone            string          `json:"time_zone"`
+		EstimatedMinutes    int             `json:"estimated_minutes"`
+		StationID           int64           `json:"station_id"`
+		Status              string          `json:"status"`
+		HomeScore           int             `json:"home_score"`
+		AwayScore           int             `json:"away_score"`
+		WinnerParticipantID int64           `json:"winner_participant_id"`
+		Maps                []data.MatchMap `json:"maps"`
+		Extras              json.RawMessage `json:"extras"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -21,31 +35,447 @@ func (app *application) createMatchHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	match := &data.Match{
-		TournamentID: input.TournamentID,
-		Matchdata:    input.MatchData,
+		TournamentID:        input.TournamentID,
+		HomeParticipantID:   input.HomeParticipantID,
+		AwayParticipantID:   input.AwayParticipantID,
+		Stage:               input.Stage,
+		TimeZone:            input.TimeZone,
+		EstimatedMinutes:    input.EstimatedMinutes,
+		StationID:           input.StationID,
+		Status:              input.Status,
+		HomeScore:           input.HomeScore,
+		AwayScore:           input.AwayScore,
+		WinnerParticipantID: input.WinnerParticipantID,
+		Maps:                input.Maps,
+		Extras:              input.Extras,
 	}
 
+	if match.TimeZone == "" {
+		match.TimeZone = "UTC"
+	}
+
+	if match.EstimatedMinutes == 0 {
+		match.EstimatedMinutes = 60
+	}
+
+	if match.Status == "" {
+		match.Status = data.MatchScheduled
+	}
+
+	if len(match.Extras) == 0 {
+		match.Extras = json.RawMessage("{}")
+	}
+
+	match.DeriveWinner()
+
+	v := validator.New()
+
+	schema, err := app.gameSchemaFor(match.TournamentID, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("tournament_id", "must refer to an existing tournament")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if schema != nil {
+		match.SchemaVersion = schema.Version
+	}
+
+	if data.ValidateMatch(v, match, schema); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkMatchParticipants(w, r, match, v) {
+		return
+	}
+
+	if !app.checkMatchStation(w, r, match, v) {
+		return
+	}
+
+	err = app.models.Match.Insert(match)
+	if err != nil {
+		switch {
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if match.Status == data.MatchFinished {
+		app.rateMatch(match.ID)
+	}
+
+	app.publishMatch("match.created", match)
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"match": match}, app.etagHeader(match.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMatchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
+
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"match": match}, app.etagHeader(match.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMatchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.ifMatch(r, match.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		HomeParticipantID   *int64           `json:"home_participant_id"`
+		AwayParticipantID   *int64           `json:"away_participant_id"`
+		Stage               *string          `json:"stage"`
+		Status              *string          `json:"status"`
+		HomeScore           *int             `json:"home_score"`
+		AwayScore           *int             `json:"away_score"`
+		WinnerParticipantID *int64           `json:"winner_participant_id"`
+		Maps                *[]data.MatchMap `json:"maps"`
+		Extras              *json.RawMessage `json:"extras"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	previous := *match
+	previousStatus := match.Status
+
+	if input.HomeParticipantID != nil {
+		match.HomeParticipantID = *input.HomeParticipantID
+	}
+
+	if input.AwayParticipantID != nil {
+		match.AwayParticipantID = *input.AwayParticipantID
+	}
+
+	if input.Stage != nil {
+		match.Stage = *input.Stage
+	}
+
+	if input.Status != nil {
+		match.Status = *input.Status
+	}
+
+	if input.HomeScore != nil {
+		match.HomeScore = *input.HomeScore
+	}
+
+	if input.AwayScore != nil {
+		match.AwayScore = *input.AwayScore
+	}
+
+	if input.WinnerParticipantID != nil {
+		match.WinnerParticipantID = *input.WinnerParticipantID
+	}
+
+	if input.Maps != nil {
+		match.Maps = *input.Maps
+	}
+
+	if input.Extras != nil {
+		match.Extras = *input.Extras
+	}
+
+	// The winners loaded with the match may have been derived from its old
+	// result. Unless the request names them again, derive them afresh. A
+	// match that is no longer decided has no winner at all.
+	participantsChanged := match.HomeParticipantID != previous.HomeParticipantID || match.AwayParticipantID != previous.AwayParticipantID
+	resultChanged := participantsChanged || input.Status != nil || input.HomeScore != nil || input.AwayScore != nil || input.Maps != nil
+
+	switch {
+	case !match.IsDecided():
+		match.WinnerParticipantID = 0
+	case resultChanged && input.WinnerParticipantID == nil:
+		match.WinnerParticipantID = 0
+	}
+
+	if participantsChanged && input.Maps == nil {
+		for i := range match.Maps {
+			match.Maps[i].WinnerParticipantID = 0
+		}
+	}
+
+	match.DeriveWinner()
+
+	// Results are always checked against the schema the match was first
+	// recorded under, even if the game has a newer one by now.
+	var schema *data.GameSchema
+
+	if match.SchemaVersion > 0 {
+		schema, err = app.gameSchemaFor(match.TournamentID, match.SchemaVersion)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	v := validator.New()
 
-	if data.ValidateMatch(v, match); !v.Valid() {
+	if data.ValidateMatch(v, match, schema); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Match.Insert(match)
+	if !app.checkMatchParticipants(w, r, match, v) {
+		return
+	}
+
+	err = app.models.Match.Update(match)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if previous.Status == data.MatchFinished || match.Status == data.MatchFinished {
+		if match.Status != previous.Status || match.WinnerParticipantID != previous.WinnerParticipantID ||
+			match.HomeParticipantID != previous.HomeParticipantID || match.AwayParticipantID != previous.AwayParticipantID {
+			app.rateMatch(match.ID)
+		}
+	}
+
+	if match.Status != previousStatus {
+		if match.IsDecided() {
+			app.summarizeSamples(match.ID)
+		}
+		app.publishMatch("match.status", match)
+	} else {
+		app.publishMatch("match.updated", match)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"match": match}, app.etagHeader(match.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkMatchParticipants makes sure both sides of the match are registered in
+// its tournament. It writes the error response itself and returns false if
+// they aren't.
+func (app *application) checkMatchParticipants(w http.ResponseWriter, r *http.Request, match *data.Match, v *validator.Validator) bool {
+	if match.HomeParticipantID == 0 && match.AwayParticipantID == 0 {
+		return true
+	}
+
+	participants, err := app.models.Participant.GetAllByTournament(match.TournamentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	ids := make([]int64, len(participants))
+	for i, p := range participants {
+		ids[i] = p.ID
+	}
+
+	v.Check(match.HomeParticipantID == 0 || validator.InInts(match.HomeParticipantID, ids...), "home_participant_id", "must be registered in the tournament")
+	v.Check(match.AwayParticipantID == 0 || validator.InInts(match.AwayParticipantID, ids...), "away_participant_id", "must be registered in the tournament")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
+
+// checkMatchStation makes sure the match's station, if it has one, exists. It
+// writes the error response itself and returns false if it doesn't.
+func (app *application) checkMatchStation(w http.ResponseWriter, r *http.Request, match *data.Match, v *validator.Validator) bool {
+	if match.StationID == 0 {
+		return true
+	}
+
+	_, err := app.models.Station.Get(match.StationID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("station_id", "must refer to an existing station")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
+		return false
+	}
+
+	return true
+}
+
+func (app *application) scheduleMatchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"match": match}, nil)
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.ifMatch(r, match.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		ScheduledAt      json.RawMessage `json:"scheduled_at"`
+		TimeZone         *string         `json:"time_zone"`
+		EstimatedMinutes *int            `json:"estimated_minutes"`
+		StationID        *int64          `json:"station_id"`
+		Stage            *string         `json:"stage"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// An explicit null unschedules the match; leaving scheduled_at out keeps
+	// its current time.
+	if input.ScheduledAt != nil {
+		var scheduledAt *time.Time
+
+		err = json.Unmarshal(input.ScheduledAt, &scheduledAt)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New(`body contains incorrect JSON type for field "scheduled_at"`))
+			return
+		}
+
+		match.ScheduledAt = scheduledAt
+	}
+
+	if input.TimeZone != nil {
+		match.TimeZone = *input.TimeZone
+	}
+
+	if input.EstimatedMinutes != nil {
+		match.EstimatedMinutes = *input.EstimatedMinutes
+	}
+
+	if input.StationID != nil {
+		match.StationID = *input.StationID
+	}
+
+	if input.Stage != nil {
+		match.Stage = *input.Stage
+	}
+
+	v := validator.New()
+
+	if data.ValidateSchedule(v, match); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkMatchStation(w, r, match, v) {
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(match.TournamentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if match.ScheduledAt != nil {
+		loc, _ := time.LoadLocation(match.TimeZone)
+		day := match.ScheduledAt.In(loc).Format("2006-01-02")
+
+		start, startOK := calendarDay(tournament.StartDate)
+		end, endOK := calendarDay(tournament.EndDate)
+
+		if v.Check(startOK && endOK, "scheduled_at", "can't be checked against the tournament dates, which are not valid dates"); v.Valid() {
+			v.Check(day >= start && day <= end, "scheduled_at", "must fall within the tournament dates")
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	conflicts, err := app.models.Match.Schedule(match)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScheduleConflict):
+			app.scheduleConflictResponse(w, r, conflicts)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Matches are rated in the order they were played, which a finished match
+	// moved in the schedule may have changed.
+	if match.Status == data.MatchFinished {
+		app.rateMatch(match.ID)
+	}
+
+	app.publishMatch("match.schedule", match)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"match": match}, app.etagHeader(match.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -58,7 +488,7 @@ func (app *application) deleteMatchHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Match.Delete(id)
+	match, err := app.models.Match.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -69,6 +499,34 @@ func (app *application) deleteMatchHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !app.ifMatch(r, match.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(match.TournamentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Match.Delete(id, app.ifMatchVersion(r, match.Version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if match.Status == data.MatchFinished {
+		app.recomputeRatings(tournament.GameID)
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "match successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -76,7 +534,19 @@ func (app *application) deleteMatchHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (app *application) listMatchHandler(w http.ResponseWriter, r *http.Request) {
-	match, err := app.models.Match.GetAll()
+	var match []*data.Match
+
+	tournamentID, err := strconv.ParseInt(app.readString(r.URL.Query(), "tournament_id", "0"), 10, 64)
+	if err != nil || tournamentID < 0 {
+		app.failedValidationResponse(w, r, map[string]string{"tournament_id": "must be a positive integer"})
+		return
+	}
+
+	if tournamentID > 0 {
+		match, err = app.models.Match.GetByTournamentID(tournamentID)
+	} else {
+		match, err = app.models.Match.GetAll()
+	}
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -87,3 +557,15 @@ func (app *application) listMatchHandler(w http.ResponseWriter, r *http.Request)
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// calendarDay returns a stored date as YYYY-MM-DD. The database driver may
+// hand dates back as timestamps at midnight.
+func calendarDay(date string) (string, bool) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		t, err := time.Parse(layout, date)
+		if err == nil {
+			return t.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+func (app *application) createParticipantHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !tournament.IsRegistrationOpen() {
+		app.tournamentStatusResponse(w, r, tournament.Status)
+		return
+	}
+
+	var input struct {
+		TeamID int64   `json:"team_id"`
+		UserID int64   `json:"user_id"`
+		Region string  `json:"region"`
+		Group  string  `json:"group"`
+		Rating float64 `json:"rating"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	participant := &data.Participant{
+		TournamentID: id,
+		TeamID:       input.TeamID,
+		UserID:       input.UserID,
+		Region:       input.Region,
+		Group:        input.Group,
+		Rating:       input.Rating,
+	}
+
+	v := validator.New()
+
+	if data.ValidateParticipant(v, participant); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Participant.Insert(participant)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateParticipant):
+			v.AddError("participant", "is already registered for this tournament")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"participant": participant}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listParticipantHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	participants, err := app.models.Participant.GetAllByTournament(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"participants": participants}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteParticipantHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	participantID, err := app.readInt64Param(r, "participant_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !tournament.IsRegistrationOpen() {
+		app.tournamentStatusResponse(w, r, tournament.Status)
+		return
+	}
+
+	err = app.models.Participant.Delete(id, participantID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "participant successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/rating"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// rateMatch brings the ratings, and the players' stress reports, up to date
+// with a match whose result may have changed. Replaying a whole game can take
+// a while, so it is done in the background.
+func (app *application) rateMatch(matchID int64) {
+	app.stressReports.invalidateMatch(matchID)
+
+	app.background(func() {
+		err := app.models.Rating.RateMatch(matchID)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.PrintError(err, map[string]string{"match_id": strconv.FormatInt(matchID, 10)})
+			}
+			return
+		}
+
+		app.invalidateLeaderboards()
+	})
+}
+
+// recomputeRatings replays the game's matches in the background, for when a
+// rated match is gone and so can't be rated again.
+func (app *application) recomputeRatings(gameID int64) {
+	app.background(func() {
+		_, err := app.models.Rating.Recompute(gameID)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.PrintError(err, map[string]string{"game_id": strconv.FormatInt(gameID, 10)})
+			}
+			return
+		}
+
+		app.invalidateLeaderboards()
+	})
+}
+
+// recomputeAllRatings replays the finished matches of every game, one game at
+// a time. It backs the -recompute-ratings command.
+func (app *application) recomputeAllRatings() error {
+	games, err := app.models.Game.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, game := range games {
+		replayed, err := app.models.Rating.Recompute(game.ID)
+		if err != nil {
+			return err
+		}
+
+		app.logger.PrintInfo("ratings recomputed", map[string]string{
+			"game_id": strconv.FormatInt(game.ID, 10),
+			"matches": strconv.Itoa(replayed),
+		})
+	}
+
+	return app.models.Leaderboard.Refresh()
+}
+
+func (app *application) readRatingSystem(qs url.Values, v *validator.Validator) string {
+	system := app.readString(qs, "system", rating.SystemElo)
+	v.Check(validator.In(system, rating.Systems...), "system", "must be elo or glicko2")
+	return system
+}
+
+// gameRatingsHandler ranks the players, or with ?entity=teams the teams, of a
+// game by rating.
+func (app *application) gameRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Game.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	system := app.readRatingSystem(qs, v)
+	entity := app.readString(qs, "entity", "players")
+	limit := app.readInt(qs, "limit", 50, v)
+
+	v.Check(validator.In(entity, "players", "teams"), "entity", "must be players or teams")
+	v.Check(limit > 0 && limit <= 500, "limit", "must be between 1 and 500")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ratings, err := app.models.Rating.GetAllByGame(id, system, entity == "teams", limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"ratings": ratings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) recomputeGameRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Game.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.recomputeRatings(id)
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "the ratings are being recomputed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ratingsHandler lists the ratings of a player or team in every game.
+func (app *application) ratingsHandler(w http.ResponseWriter, r *http.Request, userID, teamID int64) {
+	ratings, err := app.models.Rating.GetAllFor(userID, teamID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"ratings": ratings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ratingHistoryHandler shows how the rating of a player or team in the game
+// given by ?game_id changed over its matches.
+func (app *application) ratingHistoryHandler(w http.ResponseWriter, r *http.Request, userID, teamID int64) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	system := app.readRatingSystem(qs, v)
+	gameID := int64(app.readInt(qs, "game_id", 0, v))
+
+	v.Check(gameID > 0, "game_id", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	history, err := app.models.Rating.GetHistory(gameID, system, userID, teamID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"game_id": gameID, "system": system, "history": history}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ratedPlayer and ratedTeam load the player or team named by the :id
+// parameter. They write the error response themselves and return 0 if there
+// is no such player or team.
+func (app *application) ratedPlayer(w http.ResponseWriter, r *http.Request) int64 {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0
+	}
+
+	_, err = app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return 0
+	}
+
+	return id
+}
+
+func (app *application) ratedTeam(w http.ResponseWriter, r *http.Request) int64 {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0
+	}
+
+	_, err = app.models.Team.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return 0
+	}
+
+	return id
+}
+
+func (app *application) playerRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	if id := app.ratedPlayer(w, r); id > 0 {
+		app.ratingsHandler(w, r, id, 0)
+	}
+}
+
+func (app *application) playerRatingHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if id := app.ratedPlayer(w, r); id > 0 {
+		app.ratingHistoryHandler(w, r, id, 0)
+	}
+}
+
+func (app *application) teamRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	if id := app.ratedTeam(w, r); id > 0 {
+		app.ratingsHandler(w, r, 0, id)
+	}
+}
+
+func (app *application) teamRatingHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if id := app.ratedTeam(w, r); id > 0 {
+		app.ratingHistoryHandler(w, r, 0, id)
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// resultInput is the result part of a report, shared with referees
+// overturning one.
+type resultInput struct {
+	MatchStatus         string          `json:"match_status"`
+	HomeScore           int             `json:"home_score"`
+	AwayScore           int             `json:"away_score"`
+	WinnerParticipantID int64           `json:"winner_participant_id"`
+	Maps                []data.MatchMap `json:"maps"`
+	Extras              json.RawMessage `json:"extras"`
+}
+
+func (in resultInput) report(matchID int64) *data.Report {
+	report := &data.Report{
+		MatchID:             matchID,
+		MatchStatus:         in.MatchStatus,
+		HomeScore:           in.HomeScore,
+		AwayScore:           in.AwayScore,
+		WinnerParticipantID: in.WinnerParticipantID,
+		Maps:                in.Maps,
+		Extras:              in.Extras,
+	}
+
+	if report.MatchStatus == "" {
+		report.MatchStatus = data.MatchFinished
+	}
+
+	if report.Maps == nil {
+		report.Maps = []data.MatchMap{}
+	}
+
+	if len(report.Extras) == 0 {
+		report.Extras = json.RawMessage("{}")
+	}
+
+	return report
+}
+
+// checkResult validates the reported result as if it were applied to match,
+// using the schema the match was recorded under, and fills in the derived
+// winners.
+func (app *application) checkResult(v *validator.Validator, match *data.Match, report *data.Report) error {
+	var schema *data.GameSchema
+	var err error
+
+	if match.SchemaVersion > 0 {
+		schema, err = app.gameSchemaFor(match.TournamentID, match.SchemaVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	result := report.ResultFor(match)
+
+	data.ValidateReport(v, report, result, schema)
+
+	report.WinnerParticipantID = result.WinnerParticipantID
+	report.Maps = result.Maps
+	return nil
+}
+
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(match.TournamentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if tournament.Status != data.TournamentLive {
+		app.tournamentStatusResponse(w, r, tournament.Status)
+		return
+	}
+
+	if match.IsDecided() {
+		app.matchDecidedResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	sides, err := app.models.Participant.CaptainedBy(user.ID, match.HomeParticipantID, match.AwayParticipantID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(sides) == 0 {
+		app.notCaptainResponse(w, r)
+		return
+	}
+
+	var input resultInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report := input.report(match.ID)
+	report.ParticipantID = sides[0]
+	report.ReportedBy = user.ID
+
+	v := validator.New()
+
+	err = app.checkResult(v, match, report)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Report.Insert(report, app.config.results.confirmWindow)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOpenReport):
+			app.reportOpenResponse(w, r)
+		case errors.Is(err, data.ErrMatchDecided):
+			app.matchDecidedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publish("match.report", envelope{"report": report}, match.ID, match.TournamentID)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	reports, err := app.models.Report.GetAllByMatch(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reports": reports}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// opponentReport loads the report named in the URL and makes sure the current
+// user captains the side that didn't submit it. It writes the error response
+// itself and returns nil if not.
+func (app *application) opponentReport(w http.ResponseWriter, r *http.Request) *data.Report {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	reportID, err := app.readInt64Param(r, "report_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	report, err := app.models.Report.Get(reportID)
+	if err != nil || report.MatchID != id {
+		switch {
+		case err == nil, errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+
+	opponent := match.HomeParticipantID
+	if report.ParticipantID == match.HomeParticipantID {
+		opponent = match.AwayParticipantID
+	}
+
+	sides, err := app.models.Participant.CaptainedBy(app.contextGetUser(r).ID, opponent)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+
+	if len(sides) == 0 {
+		app.notCaptainResponse(w, r)
+		return nil
+	}
+
+	return report
+}
+
+func (app *application) confirmReportHandler(w http.ResponseWriter, r *http.Request) {
+	report := app.opponentReport(w, r)
+	if report == nil {
+		return
+	}
+
+	err := app.models.Report.Confirm(report, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrReportClosed):
+			app.reportClosedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.summarizeSamples(report.MatchID)
+	app.rateMatch(report.MatchID)
+	app.publishMatchByID("match.result", report.MatchID)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) disputeReportHandler(w http.ResponseWriter, r *http.Request) {
+	report := app.opponentReport(w, r)
+	if report == nil {
+		return
+	}
+
+	var input struct {
+		Reason   string `json:"reason"`
+		Evidence []struct {
+			URL         string `json:"url"`
+			Description string `json:"description"`
+		} `json:"evidence"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	dispute := &data.Dispute{
+		RaisedBy: app.contextGetUser(r).ID,
+		Reason:   input.Reason,
+	}
+
+	for _, e := range input.Evidence {
+		dispute.Evidence = append(dispute.Evidence, &data.Evidence{URL: e.URL, Description: e.Description})
+	}
+
+	v := validator.New()
+
+	if data.ValidateDispute(v, dispute); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Report.Dispute(report, dispute)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrReportClosed):
+			app.reportClosedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"dispute": dispute}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	status := app.readString(r.URL.Query(), "status", data.DisputeOpen)
+
+	if v.Check(validator.In(status, data.DisputeOpen, data.DisputeResolved), "status", "must be open or resolved"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	disputes, err := app.models.Report.GetDisputes(status)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"disputes": disputes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	dispute, err := app.models.Report.GetDispute(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	report, err := app.models.Report.Get(dispute.ReportID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"dispute": dispute, "report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addEvidenceHandler lets referees and the captains of both sides attach
+// further evidence while a dispute is open.
+func (app *application) addEvidenceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	dispute, err := app.models.Report.GetDispute(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !permissions.Include("referee") {
+		match, err := app.models.Match.Get(dispute.MatchID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		sides, err := app.models.Participant.CaptainedBy(user.ID, match.HomeParticipantID, match.AwayParticipantID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if len(sides) == 0 {
+			app.notCaptainResponse(w, r)
+			return
+		}
+	}
+
+	var input struct {
+		URL         string `json:"url"`
+		Description string `json:"description"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	evidence := &data.Evidence{
+		SubmittedBy: user.ID,
+		URL:         input.URL,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+
+	if data.ValidateEvidence(v, evidence); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Report.AddEvidence(dispute, evidence)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDisputeClosed):
+			app.disputeClosedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"evidence": evidence}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) resolveDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	dispute, err := app.models.Report.GetDispute(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Decision   string `json:"decision"`
+		Resolution string `json:"resolution"`
+		resultInput
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	dispute.Decision = input.Decision
+	dispute.Resolution = input.Resolution
+	dispute.RefereeID = app.contextGetUser(r).ID
+
+	v := validator.New()
+
+	if data.ValidateResolution(v, dispute); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	report, err := app.models.Report.Get(dispute.ReportID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Overturning replaces the disputed result with the referee's own.
+	var result *data.Report
+
+	if dispute.Decision == data.DecisionOverturn {
+		match, err := app.models.Match.Get(dispute.MatchID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		result = input.report(match.ID)
+
+		err = app.checkResult(v, match, result)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.models.Report.Resolve(dispute, report, result)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDisputeClosed):
+			app.disputeClosedResponse(w, r)
+		case errors.Is(err, data.ErrReportClosed):
+			app.reportClosedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if dispute.Decision != data.DecisionVoid {
+		app.summarizeSamples(report.MatchID)
+		app.rateMatch(report.MatchID)
+		app.publishMatchByID("match.result", report.MatchID)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"dispute": dispute, "report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMatchAuditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entries, err := app.models.Report.GetAudit(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
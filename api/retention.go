@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+)
+
+// defaultRetention is how long each kind of data is kept unless configured
+// otherwise with -retention.
+func defaultRetention() []data.RetentionPolicy {
+	return []data.RetentionPolicy{
+		{Target: "samples", MaxAge: 90 * 24 * time.Hour},
+		{Target: "readings", MaxAge: 90 * 24 * time.Hour},
+		{Target: "stress_alerts", MaxAge: 365 * 24 * time.Hour},
+		{Target: "station_alerts", MaxAge: 365 * 24 * time.Hour},
+		{Target: "tokens", MaxAge: 0},
+	}
+}
+
+// parseRetention overrides the policies named in a list such as
+// "samples=30d,readings=forever".
+func parseRetention(policies []data.RetentionPolicy, val string) error {
+	for _, rule := range strings.Split(val, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+
+		target, age, ok := strings.Cut(rule, "=")
+		if !ok {
+			return fmt.Errorf("retention rule %q must look like target=age", rule)
+		}
+
+		target = strings.TrimSpace(target)
+		if !data.IsRetentionTarget(target) {
+			return fmt.Errorf("unknown retention target %q, must be one of %s", target, strings.Join(data.RetentionTargets, ", "))
+		}
+
+		maxAge, forever, err := data.ParseRetentionAge(age)
+		if err != nil {
+			return err
+		}
+
+		for i := range policies {
+			if policies[i].Target == target {
+				policies[i].MaxAge = maxAge
+				policies[i].Forever = forever
+			}
+		}
+	}
+
+	return nil
+}
+
+// retentionStats keeps what this process has purged, for expvar.
+type retentionStats struct {
+	mu      sync.Mutex
+	running bool
+	lastRun *data.RetentionRun
+	runs    int64
+	deleted map[string]int64
+}
+
+func (s *retentionStats) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running
+}
+
+func (app *application) retentionVars() interface{} {
+	app.retention.mu.Lock()
+	defer app.retention.mu.Unlock()
+
+	deleted := make(map[string]int64, len(app.retention.deleted))
+	for target, n := range app.retention.deleted {
+		deleted[target] = n
+	}
+
+	vars := map[string]interface{}{
+		"runs":    app.retention.runs,
+		"deleted": deleted,
+	}
+
+	if run := app.retention.lastRun; run != nil {
+		vars["last_run"] = run.StartedAt.Unix()
+		vars["last_run_deleted"] = run.Results
+	}
+
+	return vars
+}
+
+// purgeExpiredData runs the retention policies, logging and counting what
+// they deleted.
+func (app *application) purgeExpiredData(dryRun bool, triggeredBy int64) (*data.RetentionRun, error) {
+	if dryRun {
+		return app.models.Retention.Run(app.config.retention.policies, true, triggeredBy)
+	}
+
+	app.retention.mu.Lock()
+	if app.retention.running {
+		app.retention.mu.Unlock()
+		return nil, data.ErrPurgeRunning
+	}
+	app.retention.running = true
+	app.retention.mu.Unlock()
+
+	run, err := app.models.Retention.Run(app.config.retention.policies, false, triggeredBy)
+
+	app.retention.mu.Lock()
+	app.retention.running = false
+	if err != nil {
+		app.retention.mu.Unlock()
+		return nil, err
+	}
+	app.retention.lastRun = run
+	app.retention.runs++
+	if app.retention.deleted == nil {
+		app.retention.deleted = make(map[string]int64)
+	}
+	for _, result := range run.Results {
+		app.retention.deleted[result.Target] += result.Deleted
+	}
+	app.retention.mu.Unlock()
+
+	properties := map[string]string{
+		"duration": run.FinishedAt.Sub(run.StartedAt).String(),
+	}
+	for _, result := range run.Results {
+		properties[result.Target] = strconv.FormatInt(result.Deleted, 10)
+	}
+
+	app.logger.PrintInfo("expired data purged", properties)
+
+	return run, nil
+}
+
+func (app *application) retentionPolicies() []envelope {
+	policies := make([]envelope, 0, len(app.config.retention.policies))
+
+	for _, policy := range app.config.retention.policies {
+		policies = append(policies, envelope{"target": policy.Target, "keep": policy.Keep()})
+	}
+
+	return policies
+}
+
+// showRetentionHandler shows the retention policies and the latest purges.
+func (app *application) showRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	runs, err := app.models.Retention.GetRuns(20)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	lastRun, err := app.models.Retention.GetLastRun()
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"policies": app.retentionPolicies(),
+		"interval": app.config.retention.interval.String(),
+		"last_run": lastRun,
+		"runs":     runs,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runRetentionHandler runs the retention policies now. By default it is a dry
+// run, answering with what would be deleted. A real run can take a while, so
+// it is started in the background and its results show up in the runs.
+func (app *application) runRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DryRun *bool `json:"dry_run"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if input.DryRun == nil || *input.DryRun {
+		run, err := app.purgeExpiredData(true, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"run": run}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only a purge running in this process is caught here. One running in
+	// another instance holds the lock, and the purge started here gives up.
+	if app.retention.isRunning() {
+		app.purgeRunningResponse(w, r)
+		return
+	}
+
+	app.background(func() {
+		_, err := app.purgeExpiredData(false, user.ID)
+		if err != nil && !errors.Is(err, data.ErrPurgeRunning) {
+			app.logger.PrintError(err, map[string]string{"job": "purge expired data"})
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "the purge has been started"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -22,23 +22,104 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPatch, "/v1/tournaments/:id", app.requirePermission("admin", app.updateTournamentHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/tournaments/:id", app.requirePermission("admin", app.deleteTournamentHandler))
 
+	router.HandlerFunc(http.MethodGet, "/v1/tournaments/:id/calendar.ics", app.tournamentCalendarHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/tournaments/:id/events", app.tournamentEventsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/tournaments/:id/biometrics", app.requireActivatedUser(app.tournamentBiometricsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tournaments/:id/transitions", app.requirePermission("admin", app.transitionTournamentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tournaments/:id/prizes", app.showPrizesHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/tournaments/:id/prizes", app.requirePermission("admin", app.updatePrizesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tournaments/:id/participants", app.requireAuthenticatedUser(app.listParticipantHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tournaments/:id/participants", app.requirePermission("admin", app.createParticipantHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tournaments/:id/participants/:participant_id", app.requirePermission("admin", app.deleteParticipantHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tournaments/:id/seeding/preview", app.requirePermission("admin", app.previewSeedingHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tournaments/:id/seeding", app.requirePermission("admin", app.commitSeedingHandler))
+
 	router.HandlerFunc(http.MethodGet, "/v1/teams", app.requireAuthenticatedUser(app.listTeamHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/teams", app.requirePermission("admin", app.createTeamHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/teams/:id", app.showTeamHandler)
 	router.HandlerFunc(http.MethodPatch, "/v1/teams/:id", app.requirePermission("admin", app.updateTeamHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/teams/:id", app.requirePermission("admin", app.deleteTeamHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/teams/:id/members", app.requirePermission("admin", app.addTeamMemberHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/teams/:id/members/:user_id", app.requirePermission("admin", app.updateTeamMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/teams/:id/members/:user_id", app.requirePermission("admin", app.removeTeamMemberHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/teams/:id/h2h/:other_id", app.teamHeadToHeadHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/teams/:id/calendar.ics", app.teamCalendarHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/teams/:id/ratings", app.requireAuthenticatedUser(app.teamRatingsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/teams/:id/ratings/history", app.requireAuthenticatedUser(app.teamRatingHistoryHandler))
 
 	router.HandlerFunc(http.MethodGet, "/v1/games", app.requireAuthenticatedUser(app.listGameHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/games", app.requirePermission("admin", app.createGameHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/games/:id", app.showGameHandler)
 	router.HandlerFunc(http.MethodPatch, "/v1/games/:id", app.requirePermission("admin", app.updateGameHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/games/:id", app.requirePermission("admin", app.deleteGameHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/games/:id/schemas", app.requireAuthenticatedUser(app.listGameSchemaHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/games/:id/schemas", app.requirePermission("admin", app.createGameSchemaHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/games/:id/schemas/:version", app.requireAuthenticatedUser(app.showGameSchemaHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/games/:id/ratings", app.requireAuthenticatedUser(app.gameRatingsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/games/:id/ratings/recompute", app.requirePermission("admin", app.recomputeGameRatingsHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/matches", app.requirePermission("admin", app.createMatchHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/matches", app.requireActivatedUser(app.listMatchHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id", app.requireActivatedUser(app.showMatchHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/matches/:id", app.requirePermission("admin", app.updateMatchHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/matches/:id", app.requirePermission("admin", app.deleteMatchHandler))
-
-	router.HandlerFunc(http.MethodPost, "/v1/teams_players", app.requirePermission("admin", app.createTeamUsersHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/matches/:id/schedule", app.requirePermission("admin", app.scheduleMatchHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id/reports", app.requireActivatedUser(app.listReportHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/matches/:id/reports", app.requireActivatedUser(app.createReportHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/matches/:id/reports/:report_id/confirm", app.requireActivatedUser(app.confirmReportHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/matches/:id/reports/:report_id/dispute", app.requireActivatedUser(app.disputeReportHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id/audit", app.requireActivatedUser(app.listMatchAuditHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id/events", app.matchEventsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id/telemetry", app.authenticateQueryToken(app.requireActivatedUser(app.subscribeTelemetryHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id/alerts", app.requireActivatedUser(app.listMatchAlertsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id/biometrics", app.requireActivatedUser(app.matchBiometricsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/matches/:id/samples", app.requirePermission("sensor", app.uploadSamplesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id/telemetry/ingest", app.authenticateQueryToken(app.requirePermission("sensor", app.ingestTelemetryHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/matches/:id/veto", app.requireActivatedUser(app.showVetoHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/matches/:id/veto", app.requirePermission("admin", app.startVetoHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/matches/:id/veto", app.requirePermission("admin", app.cancelVetoHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/matches/:id/veto/actions", app.requireActivatedUser(app.vetoActionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/venues", app.requireActivatedUser(app.listVenuesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/venues", app.requirePermission("admin", app.createVenueHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/venues/:id", app.requireActivatedUser(app.showVenueHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/venues/:id", app.requirePermission("admin", app.updateVenueHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/venues/:id/stations", app.requireActivatedUser(app.listStationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/venues/:id/stations", app.requirePermission("admin", app.createStationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/venues/:id/environment", app.requireActivatedUser(app.venueEnvironmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/venues/:id/alerts", app.requireActivatedUser(app.venueAlertsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/stations/:id/readings", app.requirePermission("sensor", app.addReadingsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/devices", app.requireActivatedUser(app.listDevicesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/devices", app.requirePermission("admin", app.createDeviceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/devices/:id", app.requireActivatedUser(app.showDeviceHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/devices/:id", app.requirePermission("admin", app.updateDeviceHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/devices/:id/calibration", app.requirePermission("admin", app.calibrateDeviceHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/devices/:id/quarantine", app.requirePermission("admin", app.quarantineDeviceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/devices/:id/quarantine", app.requirePermission("admin", app.releaseDeviceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/devices/:id/usage", app.requireActivatedUser(app.deviceUsageHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/device_heartbeats", app.requirePermission("sensor", app.deviceHeartbeatHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/retention", app.requirePermission("admin", app.showRetentionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/seasons", app.requireAuthenticatedUser(app.listSeasonsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/seasons", app.requirePermission("admin", app.createSeasonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/seasons/:id", app.requireAuthenticatedUser(app.showSeasonHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/seasons/:id", app.requirePermission("admin", app.updateSeasonHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/seasons/:id", app.requirePermission("admin", app.deleteSeasonHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/leaderboards", app.requireAuthenticatedUser(app.leaderboardHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/retention/runs", app.requirePermission("admin", app.runRetentionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/disputes", app.requirePermission("referee", app.listDisputeHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/disputes/:id", app.requirePermission("referee", app.showDisputeHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/disputes/:id/evidence", app.requireActivatedUser(app.addEvidenceHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/disputes/:id/resolve", app.requirePermission("referee", app.resolveDisputeHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/schedule", app.requireAuthenticatedUser(app.listScheduleHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/transfers", app.requirePermission("admin", app.createTransferHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/teams_players/:id", app.requireActivatedUser(app.listTeamUsersHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/player_matches", app.requirePermission("admin", app.createUserMatchHandler))
@@ -46,8 +127,19 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/:id/calendar.ics", app.userCalendarHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/players/:id/analytics/stress", app.requireActivatedUser(app.playerStressHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/players/:id/matches/:match_id/telemetry", app.requireActivatedUser(app.playerTelemetryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/players/:id/consents", app.requireActivatedUser(app.showConsentsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/players/:id/consents", app.requireActivatedUser(app.updateConsentsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/players/:id/consents/history", app.requireActivatedUser(app.consentHistoryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/players/:id/career", app.requireAuthenticatedUser(app.playerCareerHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/players/:id/ratings", app.requireAuthenticatedUser(app.playerRatingsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/players/:id/ratings/history", app.requireAuthenticatedUser(app.playerRatingHistoryHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/calendar", app.requireActivatedUser(app.createCalendarTokenHandler))
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
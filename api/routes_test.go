@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRoutes builds the router, which panics on conflicting routes, and
+// checks that a route registered next to wildcard ones is reachable.
+func TestRoutes(t *testing.T) {
+	app := &application{}
+
+	routes := app.routes()
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/device_heartbeats", nil)
+
+	routes.ServeHTTP(rr, r)
+
+	if rr.Code == http.StatusNotFound {
+		t.Errorf("POST /v1/device_heartbeats: got %d", rr.Code)
+	}
+}
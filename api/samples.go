@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/telemetry"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+const (
+	// uploadBatchSize is how many samples are copied into the database at a
+	// time while an upload is being read.
+	uploadBatchSize = 5000
+
+	// maxReportedLines caps how many rejected lines are described in the
+	// response; the rest are only counted.
+	maxReportedLines = 100
+
+	maxSampleLine = 64 * 1024
+)
+
+// summarizeSamples recomputes the players' averages of a match from its sensor
+// samples once the match has a final result. Failures are only logged: the
+// result itself is already recorded and the averages can be recomputed.
+func (app *application) summarizeSamples(matchID int64) {
+	updated, err := app.models.Sample.Summarize(matchID)
+	app.stressReports.invalidateMatch(matchID)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"match_id": strconv.FormatInt(matchID, 10)})
+		return
+	}
+
+	if updated > 0 {
+		app.logger.PrintInfo("player averages computed from samples", map[string]string{
+			"match_id": strconv.FormatInt(matchID, 10),
+			"players":  strconv.FormatInt(updated, 10),
+		})
+	}
+}
+
+type lineError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+// sampleDecoder reads one sample at a time from an upload. A line that can't
+// be parsed is returned as field errors rather than an error, so that the
+// rest of the upload can still be read; the error is reserved for the body
+// itself failing, and is io.EOF at its end.
+type sampleDecoder interface {
+	Next() (sample data.SensorSample, line int, problems map[string]string, err error)
+}
+
+type ndjsonDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONDecoder(r io.Reader) *ndjsonDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxSampleLine)
+
+	return &ndjsonDecoder{scanner: scanner}
+}
+
+func (d *ndjsonDecoder) Next() (data.SensorSample, int, map[string]string, error) {
+	var sample data.SensorSample
+
+	for d.scanner.Scan() {
+		d.line++
+
+		text := d.scanner.Bytes()
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+
+		err := json.Unmarshal(text, &sample)
+		if err != nil {
+			return sample, d.line, map[string]string{"line": "contains badly-formed JSON"}, nil
+		}
+
+		return sample, d.line, nil, nil
+	}
+
+	err := d.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	} else if errors.Is(err, bufio.ErrTooLong) {
+		err = fmt.Errorf("line %d is longer than %d bytes", d.line+1, maxSampleLine)
+	}
+
+	return sample, d.line, nil, err
+}
+
+// csvDecoder reads CSV with a header row naming the columns, in any order,
+// after the JSON fields of a sample. Timestamps are RFC 3339. The device
+// column is optional.
+type csvDecoder struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+var sampleColumns = []string{"user_id", "at", "heart_rate", "stress", "humidity", "temperature", "pressure"}
+
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range sampleColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("header is missing the %q column", name)
+		}
+	}
+
+	reader.FieldsPerRecord = len(header)
+
+	return &csvDecoder{reader: reader, columns: columns}, nil
+}
+
+func (d *csvDecoder) Next() (data.SensorSample, int, map[string]string, error) {
+	var sample data.SensorSample
+
+	record, err := d.reader.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return sample, parseError.StartLine, map[string]string{"line": parseError.Err.Error()}, nil
+		}
+		return sample, 0, nil, err
+	}
+
+	line, _ := d.reader.FieldPos(0)
+
+	problems := make(map[string]string)
+
+	field := func(name string) string {
+		return strings.TrimSpace(record[d.columns[name]])
+	}
+
+	number := func(name string) float64 {
+		f, err := strconv.ParseFloat(field(name), 64)
+		if err != nil {
+			problems[name] = "must be a number"
+		}
+		return f
+	}
+
+	sample.UserID, err = strconv.ParseInt(field("user_id"), 10, 64)
+	if err != nil {
+		problems["user_id"] = "must be an integer"
+	}
+
+	sample.At, err = time.Parse(time.RFC3339Nano, field("at"))
+	if err != nil {
+		problems["at"] = "must be an RFC 3339 timestamp"
+	}
+
+	if _, ok := d.columns["device"]; ok {
+		sample.Device = field("device")
+	}
+
+	sample.HeartRate = number("heart_rate")
+	sample.Stress = number("stress")
+	sample.Humidity = number("humidity")
+	sample.Temperature = number("temperature")
+	sample.Pressure = number("pressure")
+
+	if len(problems) > 0 {
+		return sample, line, problems, nil
+	}
+
+	return sample, line, nil, nil
+}
+
+// uploadSamplesHandler bulk loads samples recorded offline, as NDJSON or CSV
+// and optionally gzipped. The body is decoded as it streams in and stored in
+// batches, so its size is only limited by configuration. Invalid lines are
+// skipped and reported back, and samples already stored for the same player
+// and timestamp are ignored, which makes re-uploading a file safe. That is
+// also how rigs should deal with files too large to send within the server's
+// read timeout: compress them or send them in parts.
+func (app *application) uploadSamplesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "text/csv":
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "application/x-ndjson", "text/csv")
+		return
+	}
+
+	players, err := app.models.Match.GetPlayerIDs(match.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	maxBytes := app.config.samples.maxUploadBytes
+
+	// The server's read and write timeouts are far too short for an upload
+	// of up to maxBytes, so this request gets deadlines of its own.
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(app.config.samples.uploadTimeout)
+
+	err = rc.SetReadDeadline(deadline)
+	if err == nil {
+		err = rc.SetWriteDeadline(deadline.Add(30 * time.Second))
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("body is not valid gzip"))
+			return
+		}
+		defer gz.Close()
+
+		body = gz
+	}
+
+	var dec sampleDecoder
+
+	if mediaType == "text/csv" {
+		dec, err = newCSVDecoder(body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	} else {
+		dec = newNDJSONDecoder(body)
+	}
+
+	var (
+		received, accepted, inserted, rejected int64
+		lineErrors                             = []lineError{}
+		batch                                  = make([]data.SensorSample, 0, uploadBatchSize)
+	)
+
+	flush := func() error {
+		n, err := app.models.Sample.Insert(match.ID, batch)
+		if err != nil {
+			return err
+		}
+
+		inserted += n
+		batch = batch[:0]
+		return nil
+	}
+
+	devices := app.newDeviceResolver()
+	now := time.Now()
+
+	for {
+		sample, line, problems, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			switch {
+			case err.Error() == "http: request body too large":
+				app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf(
+					"body must not be larger than %d bytes; %d samples before the limit were stored", maxBytes, inserted))
+			default:
+				app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf(
+					"%s; %d samples before this point were stored", err, inserted))
+			}
+			return
+		}
+
+		received++
+
+		if problems == nil {
+			v := validator.New()
+
+			err = devices.calibrateSample(v, &sample)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			data.ValidateUploadedSample(v, &sample, now)
+			if sample.UserID > 0 {
+				v.Check(players[sample.UserID], "user_id", "must be a player in this match")
+			}
+
+			problems = v.Errors
+		}
+
+		if len(problems) > 0 {
+			rejected++
+			if len(lineErrors) < maxReportedLines {
+				lineErrors = append(lineErrors, lineError{Line: line, Errors: problems})
+			}
+			continue
+		}
+
+		accepted++
+		batch = append(batch, sample)
+
+		if len(batch) == uploadBatchSize {
+			err = flush()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	err = flush()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Samples arriving after the result was recorded still count towards the
+	// players' averages.
+	if inserted > 0 && match.IsDecided() {
+		app.summarizeSamples(match.ID)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"received":   received,
+		"inserted":   inserted,
+		"duplicates": accepted - inserted,
+		"rejected":   rejected,
+		"errors":     lineErrors,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+const (
+	minResolution = time.Second
+	maxBuckets    = 10000
+	maxLTTBPoints = 5000
+)
+
+// playerTelemetryHandler returns a player's samples for a match at a lower
+// resolution for charting. By default samples are grouped into buckets of
+// ?resolution= with the ?agg= aggregates of each metric; ?downsample=lttb
+// instead picks up to ?points= of the actual samples per metric, keeping the
+// shape of the line.
+func (app *application) playerTelemetryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	matchID, err := app.readInt64Param(r, "match_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Resolution time.Duration
+		Aggregates []string
+		Metrics    []string
+		Downsample string
+		Points     int
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Resolution = app.readDuration(qs, "resolution", 10*time.Second, v)
+	input.Aggregates = app.readCSV(qs, "agg", []string{"avg"})
+	input.Metrics = app.readCSV(qs, "metrics", telemetry.Metrics)
+	input.Downsample = app.readString(qs, "downsample", "")
+	input.Points = app.readInt(qs, "points", 500, v)
+
+	v.Check(input.Resolution >= minResolution, "resolution", "must be at least 1s")
+	v.Check(input.Resolution <= 24*time.Hour, "resolution", "must not be more than 24h")
+	v.Check(validator.In(input.Downsample, "", "lttb"), "downsample", "must be lttb")
+	v.Check(input.Points >= 3, "points", "must be at least 3")
+	v.Check(input.Points <= maxLTTBPoints, "points", "must not be more than 5000")
+
+	telemetry.ValidateMetrics(v, input.Metrics)
+	if input.Downsample == "" {
+		telemetry.ValidateAggregates(v, input.Aggregates)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Match.Get(matchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	viewer, err := app.newBiometricViewer(app.contextGetUser(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	access, err := viewer.access(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Biometrics the player hasn't shared with the viewer are left out
+	// rather than failing the request, so the room's conditions still show.
+	metrics := []string{}
+	redacted := []string{}
+
+	for _, metric := range input.Metrics {
+		if validator.In(metric, data.BiometricData...) && !access[metric] {
+			redacted = append(redacted, metric)
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+
+	input.Metrics = metrics
+
+	samples, err := app.models.Sample.GetByPlayer(matchID, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	result := envelope{
+		"user_id":  userID,
+		"match_id": matchID,
+		"samples":  len(samples),
+	}
+
+	if len(redacted) > 0 {
+		result["redacted"] = redacted
+	}
+
+	if input.Downsample == "lttb" {
+		series := make(map[string][]telemetry.Point, len(input.Metrics))
+		for _, metric := range input.Metrics {
+			series[metric] = telemetry.LTTB(telemetry.Series(samples, metric), input.Points)
+		}
+
+		result["downsample"] = input.Downsample
+		result["series"] = series
+	} else {
+		if len(samples) > 0 {
+			span := samples[len(samples)-1].At.Sub(samples[0].At)
+			if span/input.Resolution >= maxBuckets {
+				v.AddError("resolution", "must be coarser for a match this long")
+				app.failedValidationResponse(w, r, v.Errors)
+				return
+			}
+		}
+
+		result["resolution"] = input.Resolution.String()
+		result["buckets"] = telemetry.Aggregate(samples, input.Resolution, input.Metrics, input.Aggregates)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"telemetry": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
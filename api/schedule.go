@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+func (app *application) listScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+
+	from := app.readTime(qs, "from", now, v)
+	to := app.readTime(qs, "to", from.Add(7*24*time.Hour), v)
+
+	v.Check(to.After(from), "to", "must be after from")
+	v.Check(to.Sub(from) <= 366*24*time.Hour, "to", "must be within a year of from")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	matches, err := app.models.Match.GetScheduled(from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"schedule": matches}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
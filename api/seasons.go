@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// checkSeasonGame makes sure a season's game exists. It writes the error
+// response itself and returns false if it doesn't.
+func (app *application) checkSeasonGame(w http.ResponseWriter, r *http.Request, season *data.Season, v *validator.Validator) bool {
+	if season.GameID == 0 {
+		return true
+	}
+
+	_, err := app.models.Game.Get(season.GameID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("game_id", "must refer to an existing game")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+func (app *application) createSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name      string `json:"name"`
+		GameID    int64  `json:"game_id"`
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	season := &data.Season{
+		Name:      input.Name,
+		GameID:    input.GameID,
+		StartDate: input.StartDate,
+		EndDate:   input.EndDate,
+	}
+
+	v := validator.New()
+
+	if data.ValidateSeason(v, season); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkSeasonGame(w, r, season, v) {
+		return
+	}
+
+	err = app.models.Season.Insert(season)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.invalidateLeaderboards()
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"season": season}, app.etagHeader(season.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSeasonsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	gameID := int64(app.readInt(r.URL.Query(), "game", 0, v))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	seasons, err := app.models.Season.GetAll(gameID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"seasons": seasons}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// seasonFromParam loads the season named by the :id parameter. It writes the
+// error response itself and returns nil if there is no such season.
+func (app *application) seasonFromParam(w http.ResponseWriter, r *http.Request) *data.Season {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	season, err := app.models.Season.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return season
+}
+
+func (app *application) showSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	season := app.seasonFromParam(w, r)
+	if season == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"season": season}, app.etagHeader(season.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	season := app.seasonFromParam(w, r)
+	if season == nil {
+		return
+	}
+
+	if !app.ifMatch(r, season.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name      *string `json:"name"`
+		GameID    *int64  `json:"game_id"`
+		StartDate *string `json:"start_date"`
+		EndDate   *string `json:"end_date"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		season.Name = *input.Name
+	}
+
+	if input.GameID != nil {
+		season.GameID = *input.GameID
+	}
+
+	if input.StartDate != nil {
+		season.StartDate = *input.StartDate
+	}
+
+	if input.EndDate != nil {
+		season.EndDate = *input.EndDate
+	}
+
+	v := validator.New()
+
+	if data.ValidateSeason(v, season); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkSeasonGame(w, r, season, v) {
+		return
+	}
+
+	err = app.models.Season.Update(season)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateLeaderboards()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"season": season}, app.etagHeader(season.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	season := app.seasonFromParam(w, r)
+	if season == nil {
+		return
+	}
+
+	if !app.ifMatch(r, season.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	err := app.models.Season.Delete(season.ID, app.ifMatchVersion(r, season.Version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateLeaderboards()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "season successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
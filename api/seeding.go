@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/seeding"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// seedTournament reads the seeding options from the request body and runs the
+// seeding engine over the tournament's participants. It writes the error
+// response itself and returns nil if anything goes wrong.
+func (app *application) seedTournament(w http.ResponseWriter, r *http.Request, tournamentID int64) *seeding.Result {
+	var input seeding.Options
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil
+	}
+
+	participants, err := app.models.Participant.GetAllByTournament(tournamentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+
+	v := validator.New()
+
+	if seeding.ValidateOptions(v, input, len(participants)); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+
+	var ratings map[int64]float64
+
+	if input.RatingSystem != "" {
+		ratings, err = app.models.Rating.GetForParticipants(tournamentID, input.RatingSystem)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil
+		}
+	}
+
+	entries := make([]seeding.Entry, len(participants))
+	for i, p := range participants {
+		rating := p.Rating
+		if ratings != nil {
+			rating = ratings[p.ID]
+		}
+
+		entries[i] = seeding.Entry{
+			ID:        p.ID,
+			Rating:    rating,
+			Placement: p.PreviousPlacement,
+			Region:    p.Region,
+			Group:     p.Group,
+		}
+	}
+
+	result, err := seeding.Compute(entries, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, seeding.ErrUnknownParticipant):
+			v.AddError("participant_id", "must belong to this tournament")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, seeding.ErrIncompleteOrder):
+			v.AddError("manual_order", err.Error())
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return result
+}
+
+func (app *application) previewSeedingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	result := app.seedTournament(w, r, id)
+	if result == nil {
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"seeding": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) commitSeedingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !tournament.IsEditable() {
+		app.tournamentStatusResponse(w, r, tournament.Status)
+		return
+	}
+
+	matches, err := app.models.Match.GetByTournamentID(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(matches) > 0 {
+		app.seedingLockedResponse(w, r)
+		return
+	}
+
+	result := app.seedTournament(w, r, id)
+	if result == nil {
+		return
+	}
+
+	seeds := make(map[int64]int, len(result.Seeds))
+	for _, s := range result.Seeds {
+		seeds[s.ParticipantID] = s.Seed
+	}
+
+	err = app.models.Participant.UpdateSeeds(id, seeds)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"seeding": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
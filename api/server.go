@@ -31,6 +31,12 @@ func (app *application) serve() error {
 			"signal": s.String(),
 		})
 
+		// Event streams never go idle on their own, so end them first or
+		// Shutdown would wait for them until it times out. WebSockets aren't
+		// tracked by Shutdown at all; their handlers hold app.wg instead.
+		app.events.Close()
+		app.telemetry.Close()
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
@@ -43,10 +49,14 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		close(app.done)
+
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
 
+	app.startJobs()
+
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.config.env,
@@ -4,15 +4,58 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/WrastAct/maestro/internal/analytics"
 	"github.com/WrastAct/maestro/internal/data"
 	"github.com/WrastAct/maestro/internal/validator"
 )
 
+// recentResultsLimit is how many of its latest results a team profile shows.
+const recentResultsLimit = 10
+
+// checkTeamGame makes sure a team's game exists and that none of its members
+// would then be in two teams of the game at once. Teams without a game count
+// as one game. It writes the error response itself and returns false
+// otherwise.
+func (app *application) checkTeamGame(w http.ResponseWriter, r *http.Request, team *data.Team, v *validator.Validator) bool {
+	if team.GameID != 0 {
+		_, err := app.models.Game.Get(team.GameID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("game_id", "must refer to an existing game")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return false
+		}
+	}
+
+	if team.ID == 0 {
+		return true
+	}
+
+	overlap, err := app.models.TeamUsers.OverlapsInGame(team.ID, team.GameID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if overlap {
+		v.AddError("game_id", "must not put members in two teams of the game at once")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
+
 func (app *application) createTeamHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
 		Region      string `json:"region"`
+		GameID      int64  `json:"game_id"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -25,6 +68,7 @@ func (app *application) createTeamHandler(w http.ResponseWriter, r *http.Request
 		Name:        input.Name,
 		Description: input.Description,
 		Region:      input.Region,
+		GameID:      input.GameID,
 	}
 
 	if err != nil {
@@ -38,6 +82,10 @@ func (app *application) createTeamHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !app.checkTeamGame(w, r, team, v) {
+		return
+	}
+
 	err = app.models.Team.Insert(team)
 	if err != nil {
 		switch {
@@ -47,7 +95,7 @@ func (app *application) createTeamHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"team": team}, nil)
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"team": team}, app.etagHeader(team.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -71,7 +119,103 @@ func (app *application) showTeamHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"team": team}, nil)
+	roster, err := app.models.Team.GetRoster(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tournaments, err := app.models.Team.GetTournaments(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	results, err := app.models.Team.GetResults(id, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	current := []*data.RosterEntry{}
+	for _, e := range roster {
+		if e.Current {
+			current = append(current, e)
+		}
+	}
+
+	recent := results
+	if len(recent) > recentResultsLimit {
+		recent = recent[:recentResultsLimit]
+	}
+
+	profile := envelope{
+		"team":            team,
+		"roster":          current,
+		"roster_timeline": data.RosterTimeline(roster),
+		"tournaments":     tournaments,
+		"recent_results":  recent,
+		"record":          analytics.Tally(results),
+		"games":           analytics.TeamGames(results, tournaments),
+	}
+
+	// The profile changes with rosters and results, not only with the team, so
+	// it carries no ETag; team.version is what updates are made against.
+	err = app.writeJSON(w, http.StatusOK, profile, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// teamHeadToHeadHandler returns the record of a team against another, and the
+// matches it is made of.
+func (app *application) teamHeadToHeadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	otherID, err := app.readInt64Param(r, "other_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if id == otherID {
+		app.badRequestResponse(w, r, errors.New("a team has no head-to-head record against itself"))
+		return
+	}
+
+	teams := make([]*data.Team, 2)
+
+	for i, teamID := range []int64{id, otherID} {
+		teams[i], err = app.models.Team.Get(teamID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	results, err := app.models.Team.GetResults(id, otherID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h2h := envelope{
+		"team":     teams[0],
+		"opponent": teams[1],
+		"record":   analytics.Tally(results),
+		"matches":  results,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"h2h": h2h}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -95,10 +239,16 @@ func (app *application) updateTeamHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !app.ifMatch(r, team.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var input struct {
 		Name        *string `json:"name"`
 		Description *string `json:"description"`
 		Region      *string `json:"region"`
+		GameID      *int64  `json:"game_id"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -119,6 +269,10 @@ func (app *application) updateTeamHandler(w http.ResponseWriter, r *http.Request
 		team.Region = *input.Region
 	}
 
+	if input.GameID != nil {
+		team.GameID = *input.GameID
+	}
+
 	v := validator.New()
 
 	if data.ValidateTeam(v, team); !v.Valid() {
@@ -126,13 +280,25 @@ func (app *application) updateTeamHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !app.checkTeamGame(w, r, team, v) {
+		return
+	}
+
 	err = app.models.Team.Update(team)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrMembershipOverlap):
+			v.AddError("game_id", "must not put members in two teams of the game at once")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"team": team}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"team": team}, app.etagHeader(team.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -145,7 +311,7 @@ func (app *application) deleteTeamHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Team.Delete(id)
+	team, err := app.models.Team.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -156,6 +322,24 @@ func (app *application) deleteTeamHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !app.ifMatch(r, team.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	err = app.models.Team.Delete(id, app.ifMatchVersion(r, team.Version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "team successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -163,7 +347,14 @@ func (app *application) deleteTeamHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) listTeamHandler(w http.ResponseWriter, r *http.Request) {
-	team, err := app.models.Team.GetAll()
+	var team []*data.Team
+	var err error
+
+	if region := app.readString(r.URL.Query(), "region", ""); region != "" {
+		team, err = app.models.Team.GetAllByRegion(region)
+	} else {
+		team, err = app.models.Team.GetAll()
+	}
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
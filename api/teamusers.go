@@ -1,18 +1,87 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
 )
 
-func (app *application) createTeamUsersHandler(w http.ResponseWriter, r *http.Request) {
+// teamForRosterChange loads the team named by the :id parameter and makes sure
+// its roster may change. It writes the error response itself and returns nil
+// otherwise.
+func (app *application) teamForRosterChange(w http.ResponseWriter, r *http.Request) *data.Team {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	team, err := app.models.Team.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if !app.checkRosterUnlocked(w, r, team.ID) {
+		return nil
+	}
+
+	return team
+}
+
+func (app *application) checkRosterUnlocked(w http.ResponseWriter, r *http.Request, teamID int64) bool {
+	locked, err := app.models.Participant.IsTeamLocked(teamID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if locked {
+		app.rosterLockedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// rosterChangeFailed writes the response for an error from a roster change.
+// The field names the input that refers to a user or team that doesn't exist.
+func (app *application) rosterChangeFailed(w http.ResponseWriter, r *http.Request, err error, v *validator.Validator, field string) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError(field, "must refer to an existing user and team")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrNotMember):
+		v.AddError(field, "must be a team the user is in on the day before the transfer")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrMembershipOverlap):
+		app.membershipOverlapResponse(w, r)
+	case errors.Is(err, data.ErrCaptainTaken):
+		app.captainTakenResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	team := app.teamForRosterChange(w, r)
+	if team == nil {
+		return
+	}
+
 	var input struct {
-		UserID    int64  `json:"user_id"`
-		TeamID    int64  `json:"team_id"`
-		JoinDate  string `json:"join_date"`
-		LeaveDate string `json:"leave_date"`
-		Role      string `json:"role"`
+		UserID    int64   `json:"user_id"`
+		JoinDate  string  `json:"join_date"`
+		LeaveDate *string `json:"leave_date"`
+		Role      string  `json:"role"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -21,29 +90,194 @@ func (app *application) createTeamUsersHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	teamUsers := &data.TeamUsers{
+	member := &data.TeamUsers{
 		UserID:    input.UserID,
-		TeamID:    input.TeamID,
+		TeamID:    team.ID,
 		JoinDate:  input.JoinDate,
 		LeaveDate: input.LeaveDate,
 		Role:      input.Role,
 	}
 
+	if member.JoinDate == "" {
+		member.JoinDate = time.Now().Format("2006-01-02")
+	}
+
+	if member.Role == "" {
+		member.Role = data.RolePlayer
+	}
+
+	v := validator.New()
+
+	if data.ValidateTeamUsers(v, member); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TeamUsers.Join(member)
+	if err != nil {
+		app.rosterChangeFailed(w, r, err, v, "user_id")
+		return
+	}
+
+	app.invalidateLeaderboards()
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"member": member}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	team := app.teamForRosterChange(w, r)
+	if team == nil {
 		return
 	}
 
-	err = app.models.TeamUsers.Insert(teamUsers)
+	userID, err := app.readInt64Param(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(validator.In(input.Role, data.Roles...), "role", "must be one of player, captain, substitute, coach, analyst or manager"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	member, err := app.models.TeamUsers.SetRole(team.ID, userID, input.Role)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrCaptainTaken):
+			app.captainTakenResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"team_players": teamUsers}, nil)
+	app.invalidateLeaderboards()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeTeamMemberHandler ends a membership. The optional date query parameter
+// is the member's last day with the team, and defaults to today.
+func (app *application) removeTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	team := app.teamForRosterChange(w, r)
+	if team == nil {
+		return
+	}
+
+	userID, err := app.readInt64Param(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	date := app.readString(r.URL.Query(), "date", time.Now().Format("2006-01-02"))
+
+	v := validator.New()
+
+	_, err = time.Parse("2006-01-02", date)
+	if v.Check(err == nil, "date", "must be a date like 2006-01-02"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	member, err := app.models.TeamUsers.Leave(team.ID, userID, date)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateLeaderboards()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTransferHandler moves a player between teams: they join the new team
+// on the transfer date, having left the old one the day before.
+func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID     int64  `json:"user_id"`
+		FromTeamID int64  `json:"from_team_id"`
+		ToTeamID   int64  `json:"to_team_id"`
+		Date       string `json:"date"`
+		Role       string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	to := &data.TeamUsers{
+		UserID:   input.UserID,
+		TeamID:   input.ToTeamID,
+		JoinDate: input.Date,
+		Role:     input.Role,
+	}
+
+	if to.JoinDate == "" {
+		to.JoinDate = time.Now().Format("2006-01-02")
+	}
+
+	if to.Role == "" {
+		to.Role = data.RolePlayer
+	}
+
+	v := validator.New()
+
+	v.Check(input.FromTeamID > 0, "from_team_id", "must be provided")
+	v.Check(input.ToTeamID > 0, "to_team_id", "must be provided")
+	v.Check(input.FromTeamID != input.ToTeamID, "to_team_id", "must not be the team transferred from")
+
+	if data.ValidateTeamUsers(v, to); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	for _, teamID := range []int64{input.FromTeamID, input.ToTeamID} {
+		if !app.checkRosterUnlocked(w, r, teamID) {
+			return
+		}
+	}
+
+	from, err := app.models.TeamUsers.Transfer(input.FromTeamID, to)
+	if err != nil {
+		app.rosterChangeFailed(w, r, err, v, "from_team_id")
+		return
+	}
+
+	app.invalidateLeaderboards()
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"transfer": envelope{"from": from, "to": to}}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+
+	// maxRateViolations is how many samples over its rate limit a sensor
+	// connection may send before it is closed.
+	maxRateViolations = 20
+
+	// Streamed samples are stored in batches of up to sampleBatchSize, and at
+	// least every sampleFlushInterval while samples keep coming.
+	sampleBatchSize     = 500
+	sampleFlushInterval = 2 * time.Second
+)
+
+func (app *application) upgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     app.checkOrigin,
+	}
+}
+
+// checkOrigin accepts sensor rigs, which send no Origin, and browsers on one
+// of the trusted CORS origins.
+func (app *application) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, trusted := range app.config.cors.trustedOrigins {
+		if origin == trusted {
+			return true
+		}
+	}
+	return false
+}
+
+func wsWrite(conn *websocket.Conn, v interface{}) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(v)
+}
+
+func wsClose(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+}
+
+// ingestTelemetryHandler accepts a WebSocket from a sensor station streaming
+// samples for the players of a live match, one JSON sample per message.
+// Samples naming the wearable that took them are calibrated for it. Invalid
+// samples are answered with an error message and otherwise ignored;
+// valid ones are fanned out to subscribers straight away and stored in
+// batches.
+func (app *application) ingestTelemetryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if match.Status != data.MatchLive {
+		app.matchNotLiveResponse(w, r)
+		return
+	}
+
+	players, err := app.models.Match.GetPlayerIDs(match.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	conn, err := app.upgrader().Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	app.wg.Add(1)
+	defer app.wg.Done()
+	defer conn.Close()
+
+	finished := make(chan struct{})
+	defer close(finished)
+
+	go func() {
+		select {
+		case <-app.telemetry.Done():
+			wsClose(conn, websocket.CloseGoingAway, "server shutting down")
+			conn.Close()
+		case <-finished:
+		}
+	}()
+
+	conn.SetReadLimit(4096)
+
+	limiter := rate.NewLimiter(rate.Limit(app.config.telemetry.rps), app.config.telemetry.burst)
+	violations := 0
+
+	devices := app.newDeviceResolver()
+
+	batch := make([]data.SensorSample, 0, sampleBatchSize)
+	flushed := time.Now()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		_, err := app.models.Sample.Insert(match.ID, batch)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"match_id": strconv.FormatInt(match.ID, 10)})
+		}
+
+		devices.touch()
+
+		batch = batch[:0]
+		flushed = time.Now()
+	}
+	defer flush()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if !limiter.Allow() {
+			violations++
+			if violations >= maxRateViolations {
+				wsClose(conn, websocket.ClosePolicyViolation, "rate limit exceeded")
+				return
+			}
+
+			err = wsWrite(conn, envelope{"error": "rate limit exceeded, sample dropped"})
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		var sample data.SensorSample
+
+		err = json.Unmarshal(msg, &sample)
+		if err != nil {
+			err = wsWrite(conn, envelope{"error": "body contains badly-formed JSON"})
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		now := time.Now()
+		if sample.At.IsZero() {
+			sample.At = now
+		}
+
+		v := validator.New()
+
+		err = devices.calibrateSample(v, &sample)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			wsClose(conn, websocket.CloseInternalServerErr, "the server encountered a problem")
+			return
+		}
+
+		data.ValidateSensorSample(v, &sample, now)
+		v.Check(players[sample.UserID], "user_id", "must be a player in this match")
+
+		if !v.Valid() {
+			err = wsWrite(conn, envelope{"error": v.Errors})
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		app.telemetry.Publish(match.ID, sample)
+
+		if anomaly := app.detector.Observe(match.ID, sample); anomaly != nil {
+			app.raiseStressAlert(match, anomaly)
+		}
+
+		batch = append(batch, sample)
+		if len(batch) >= sampleBatchSize || time.Since(flushed) >= sampleFlushInterval {
+			flush()
+		}
+	}
+}
+
+// subscribeTelemetryHandler streams the live samples of a match, or of one
+// player with ?user_id=, over a WebSocket, without the biometrics each player
+// hasn't shared with the subscriber. Slow clients miss samples rather than
+// falling behind and are told how many with a "dropped" message.
+func (app *application) subscribeTelemetryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	userID := app.readInt(r.URL.Query(), "user_id", 0, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	viewer, err := app.newBiometricViewer(app.contextGetUser(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sub, err := app.telemetry.Subscribe(id, int64(userID))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "the server is shutting down")
+		return
+	}
+	defer app.telemetry.Unsubscribe(sub)
+
+	conn, err := app.upgrader().Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	app.wg.Add(1)
+	defer app.wg.Done()
+	defer conn.Close()
+
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	// Subscribers have nothing to say, but reading is what processes pongs
+	// and notices the client going away.
+	gone := make(chan struct{})
+
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case sample, ok := <-sub.C:
+			if !ok {
+				wsClose(conn, websocket.CloseGoingAway, "server shutting down")
+				return
+			}
+
+			if n := app.telemetry.Dropped(sub); n > 0 {
+				err = wsWrite(conn, envelope{"type": "dropped", "count": n})
+				if err != nil {
+					return
+				}
+			}
+
+			access, err := viewer.access(sample.UserID)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				wsClose(conn, websocket.CloseInternalServerErr, "the server encountered a problem")
+				return
+			}
+
+			err = wsWrite(conn, envelope{"type": "sample", "match_id": id, "sample": sampleView(sample, access)})
+			if err != nil {
+				return
+			}
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
@@ -49,7 +49,7 @@ func (app *application) createTournamentHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"tournament": tournament}, nil)
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"tournament": tournament}, app.etagHeader(tournament.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -73,7 +73,7 @@ func (app *application) showTournamentHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"tournament": tournament}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"tournament": tournament}, app.etagHeader(tournament.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -97,6 +97,11 @@ func (app *application) updateTournamentHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if !app.ifMatch(r, tournament.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var input struct {
 		Name      *string `json:"name"`
 		GameID    *int64  `json:"game_id"`
@@ -110,6 +115,14 @@ func (app *application) updateTournamentHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	v := validator.New()
+
+	if !tournament.IsEditable() {
+		v.Check(input.GameID == nil, "game_id", "can not be changed once the tournament is live")
+		v.Check(input.StartDate == nil, "start_date", "can not be changed once the tournament is live")
+		v.Check(input.EndDate == nil, "end_date", "can not be changed once the tournament is live")
+	}
+
 	if input.Name != nil {
 		tournament.Name = *input.Name
 	}
@@ -126,8 +139,6 @@ func (app *application) updateTournamentHandler(w http.ResponseWriter, r *http.R
 		tournament.EndDate = *input.EndDate
 	}
 
-	v := validator.New()
-
 	if data.ValidateTournament(v, tournament); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -135,11 +146,16 @@ func (app *application) updateTournamentHandler(w http.ResponseWriter, r *http.R
 
 	err = app.models.Tournament.Update(tournament)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"tournament": tournament}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"tournament": tournament}, app.etagHeader(tournament.Version))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -152,7 +168,7 @@ func (app *application) deleteTournamentHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.models.Tournament.Delete(id)
+	tournament, err := app.models.Tournament.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -163,6 +179,29 @@ func (app *application) deleteTournamentHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if !app.ifMatch(r, tournament.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	if tournament.Status == data.TournamentLive {
+		app.tournamentStatusResponse(w, r, tournament.Status)
+		return
+	}
+
+	err = app.models.Tournament.Delete(id, app.ifMatchVersion(r, tournament.Version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tournament successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -181,3 +220,176 @@ func (app *application) listTournamentHandler(w http.ResponseWriter, r *http.Req
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) transitionTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTournamentStatus(v, input.Status); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	previousStatus := tournament.Status
+	user := app.contextGetUser(r)
+
+	err = app.models.Tournament.Transition(tournament, input.Status, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTransition):
+			app.invalidTransitionResponse(w, r, previousStatus, input.Status)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publish("tournament.status", envelope{"tournament": tournament}, 0, tournament.ID)
+
+	if previousStatus == data.TournamentCompleted || tournament.Status == data.TournamentCompleted {
+		app.invalidateLeaderboards()
+	}
+
+	app.background(func() {
+		emails, err := app.models.Participant.GetEmailsByTournament(tournament.ID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		data := map[string]interface{}{
+			"tournamentID":   tournament.ID,
+			"tournamentName": tournament.Name,
+			"previousStatus": previousStatus,
+			"status":         tournament.Status,
+		}
+
+		for _, email := range emails {
+			err = app.mailer.Send(email, "tournament_status_en.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tournament": tournament}, app.etagHeader(tournament.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showPrizesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	prizes, err := app.models.Tournament.GetPrizes(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"prizes": prizes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updatePrizesHandler replaces the prize pool of a tournament.
+func (app *application) updatePrizesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Prizes []data.Prize `json:"prizes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidatePrizes(v, input.Prizes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tournament.SetPrizes(tournament.ID, input.Prizes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if tournament.Status == data.TournamentCompleted || tournament.Status == data.TournamentArchived {
+		app.invalidateLeaderboards()
+	}
+
+	prizes, err := app.models.Tournament.GetPrizes(tournament.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"prizes": prizes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,21 +1,28 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/WrastAct/maestro/internal/analytics"
 	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
 )
 
 func (app *application) createUserMatchHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		UserID        int64   `json:"user_id"`
-		MatchID       int64   `json:"match_id"`
-		TournamentID  int64   `json:"tournament_id"`
-		Result        string  `json:"result"`
-		AverageStress float64 `json:"avg_stress"`
-		Humidity      float64 `json:"humidity"`
-		Temperature   float64 `json:"temperature"`
-		Pressure      float64 `json:"pressure"`
+		UserID        int64           `json:"user_id"`
+		MatchID       int64           `json:"match_id"`
+		TournamentID  int64           `json:"tournament_id"`
+		Result        string          `json:"result"`
+		AverageStress float64         `json:"avg_stress"`
+		Humidity      float64         `json:"humidity"`
+		Temperature   float64         `json:"temperature"`
+		Pressure      float64         `json:"pressure"`
+		Extras        json.RawMessage `json:"extras"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -29,14 +36,52 @@ func (app *application) createUserMatchHandler(w http.ResponseWriter, r *http.Re
 		MatchID:       input.MatchID,
 		TournamentID:  input.TournamentID,
 		Result:        input.Result,
-		AverageStress: input.AverageStress,
+		AverageStress: &input.AverageStress,
 		Humidity:      input.Humidity,
 		Temperature:   input.Temperature,
 		Pressure:      input.Pressure,
+		Extras:        input.Extras,
 	}
 
+	if len(userMatch.Extras) == 0 {
+		userMatch.Extras = json.RawMessage("{}")
+	}
+
+	v := validator.New()
+
+	match, err := app.models.Match.Get(userMatch.MatchID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("match_id", "must refer to an existing match")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if v.Check(match.TournamentID == userMatch.TournamentID, "tournament_id", "must be the tournament of the match"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Player records are checked against the schema their match was recorded
+	// under, like the match's own results.
+	var schema *data.GameSchema
+
+	if match.SchemaVersion > 0 {
+		schema, err = app.gameSchemaFor(match.TournamentID, match.SchemaVersion)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		userMatch.SchemaVersion = match.SchemaVersion
+	}
+
+	if data.ValidateUserMatch(v, userMatch, schema); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
@@ -49,6 +94,14 @@ func (app *application) createUserMatchHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// Event streams are open to anyone, so biometrics stay off them.
+	app.stressReports.invalidatePlayer(userMatch.UserID)
+
+	public := *userMatch
+	public.Redact(data.BiometricAccess{})
+
+	app.publish("player_match.recorded", envelope{"player_match": &public}, userMatch.MatchID, userMatch.TournamentID)
+
 	err = app.writeJSON(w, http.StatusAccepted, envelope{"player_match": userMatch}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -68,8 +121,154 @@ func (app *application) listUserMatchHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	viewer, err := app.newBiometricViewer(app.contextGetUser(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	access, err := viewer.access(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, um := range userMatch {
+		um.Redact(access)
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"player_match": userMatch}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// analyticsMaxAge is how long clients may reuse a player's analytics before
+// revalidating them.
+const analyticsMaxAge = 5 * time.Minute
+
+func (app *application) playerStressHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	viewer, err := app.newBiometricViewer(app.contextGetUser(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	access, err := viewer.access(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !access[data.BiometricStress] {
+		app.biometricAccessDeniedResponse(w, r)
+		return
+	}
+
+	report, err := app.stressReport(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeCachedJSON(w, r, envelope{"user_id": id, "stress": report}, analyticsMaxAge)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// stressReportTTL bounds how long a cached report may miss a change that
+// doesn't invalidate it, such as a tournament or game being renamed.
+const stressReportTTL = 30 * time.Minute
+
+type cachedStressReport struct {
+	report  *analytics.StressReport
+	matches map[int64]bool
+	loaded  time.Time
+}
+
+// stressReportCache keeps each player's stress report until the records it
+// was built from change: samples being summarized again after an upload or
+// a quarantine, a match result being edited, or a new record.
+type stressReportCache struct {
+	mu      sync.Mutex
+	players map[int64]cachedStressReport
+}
+
+func (c *stressReportCache) get(userID int64) (*analytics.StressReport, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.players[userID]
+	if !ok || time.Since(cached.loaded) >= stressReportTTL {
+		return nil, false
+	}
+	return cached.report, true
+}
+
+func (c *stressReportCache) put(userID int64, report *analytics.StressReport, played []*data.PlayedMatch) {
+	matches := make(map[int64]bool, len(played))
+	for _, match := range played {
+		matches[match.MatchID] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.players == nil {
+		c.players = make(map[int64]cachedStressReport)
+	}
+	c.players[userID] = cachedStressReport{report: report, matches: matches, loaded: time.Now()}
+}
+
+func (c *stressReportCache) invalidatePlayer(userID int64) {
+	c.mu.Lock()
+	delete(c.players, userID)
+	c.mu.Unlock()
+}
+
+// invalidateMatch drops the reports of every player with a record of the
+// match.
+func (c *stressReportCache) invalidateMatch(matchID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for userID, cached := range c.players {
+		if cached.matches[matchID] {
+			delete(c.players, userID)
+		}
+	}
+}
+
+func (app *application) stressReport(userID int64) (*analytics.StressReport, error) {
+	if report, ok := app.stressReports.get(userID); ok {
+		return report, nil
+	}
+
+	played, err := app.models.UserMatch.GetPlayedByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := analytics.Stress(played)
+	app.stressReports.put(userID, report, played)
+
+	return report, nil
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+const maxEnvironmentBuckets = 10000
+
+func (app *application) createVenueHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name       string          `json:"name"`
+		Address    string          `json:"address"`
+		TimeZone   string          `json:"time_zone"`
+		Thresholds data.Thresholds `json:"thresholds"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	venue := &data.Venue{
+		Name:       input.Name,
+		Address:    input.Address,
+		TimeZone:   input.TimeZone,
+		Thresholds: input.Thresholds,
+	}
+
+	if venue.TimeZone == "" {
+		venue.TimeZone = "UTC"
+	}
+
+	v := validator.New()
+
+	if data.ValidateVenue(v, venue); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Venue.Insert(venue)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateVenue):
+			v.AddError("name", "a venue with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"venue": venue}, app.etagHeader(venue.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listVenuesHandler(w http.ResponseWriter, r *http.Request) {
+	venues, err := app.models.Venue.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"venues": venues}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// venueFromParam loads the venue named by the :id parameter. It writes the
+// error response itself and returns nil if there is no such venue.
+func (app *application) venueFromParam(w http.ResponseWriter, r *http.Request) *data.Venue {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	venue, err := app.models.Venue.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return venue
+}
+
+func (app *application) showVenueHandler(w http.ResponseWriter, r *http.Request) {
+	venue := app.venueFromParam(w, r)
+	if venue == nil {
+		return
+	}
+
+	stations, err := app.models.Station.GetAllByVenue(venue.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"venue": venue, "stations": stations}, app.etagHeader(venue.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateVenueHandler(w http.ResponseWriter, r *http.Request) {
+	venue := app.venueFromParam(w, r)
+	if venue == nil {
+		return
+	}
+
+	if !app.ifMatch(r, venue.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name       *string          `json:"name"`
+		Address    *string          `json:"address"`
+		TimeZone   *string          `json:"time_zone"`
+		Thresholds *data.Thresholds `json:"thresholds"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		venue.Name = *input.Name
+	}
+
+	if input.Address != nil {
+		venue.Address = *input.Address
+	}
+
+	if input.TimeZone != nil {
+		venue.TimeZone = *input.TimeZone
+	}
+
+	// Thresholds are replaced as a whole, so that a limit can be removed by
+	// leaving it out.
+	if input.Thresholds != nil {
+		venue.Thresholds = *input.Thresholds
+	}
+
+	v := validator.New()
+
+	if data.ValidateVenue(v, venue); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Venue.Update(venue)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateVenue):
+			v.AddError("name", "a venue with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"venue": venue}, app.etagHeader(venue.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createStationHandler(w http.ResponseWriter, r *http.Request) {
+	venue := app.venueFromParam(w, r)
+	if venue == nil {
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	station := &data.Station{
+		VenueID: venue.ID,
+		Name:    input.Name,
+	}
+
+	v := validator.New()
+
+	if data.ValidateStation(v, station); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Station.Insert(station)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateStation):
+			v.AddError("name", "the venue already has a station with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"station": station}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listStationsHandler(w http.ResponseWriter, r *http.Request) {
+	venue := app.venueFromParam(w, r)
+	if venue == nil {
+		return
+	}
+
+	stations, err := app.models.Station.GetAllByVenue(venue.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stations": stations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addReadingsHandler stores environment readings sent by a station, calibrated
+// for the device that took them if it says which, and alerts the matches
+// being played there when the room leaves the venue's limits or returns
+// within them.
+func (app *application) addReadingsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	station, err := app.models.Station.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Device   string         `json:"device"`
+		Readings []data.Reading `json:"readings"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Readings) > 0, "readings", "must contain at least one reading")
+
+	var device *data.Device
+
+	if input.Device != "" {
+		device, err = app.models.Device.GetBySerial(input.Device)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		checkDevice(v, device, data.DeviceEnvironment)
+		if device != nil && device.StationID > 0 {
+			v.Check(device.StationID == station.ID, "device", "is assigned to another station")
+		}
+	}
+
+	var deviceID int64
+
+	if device != nil && v.Valid() {
+		deviceID = device.ID
+		for i := range input.Readings {
+			device.CalibrateReading(&input.Readings[i])
+		}
+	}
+
+	now := time.Now()
+	for i := range input.Readings {
+		rv := validator.New()
+		if data.ValidateReading(rv, &input.Readings[i], now); !rv.Valid() {
+			for key, message := range rv.Errors {
+				v.AddError("readings", key+" "+message)
+			}
+			break
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	venue, err := app.models.Venue.Get(station.VenueID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	raised, resolved, err := app.models.Station.AddReadings(station, deviceID, venue.Thresholds, input.Readings)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if deviceID > 0 {
+		err = app.models.Device.Touch([]int64{deviceID}, now)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	}
+
+	if len(raised) > 0 || len(resolved) > 0 {
+		matches, err := app.models.Match.GetLiveAtStation(station.ID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+
+		for _, match := range matches {
+			for _, alert := range raised {
+				app.publish("station.alert", envelope{"alert": alert}, match.ID, match.TournamentID)
+			}
+			for _, alert := range resolved {
+				app.publish("station.alert_resolved", envelope{"alert": alert}, match.ID, match.TournamentID)
+			}
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"readings": len(input.Readings), "alerts": raised}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) venueEnvironmentHandler(w http.ResponseWriter, r *http.Request) {
+	venue := app.venueFromParam(w, r)
+	if venue == nil {
+		return
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+	now := time.Now()
+
+	to := app.readTime(qs, "to", now, v)
+	from := app.readTime(qs, "from", to.Add(-24*time.Hour), v)
+	resolution := app.readDuration(qs, "resolution", 5*time.Minute, v)
+
+	v.Check(from.Before(to), "from", "must be before to")
+	v.Check(resolution >= time.Second, "resolution", "must be at least 1s")
+	v.Check(resolution < 0 || to.Sub(from)/maxEnvironmentBuckets <= resolution, "resolution", "must be coarser for a period this long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	buckets, err := app.models.Station.GetEnvironment(venue.ID, from, to, resolution)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"venue_id":    venue.ID,
+		"from":        from,
+		"to":          to,
+		"resolution":  resolution.String(),
+		"environment": buckets,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) venueAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	venue := app.venueFromParam(w, r)
+	if venue == nil {
+		return
+	}
+
+	openOnly := app.readString(r.URL.Query(), "open", "") == "true"
+
+	alerts, err := app.models.Station.GetAlertsByVenue(venue.ID, openOnly)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"alerts": alerts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+func (app *application) startVetoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	match, err := app.models.Match.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if match.IsDecided() {
+		app.matchDecidedResponse(w, r)
+		return
+	}
+
+	tournament, err := app.models.Tournament.Get(match.TournamentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	game, err := app.models.Game.Get(tournament.GameID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Sequence    []data.VetoStep `json:"sequence"`
+		MapPool     []string        `json:"map_pool"`
+		TurnSeconds int             `json:"turn_seconds"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Anything not given for this match comes from the game's defaults.
+	veto := &data.Veto{
+		MatchID:           match.ID,
+		TournamentID:      match.TournamentID,
+		HomeParticipantID: match.HomeParticipantID,
+		AwayParticipantID: match.AwayParticipantID,
+		Sequence:          input.Sequence,
+		MapPool:           input.MapPool,
+		TurnSeconds:       input.TurnSeconds,
+	}
+
+	if veto.Sequence == nil {
+		veto.Sequence = game.VetoSequence
+	}
+
+	if veto.MapPool == nil {
+		veto.MapPool = game.MapPool
+	}
+
+	if veto.TurnSeconds == 0 {
+		veto.TurnSeconds = 60
+	}
+
+	v := validator.New()
+
+	v.Check(match.HomeParticipantID > 0 && match.AwayParticipantID > 0, "match", "must have both participants set")
+
+	if data.ValidateVeto(v, veto); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Veto.Insert(veto)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrVetoExists):
+			app.vetoExistsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publishVeto(veto)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"veto": veto}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showVetoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	veto, err := app.models.Veto.GetByMatch(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"veto": veto}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// vetoActionHandler plays the current turn for the side the user captains.
+func (app *application) vetoActionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	veto, err := app.models.Veto.GetByMatch(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	sides, err := app.models.Participant.CaptainedBy(app.contextGetUser(r).ID, veto.HomeParticipantID, veto.AwayParticipantID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(sides) == 0 {
+		app.notCaptainResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Map string `json:"map"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Someone captaining both sides plays whichever side is up next.
+	participantID := sides[0]
+	if len(sides) > 1 && veto.Next != nil {
+		participantID = veto.HomeParticipantID
+		if veto.Next.Side == data.SideAway {
+			participantID = veto.AwayParticipantID
+		}
+	}
+
+	veto, err = app.models.Veto.Act(veto.ID, participantID, input.Map)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrVetoClosed):
+			app.vetoClosedResponse(w, r)
+		case errors.Is(err, data.ErrNotYourTurn):
+			app.notYourTurnResponse(w, r)
+		case errors.Is(err, data.ErrMapTaken):
+			v := validator.New()
+			v.AddError("map", "must be one of the maps left in the pool")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publishVeto(veto)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"veto": veto}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelVetoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Veto.Cancel(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrVetoClosed):
+			app.vetoClosedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	veto, err := app.models.Veto.GetByMatch(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.publishVeto(veto)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "veto successfully cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
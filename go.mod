@@ -1,14 +1,19 @@
 module github.com/WrastAct/maestro
 
-go 1.19
+go 1.20
 
-require github.com/julienschmidt/httprouter v1.3.0
+require (
+	github.com/go-mail/mail/v2 v2.3.0
+	github.com/gorilla/websocket v1.5.0
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/lib/pq v1.10.2
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce
+	golang.org/x/crypto v0.1.0
+	golang.org/x/time v0.1.0
+)
 
 require (
-	github.com/go-mail/mail/v2 v2.3.0 // indirect
-	github.com/lib/pq v1.10.2 // indirect
-	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce // indirect
-	golang.org/x/crypto v0.1.0 // indirect
-	golang.org/x/time v0.1.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
+	gopkg.in/mail.v2 v2.3.1 // indirect
 )
@@ -0,0 +1,130 @@
+package analytics
+
+import (
+	"sort"
+
+	"github.com/WrastAct/maestro/internal/data"
+)
+
+// Record counts wins, losses and draws. The win rate is over matches with a
+// known outcome, and is omitted if there are none.
+type Record struct {
+	Matches int      `json:"matches"`
+	Wins    int      `json:"wins"`
+	Losses  int      `json:"losses"`
+	Draws   int      `json:"draws"`
+	WinRate *float64 `json:"win_rate"`
+}
+
+func (r *Record) add(outcome string) {
+	r.Matches++
+
+	switch Outcome(outcome) {
+	case OutcomeWin:
+		r.Wins++
+	case OutcomeLoss:
+		r.Losses++
+	case OutcomeDraw:
+		r.Draws++
+	}
+
+	if decided := r.Wins + r.Losses + r.Draws; decided > 0 {
+		rate := float64(r.Wins) / float64(decided)
+		r.WinRate = &rate
+	}
+}
+
+// GameRecord sums up a player or team's matches and tournaments in one game.
+type GameRecord struct {
+	GameID   int64  `json:"game_id"`
+	GameName string `json:"game_name"`
+	Record
+	Tournaments   int     `json:"tournaments"`
+	BestPlacement *int    `json:"best_placement"`
+	PrizeMoney    float64 `json:"prize_money"`
+}
+
+type gameRecords map[int64]*GameRecord
+
+func (g gameRecords) get(id int64, name string) *GameRecord {
+	r, ok := g[id]
+	if !ok {
+		r = &GameRecord{GameID: id, GameName: name}
+		g[id] = r
+	}
+	return r
+}
+
+func (g gameRecords) addTournaments(tournaments []*data.CareerTournament) {
+	for _, t := range tournaments {
+		r := g.get(t.GameID, t.GameName)
+		r.Tournaments++
+		r.PrizeMoney += t.PrizeMoney
+
+		if t.Placement != nil && (r.BestPlacement == nil || *t.Placement < *r.BestPlacement) {
+			placement := *t.Placement
+			r.BestPlacement = &placement
+		}
+	}
+}
+
+func (g gameRecords) list() []*GameRecord {
+	records := make([]*GameRecord, 0, len(g))
+	for _, r := range g {
+		records = append(records, r)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].GameID < records[j].GameID })
+
+	return records
+}
+
+// Games sums up a player's career per game, ordered by game.
+func Games(matches []*data.PlayedMatch, tournaments []*data.CareerTournament) []*GameRecord {
+	records := make(gameRecords)
+
+	for _, m := range matches {
+		records.get(m.GameID, m.GameName).add(m.Outcome)
+	}
+
+	records.addTournaments(tournaments)
+
+	return records.list()
+}
+
+// TeamGames sums up a team's results and tournaments per game, ordered by
+// game.
+func TeamGames(results []*data.TeamResult, tournaments []*data.CareerTournament) []*GameRecord {
+	records := make(gameRecords)
+
+	for _, res := range results {
+		records.get(res.GameID, res.GameName).add(res.Outcome)
+	}
+
+	records.addTournaments(tournaments)
+
+	return records.list()
+}
+
+// Tally sums up a team's results.
+func Tally(results []*data.TeamResult) Record {
+	var record Record
+
+	for _, res := range results {
+		record.add(res.Outcome)
+	}
+
+	return record
+}
+
+// StressTrend summarises a player's stress month by month, for matches in the
+// order they were played.
+func StressTrend(matches []*data.PlayedMatch) []PeriodSummary {
+	trend := []PeriodSummary{}
+
+	for _, group := range groupBy(matches, func(m *data.PlayedMatch) string { return m.PlayedAt.UTC().Format("2006-01") }) {
+		trend = append(trend, PeriodSummary{Period: group.key, Summary: summarize(stressOf(group.matches))})
+	}
+
+	return trend
+}
@@ -0,0 +1,240 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/WrastAct/maestro/internal/data"
+)
+
+const (
+	OutcomeWin     = "win"
+	OutcomeLoss    = "loss"
+	OutcomeDraw    = "draw"
+	OutcomeUnknown = "unknown"
+)
+
+// Summary describes the distribution of a set of stress values.
+type Summary struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"std_dev"`
+	Min    float64 `json:"min"`
+	P25    float64 `json:"p25"`
+	Median float64 `json:"median"`
+	P75    float64 `json:"p75"`
+	Max    float64 `json:"max"`
+}
+
+type PeriodSummary struct {
+	Period string `json:"period"`
+	Summary
+}
+
+type StageSummary struct {
+	Stage string `json:"stage"`
+	Summary
+}
+
+type TournamentSummary struct {
+	TournamentID   int64  `json:"tournament_id"`
+	TournamentName string `json:"tournament_name"`
+	Summary
+}
+
+// Correlation is the Pearson correlation of stress with a condition. The
+// coefficient is omitted when there are too few matches, or the values never
+// vary, for it to mean anything.
+type Correlation struct {
+	Coefficient *float64 `json:"coefficient"`
+	Matches     int      `json:"matches"`
+}
+
+type StressReport struct {
+	Overall      Summary                 `json:"overall"`
+	ByMonth      []PeriodSummary         `json:"by_month"`
+	ByOutcome    map[string]Summary      `json:"by_outcome"`
+	ByStage      []StageSummary          `json:"by_stage"`
+	ByTournament []TournamentSummary     `json:"by_tournament"`
+	Correlations map[string]*Correlation `json:"correlations"`
+}
+
+// minCorrelationMatches is the fewest matches a correlation is computed for.
+const minCorrelationMatches = 3
+
+// Stress analyses a player's stress over their matches, which must be in the
+// order they were played.
+func Stress(matches []*data.PlayedMatch) *StressReport {
+	report := &StressReport{
+		Overall:      summarize(stressOf(matches)),
+		ByMonth:      StressTrend(matches),
+		ByOutcome:    make(map[string]Summary),
+		ByStage:      []StageSummary{},
+		ByTournament: []TournamentSummary{},
+		Correlations: make(map[string]*Correlation),
+	}
+
+	for _, group := range groupBy(matches, func(m *data.PlayedMatch) string { return Outcome(m.Outcome) }) {
+		report.ByOutcome[group.key] = summarize(stressOf(group.matches))
+	}
+
+	for _, group := range groupBy(matches, func(m *data.PlayedMatch) string { return m.Stage }) {
+		report.ByStage = append(report.ByStage, StageSummary{Stage: group.key, Summary: summarize(stressOf(group.matches))})
+	}
+
+	for _, group := range groupBy(matches, func(m *data.PlayedMatch) string { return strconv.FormatInt(m.TournamentID, 10) }) {
+		report.ByTournament = append(report.ByTournament, TournamentSummary{
+			TournamentID:   group.matches[0].TournamentID,
+			TournamentName: group.matches[0].TournamentName,
+			Summary:        summarize(stressOf(group.matches)),
+		})
+	}
+
+	conditions := map[string]func(*data.PlayedMatch) float64{
+		"humidity":    func(m *data.PlayedMatch) float64 { return m.Humidity },
+		"temperature": func(m *data.PlayedMatch) float64 { return m.Temperature },
+		"pressure":    func(m *data.PlayedMatch) float64 { return m.Pressure },
+	}
+
+	for name, fn := range conditions {
+		var stress, values []float64
+		for _, m := range matches {
+			if m.Stress != nil {
+				stress = append(stress, *m.Stress)
+				values = append(values, fn(m))
+			}
+		}
+
+		report.Correlations[name] = &Correlation{
+			Coefficient: pearson(stress, values),
+			Matches:     len(stress),
+		}
+	}
+
+	return report
+}
+
+// Outcome normalises a recorded result to win, loss, draw or unknown, so that
+// records typed in by hand as "W", "won" or "Victory" count alike.
+func Outcome(result string) string {
+	switch strings.ToLower(strings.TrimSpace(result)) {
+	case "win", "won", "w", "victory":
+		return OutcomeWin
+	case "loss", "lost", "lose", "l", "defeat":
+		return OutcomeLoss
+	case "draw", "tie", "tied", "d":
+		return OutcomeDraw
+	default:
+		return OutcomeUnknown
+	}
+}
+
+type group struct {
+	key     string
+	matches []*data.PlayedMatch
+}
+
+// groupBy groups matches by key, keeping the groups in order of first
+// appearance.
+func groupBy(matches []*data.PlayedMatch, key func(*data.PlayedMatch) string) []*group {
+	groups := []*group{}
+	index := make(map[string]*group)
+
+	for _, m := range matches {
+		k := key(m)
+
+		g, ok := index[k]
+		if !ok {
+			g = &group{key: k}
+			index[k] = g
+			groups = append(groups, g)
+		}
+
+		g.matches = append(g.matches, m)
+	}
+
+	return groups
+}
+
+// stressOf returns the stress of the matches that have any; records whose
+// samples were all quarantined have none.
+func stressOf(matches []*data.PlayedMatch) []float64 {
+	values := make([]float64, 0, len(matches))
+	for _, m := range matches {
+		if m.Stress != nil {
+			values = append(values, *m.Stress)
+		}
+	}
+	return values
+}
+
+func summarize(values []float64) Summary {
+	if len(values) == 0 {
+		return Summary{}
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mean := meanOf(sorted)
+
+	var variance float64
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(sorted))
+
+	return Summary{
+		Count:  len(sorted),
+		Mean:   mean,
+		StdDev: math.Sqrt(variance),
+		Min:    sorted[0],
+		P25:    Quantile(sorted, 0.25),
+		Median: Quantile(sorted, 0.5),
+		P75:    Quantile(sorted, 0.75),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+func meanOf(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// Quantile interpolates linearly between the closest ranks of sorted values,
+// like PostgreSQL's percentile_cont.
+func Quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+func pearson(xs, ys []float64) *float64 {
+	if len(xs) < minCorrelationMatches {
+		return nil
+	}
+
+	mx, my := meanOf(xs), meanOf(ys)
+
+	var cov, vx, vy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+
+	if vx == 0 || vy == 0 {
+		return nil
+	}
+
+	r := cov / math.Sqrt(vx*vy)
+	return &r
+}
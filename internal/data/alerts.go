@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// StressAlert records a player's stress spiking far above their baseline
+// during a match.
+type StressAlert struct {
+	ID        int64     `json:"id"`
+	MatchID   int64     `json:"match_id"`
+	UserID    int64     `json:"user_id"`
+	RaisedAt  time.Time `json:"raised_at"`
+	Stress    float64   `json:"stress"`
+	Baseline  float64   `json:"baseline"`
+	StdDev    float64   `json:"std_dev"`
+	ZScore    float64   `json:"z_score"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AlertModel struct {
+	DB *sql.DB
+}
+
+func (m AlertModel) Insert(alert *StressAlert) error {
+	query := `
+		INSERT INTO stress_alerts (matches_id, users_id, raised_at, stress, baseline, std_dev, z_score)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING alerts_id, created_at`
+
+	args := []interface{}{
+		alert.MatchID,
+		alert.UserID,
+		alert.RaisedAt,
+		alert.Stress,
+		alert.Baseline,
+		alert.StdDev,
+		alert.ZScore,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&alert.ID, &alert.CreatedAt)
+}
+
+func (m AlertModel) GetAllByMatch(matchID int64) ([]*StressAlert, error) {
+	query := `
+		SELECT alerts_id, matches_id, users_id, raised_at, stress, baseline, std_dev, z_score, created_at
+		FROM stress_alerts
+		WHERE matches_id = $1
+		ORDER BY raised_at, alerts_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	alerts := []*StressAlert{}
+
+	for rows.Next() {
+		var alert StressAlert
+
+		err := rows.Scan(
+			&alert.ID,
+			&alert.MatchID,
+			&alert.UserID,
+			&alert.RaisedAt,
+			&alert.Stress,
+			&alert.Baseline,
+			&alert.StdDev,
+			&alert.ZScore,
+			&alert.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		alerts = append(alerts, &alert)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
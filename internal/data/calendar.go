@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// CalendarEntry is a scheduled match together with the names needed to
+// describe it in a calendar feed.
+type CalendarEntry struct {
+	MatchID          int64
+	Sequence         int
+	ScheduledAt      time.Time
+	EstimatedMinutes int
+	Stage            string
+	Venue            string
+	Station          string
+	TournamentName   string
+	HomeName         string
+	AwayName         string
+}
+
+func (m MatchModel) GetCalendarByTournament(tournamentID int64) ([]*CalendarEntry, error) {
+	return m.getCalendar(`m.tournaments_id = $1`, tournamentID)
+}
+
+func (m MatchModel) GetCalendarByTeam(teamID int64) ([]*CalendarEntry, error) {
+	return m.getCalendar(`(hp.teams_id = $1 OR ap.teams_id = $1)`, teamID)
+}
+
+// GetCalendarByUser includes the matches the user plays directly, the ones
+// they have a player record for and the ones played by a team they were a
+// member of on the day of the match.
+func (m MatchModel) GetCalendarByUser(userID int64) ([]*CalendarEntry, error) {
+	return m.getCalendar(`(
+		hp.users_id = $1 OR ap.users_id = $1
+		OR EXISTS (SELECT 1 FROM users_matches um WHERE um.matches_id = m.matches_id AND um.users_id = $1)
+		OR EXISTS (
+			SELECT 1 FROM teams_users tu
+			WHERE tu.user_id = $1
+			AND tu.teams_id IN (hp.teams_id, ap.teams_id)
+			AND tu.join_date <= m.scheduled_at::date
+			AND (tu.leave_date IS NULL OR tu.leave_date >= m.scheduled_at::date)
+		)
+	)`, userID)
+}
+
+// getCalendar runs the feed query restricted by filter, which must be one of
+// the fixed conditions above and reference its argument as $1.
+func (m MatchModel) getCalendar(filter string, arg int64) ([]*CalendarEntry, error) {
+	query := `
+		SELECT m.matches_id, m.sequence, m.scheduled_at, m.estimated_minutes, m.stage,
+			COALESCE(v.venues_name, ''), COALESCE(s.stations_name, ''),
+			t.tournaments_name,
+			COALESCE(hteam.teams_name, huser.users_name, ''),
+			COALESCE(ateam.teams_name, auser.users_name, '')
+		FROM matches m
+		INNER JOIN tournaments t ON t.tournaments_id = m.tournaments_id
+		LEFT JOIN stations s ON s.stations_id = m.stations_id
+		LEFT JOIN venues v ON v.venues_id = s.venues_id
+		LEFT JOIN tournaments_participants hp ON hp.participants_id = m.home_participant_id
+		LEFT JOIN teams hteam ON hteam.teams_id = hp.teams_id
+		LEFT JOIN users huser ON huser.users_id = hp.users_id
+		LEFT JOIN tournaments_participants ap ON ap.participants_id = m.away_participant_id
+		LEFT JOIN teams ateam ON ateam.teams_id = ap.teams_id
+		LEFT JOIN users auser ON auser.users_id = ap.users_id
+		WHERE m.scheduled_at IS NOT NULL
+		AND ` + filter + `
+		ORDER BY m.scheduled_at, m.matches_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*CalendarEntry{}
+
+	for rows.Next() {
+		var entry CalendarEntry
+
+		err := rows.Scan(
+			&entry.MatchID,
+			&entry.Sequence,
+			&entry.ScheduledAt,
+			&entry.EstimatedMinutes,
+			&entry.Stage,
+			&entry.Venue,
+			&entry.Station,
+			&entry.TournamentName,
+			&entry.HomeName,
+			&entry.AwayName,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,180 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// CareerTeam is a player's spell with a team. LeaveDate is nil while the
+// player is still with the team.
+type CareerTeam struct {
+	TeamID    int64   `json:"team_id"`
+	TeamName  string  `json:"team_name"`
+	Region    string  `json:"region"`
+	Role      string  `json:"role"`
+	JoinDate  string  `json:"join_date"`
+	LeaveDate *string `json:"leave_date"`
+}
+
+// CareerTournament is a tournament a player entered, on their own or for a
+// team, and what they won there.
+type CareerTournament struct {
+	TournamentID   int64   `json:"tournament_id"`
+	TournamentName string  `json:"tournament_name"`
+	GameID         int64   `json:"game_id"`
+	GameName       string  `json:"game_name"`
+	StartDate      string  `json:"start_date"`
+	Status         string  `json:"status"`
+	TeamID         int64   `json:"team_id,omitempty"`
+	Placement      *int    `json:"placement"`
+	PrizeMoney     float64 `json:"prize_money"`
+}
+
+type CareerModel struct {
+	DB *sql.DB
+}
+
+// GetTeams returns the teams a player has been part of, latest first.
+func (m CareerModel) GetTeams(userID int64) ([]*CareerTeam, error) {
+	query := `
+		SELECT tu.teams_id, t.teams_name, t.teams_region, tu.role,
+			to_char(tu.join_date, 'YYYY-MM-DD'), to_char(tu.leave_date, 'YYYY-MM-DD')
+		FROM teams_users tu
+		INNER JOIN teams t ON t.teams_id = tu.teams_id
+		WHERE tu.user_id = $1
+		ORDER BY tu.join_date DESC, tu.teams_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	teams := []*CareerTeam{}
+
+	for rows.Next() {
+		var team CareerTeam
+
+		err := rows.Scan(
+			&team.TeamID,
+			&team.TeamName,
+			&team.Region,
+			&team.Role,
+			&team.JoinDate,
+			&team.LeaveDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		teams = append(teams, &team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// GetTournaments returns the tournaments a player entered, latest first. A
+// player counts as having entered for a team when they played at least one of
+// its matches in the tournament while a member of it. Prize money is only counted
+// once a tournament is completed; it is split between participants tied on a
+// placement and then between the players of the team, as on the leaderboards.
+func (m CareerModel) GetTournaments(userID int64) ([]*CareerTournament, error) {
+	query := `
+		WITH played_for AS (
+			SELECT DISTINCT um.users_id, p.participants_id
+			FROM users_matches um
+			INNER JOIN matches m ON m.matches_id = um.matches_id
+			INNER JOIN tournaments t ON t.tournaments_id = m.tournaments_id
+			INNER JOIN tournaments_participants p
+				ON p.participants_id IN (m.home_participant_id, m.away_participant_id)
+			INNER JOIN teams_users tu ON tu.teams_id = p.teams_id AND tu.user_id = um.users_id
+				AND tu.join_date <= COALESCE(m.scheduled_at::date, t.start_date)
+				AND (tu.leave_date IS NULL OR tu.leave_date >= COALESCE(m.scheduled_at::date, t.start_date))
+			WHERE um.tournaments_id IN (
+				SELECT tournaments_id FROM users_matches WHERE users_id = $1
+			)
+		),
+		entered AS (
+			SELECT p.participants_id, p.tournaments_id, p.teams_id, p.placement
+			FROM tournaments_participants p
+			WHERE p.users_id = $1
+			UNION
+			SELECT p.participants_id, p.tournaments_id, p.teams_id, p.placement
+			FROM tournaments_participants p
+			INNER JOIN played_for pf ON pf.participants_id = p.participants_id AND pf.users_id = $1
+		)
+		SELECT e.tournaments_id, t.tournaments_name, t.games_id, g.games_name,
+			to_char(t.start_date, 'YYYY-MM-DD'), t.status, COALESCE(e.teams_id, 0), e.placement,
+			CASE
+				WHEN e.placement IS NULL OR t.status NOT IN ('completed', 'archived') THEN 0
+				ELSE COALESCE(prizes.money, 0)::double precision / tied.n / GREATEST(lineup.n, 1)
+			END
+		FROM entered e
+		INNER JOIN tournaments t ON t.tournaments_id = e.tournaments_id
+		INNER JOIN games g ON g.games_id = t.games_id
+		LEFT JOIN LATERAL (
+			SELECT count(*) AS n
+			FROM tournaments_participants o
+			WHERE o.tournaments_id = e.tournaments_id AND o.placement = e.placement
+		) tied ON true
+		LEFT JOIN LATERAL (
+			SELECT sum(pp.money) AS money
+			FROM tournaments_prize_pool pp
+			WHERE pp.tournaments_id = e.tournaments_id
+			AND pp.place BETWEEN e.placement AND e.placement + tied.n - 1
+		) prizes ON true
+		LEFT JOIN LATERAL (
+			SELECT count(DISTINCT pf.users_id) AS n
+			FROM played_for pf
+			WHERE pf.participants_id = e.participants_id
+		) lineup ON true
+		ORDER BY t.start_date DESC, e.tournaments_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tournaments := []*CareerTournament{}
+
+	for rows.Next() {
+		var tournament CareerTournament
+
+		err := rows.Scan(
+			&tournament.TournamentID,
+			&tournament.TournamentName,
+			&tournament.GameID,
+			&tournament.GameName,
+			&tournament.StartDate,
+			&tournament.Status,
+			&tournament.TeamID,
+			&tournament.Placement,
+			&tournament.PrizeMoney,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tournaments = append(tournaments, &tournament)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tournaments, nil
+}
@@ -0,0 +1,353 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// The kinds of biometric data a player's consent covers. Environment readings
+// describe the room rather than the player and are not covered.
+const (
+	BiometricHeartRate = "heart_rate"
+	BiometricStress    = "stress"
+)
+
+var BiometricData = []string{BiometricHeartRate, BiometricStress}
+
+// The audiences a player can share biometric data with. Tournament staff are
+// admins and referees; the public only ever sees anonymised aggregates.
+const (
+	AudienceSelf            = "self"
+	AudienceTeamStaff       = "team_staff"
+	AudienceTournamentStaff = "tournament_staff"
+	AudiencePublicAggregate = "public_aggregate"
+)
+
+var ConsentAudiences = []string{AudienceSelf, AudienceTeamStaff, AudienceTournamentStaff, AudiencePublicAggregate}
+
+// Consent is whether a player shares one kind of biometric data with one
+// audience. Without a recorded choice only the player themselves has access.
+type Consent struct {
+	Data      string     `json:"data"`
+	Audience  string     `json:"audience"`
+	Granted   bool       `json:"granted"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+type ConsentChange struct {
+	ID        int64     `json:"id"`
+	Data      string    `json:"data"`
+	Audience  string    `json:"audience"`
+	Granted   bool      `json:"granted"`
+	ChangedBy int64     `json:"changed_by,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+func ValidateConsent(v *validator.Validator, consent *Consent) {
+	v.Check(validator.In(consent.Data, BiometricData...), "data", "must be heart_rate or stress")
+	v.Check(validator.In(consent.Audience, ConsentAudiences...), "audience", "must be self, team_staff, tournament_staff or public_aggregate")
+	v.Check(consent.Audience != AudienceSelf || consent.Granted, "audience", "a player can always see their own data")
+}
+
+// BiometricAccess is the kinds of biometric data of a player someone may see.
+type BiometricAccess map[string]bool
+
+func FullBiometricAccess() BiometricAccess {
+	access := make(BiometricAccess, len(BiometricData))
+	for _, data := range BiometricData {
+		access[data] = true
+	}
+	return access
+}
+
+type ConsentModel struct {
+	DB *sql.DB
+}
+
+// GetAllForUser returns the player's choice for every kind of data and
+// audience, with the default for those never chosen.
+func (m ConsentModel) GetAllForUser(userID int64) ([]*Consent, error) {
+	query := `
+		SELECT d.category, a.audience, COALESCE(c.granted, a.audience = $4), c.updated_at
+		FROM unnest($2::text[]) WITH ORDINALITY AS d(category, i)
+		CROSS JOIN unnest($3::text[]) WITH ORDINALITY AS a(audience, j)
+		LEFT JOIN biometric_consents c ON c.users_id = $1
+			AND c.data_category = d.category
+			AND c.audience = a.audience
+		ORDER BY d.i, a.j`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(BiometricData), pq.Array(ConsentAudiences), AudienceSelf)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	consents := []*Consent{}
+
+	for rows.Next() {
+		var consent Consent
+
+		err := rows.Scan(
+			&consent.Data,
+			&consent.Audience,
+			&consent.Granted,
+			&consent.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		consents = append(consents, &consent)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// Set records a player's choices, and in the history those that changed
+// anything. It returns the changes.
+func (m ConsentModel) Set(userID, changedBy int64, consents []*Consent) ([]*ConsentChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Changes to a player's consent are made one at a time, so that each is
+	// compared against what the previous one left.
+	_, err = tx.ExecContext(ctx, `SELECT 1 FROM users WHERE users_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []*ConsentChange{}
+
+	for _, consent := range consents {
+		var current bool
+
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE((
+				SELECT granted
+				FROM biometric_consents
+				WHERE users_id = $1 AND data_category = $2 AND audience = $3
+			), $3 = $4)`,
+			userID, consent.Data, consent.Audience, AudienceSelf).Scan(&current)
+		if err != nil {
+			return nil, err
+		}
+
+		if current == consent.Granted {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO biometric_consents (users_id, data_category, audience, granted)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (users_id, data_category, audience)
+			DO UPDATE SET granted = EXCLUDED.granted, updated_at = NOW()`,
+			userID, consent.Data, consent.Audience, consent.Granted)
+		if err != nil {
+			return nil, err
+		}
+
+		change := &ConsentChange{
+			Data:      consent.Data,
+			Audience:  consent.Audience,
+			Granted:   consent.Granted,
+			ChangedBy: changedBy,
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO biometric_consents_history (users_id, data_category, audience, granted, changed_by)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING history_id, changed_at`,
+			userID, change.Data, change.Audience, change.Granted, change.ChangedBy).Scan(&change.ID, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, tx.Commit()
+}
+
+// GetHistory returns the changes to a player's consent, newest first.
+func (m ConsentModel) GetHistory(userID int64) ([]*ConsentChange, error) {
+	query := `
+		SELECT history_id, data_category, audience, granted, COALESCE(changed_by, 0), changed_at
+		FROM biometric_consents_history
+		WHERE users_id = $1
+		ORDER BY changed_at DESC, history_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	changes := []*ConsentChange{}
+
+	for rows.Next() {
+		var change ConsentChange
+
+		err := rows.Scan(
+			&change.ID,
+			&change.Data,
+			&change.Audience,
+			&change.Granted,
+			&change.ChangedBy,
+			&change.ChangedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// GetAccess returns the kinds of a player's data shared with any of the
+// audiences.
+func (m ConsentModel) GetAccess(userID int64, audiences []string) (BiometricAccess, error) {
+	if validator.In(AudienceSelf, audiences...) {
+		return FullBiometricAccess(), nil
+	}
+
+	access := BiometricAccess{}
+
+	if len(audiences) == 0 {
+		return access, nil
+	}
+
+	query := `
+		SELECT DISTINCT data_category
+		FROM biometric_consents
+		WHERE users_id = $1 AND granted AND audience = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(audiences))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+
+		err := rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+
+		access[data] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return access, nil
+}
+
+// MinAggregatePlayers is the fewest players an aggregate is published for, so
+// that no one's data can be picked out of it.
+const MinAggregatePlayers = 5
+
+// BiometricAggregate summarises one kind of data over the players who share
+// it publicly. Only the mean is given, as a minimum or maximum is one
+// player's own figure, and it is left out when too few players share.
+type BiometricAggregate struct {
+	Players    int      `json:"players"`
+	Records    int      `json:"records"`
+	Mean       *float64 `json:"mean,omitempty"`
+	Suppressed bool     `json:"suppressed"`
+}
+
+// GetBiometricAggregates summarises the players' average stress and heart
+// rate per match, over a match or a whole tournament, counting only players
+// who share that data for public aggregates.
+func (m UserMatchModel) GetBiometricAggregates(matchID, tournamentID int64) (map[string]*BiometricAggregate, error) {
+	query := `
+		WITH records AS (
+			SELECT um.users_id,
+				CASE WHEN cs.granted THEN um.average_stress END AS stress,
+				CASE WHEN ch.granted THEN hr.heart_rate END AS heart_rate
+			FROM users_matches um
+			LEFT JOIN biometric_consents cs ON cs.users_id = um.users_id
+				AND cs.data_category = 'stress' AND cs.audience = $3
+			LEFT JOIN biometric_consents ch ON ch.users_id = um.users_id
+				AND ch.data_category = 'heart_rate' AND ch.audience = $3
+			LEFT JOIN LATERAL (
+				SELECT avg(s.heart_rate) AS heart_rate
+				FROM match_sensor_samples s
+				WHERE s.matches_id = um.matches_id AND s.users_id = um.users_id AND NOT s.quarantined
+			) hr ON ch.granted
+			WHERE ($1 = 0 OR um.matches_id = $1)
+			AND ($2 = 0 OR um.tournaments_id = $2)
+		)
+		SELECT count(DISTINCT users_id) FILTER (WHERE stress IS NOT NULL), count(stress),
+			avg(stress),
+			count(DISTINCT users_id) FILTER (WHERE heart_rate IS NOT NULL), count(heart_rate),
+			avg(heart_rate)
+		FROM records`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var stress, heartRate BiometricAggregate
+
+	err := m.DB.QueryRowContext(ctx, query, matchID, tournamentID, AudiencePublicAggregate).Scan(
+		&stress.Players,
+		&stress.Records,
+		&stress.Mean,
+		&heartRate.Players,
+		&heartRate.Records,
+		&heartRate.Mean,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates := map[string]*BiometricAggregate{
+		BiometricStress:    &stress,
+		BiometricHeartRate: &heartRate,
+	}
+
+	for _, aggregate := range aggregates {
+		if aggregate.Players < MinAggregatePlayers {
+			aggregate.Mean = nil
+			aggregate.Suppressed = true
+		}
+	}
+
+	return aggregates, nil
+}
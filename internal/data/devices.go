@@ -0,0 +1,566 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateDevice = errors.New("duplicate device")
+
+const (
+	DeviceWearable    = "wearable"
+	DeviceEnvironment = "environment"
+)
+
+const (
+	DeviceOnline      = "online"
+	DeviceOffline     = "offline"
+	DeviceNeverSeen   = "never_seen"
+	DeviceQuarantined = "quarantined"
+)
+
+// Offsets are added to a device's measurements as they are stored, to
+// correct for what calibration found it to be off by.
+type Offsets struct {
+	HeartRate   float64 `json:"heart_rate"`
+	Stress      float64 `json:"stress"`
+	Humidity    float64 `json:"humidity"`
+	Temperature float64 `json:"temperature"`
+	Pressure    float64 `json:"pressure"`
+}
+
+// Device is a physical sensor kit: a wearable measuring a player, or an
+// environment sensor measuring the room at a station.
+type Device struct {
+	ID               int64      `json:"id"`
+	Serial           string     `json:"serial"`
+	Type             string     `json:"type"`
+	Firmware         string     `json:"firmware"`
+	VenueID          int64      `json:"venue_id,omitempty"`
+	StationID        int64      `json:"station_id,omitempty"`
+	Offsets          Offsets    `json:"offsets"`
+	CalibratedAt     *time.Time `json:"calibrated_at,omitempty"`
+	LastSeenAt       *time.Time `json:"last_seen_at,omitempty"`
+	Status           string     `json:"status"`
+	QuarantinedAt    *time.Time `json:"quarantined_at,omitempty"`
+	QuarantineReason string     `json:"quarantine_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Version          int        `json:"version"`
+}
+
+func (d *Device) IsQuarantined() bool {
+	return d.QuarantinedAt != nil
+}
+
+// SetStatus works out whether the device is online, from when it was last
+// heard from.
+func (d *Device) SetStatus(now time.Time, offlineAfter time.Duration) {
+	switch {
+	case d.IsQuarantined():
+		d.Status = DeviceQuarantined
+	case d.LastSeenAt == nil:
+		d.Status = DeviceNeverSeen
+	case now.Sub(*d.LastSeenAt) <= offlineAfter:
+		d.Status = DeviceOnline
+	default:
+		d.Status = DeviceOffline
+	}
+}
+
+// CalibrateSample applies the device's offsets to a sample it took, and
+// records it as the sample's source.
+func (d *Device) CalibrateSample(sample *SensorSample) {
+	sample.DeviceID = d.ID
+	sample.HeartRate += d.Offsets.HeartRate
+	sample.Stress += d.Offsets.Stress
+	sample.Humidity += d.Offsets.Humidity
+	sample.Temperature += d.Offsets.Temperature
+	sample.Pressure += d.Offsets.Pressure
+}
+
+// CalibrateReading applies the device's offsets to a reading it took.
+func (d *Device) CalibrateReading(reading *Reading) {
+	reading.Humidity += d.Offsets.Humidity
+	reading.Temperature += d.Offsets.Temperature
+	reading.Pressure += d.Offsets.Pressure
+}
+
+func ValidateDevice(v *validator.Validator, device *Device) {
+	v.Check(device.Serial != "", "serial", "must be provided")
+	v.Check(len(device.Serial) <= 100, "serial", "must not be more than 100 bytes long")
+	v.Check(validator.In(device.Type, DeviceWearable, DeviceEnvironment), "type", "must be wearable or environment")
+	v.Check(len(device.Firmware) <= 50, "firmware", "must not be more than 50 bytes long")
+	v.Check(device.VenueID >= 0, "venue_id", "must not be negative")
+	v.Check(device.StationID >= 0, "station_id", "must not be negative")
+	v.Check(device.StationID == 0 || device.VenueID > 0, "venue_id", "must be provided with a station")
+	v.Check(device.StationID == 0 || device.Type == DeviceEnvironment, "station_id", "can only be assigned to environment devices")
+
+	o := device.Offsets
+	v.Check(math.Abs(o.HeartRate) <= 50, "offsets", "heart_rate must be between -50 and 50")
+	v.Check(math.Abs(o.Stress) <= 50, "offsets", "stress must be between -50 and 50")
+	v.Check(math.Abs(o.Humidity) <= 50, "offsets", "humidity must be between -50 and 50")
+	v.Check(math.Abs(o.Temperature) <= 50, "offsets", "temperature must be between -50 and 50")
+	v.Check(math.Abs(o.Pressure) <= 100, "offsets", "pressure must be between -100 and 100")
+}
+
+type DeviceModel struct {
+	DB *sql.DB
+}
+
+const deviceQuery = `
+	SELECT devices_id, serial, device_type, firmware, COALESCE(venues_id, 0), COALESCE(stations_id, 0),
+		heart_rate_offset, stress_offset, humidity_offset, temperature_offset, pressure_offset,
+		calibrated_at, last_seen_at, quarantined_at, quarantine_reason, created_at, version
+	FROM devices`
+
+func scanDevice(row interface{ Scan(...interface{}) error }) (*Device, error) {
+	var device Device
+
+	err := row.Scan(
+		&device.ID,
+		&device.Serial,
+		&device.Type,
+		&device.Firmware,
+		&device.VenueID,
+		&device.StationID,
+		&device.Offsets.HeartRate,
+		&device.Offsets.Stress,
+		&device.Offsets.Humidity,
+		&device.Offsets.Temperature,
+		&device.Offsets.Pressure,
+		&device.CalibratedAt,
+		&device.LastSeenAt,
+		&device.QuarantinedAt,
+		&device.QuarantineReason,
+		&device.CreatedAt,
+		&device.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+func (m DeviceModel) Insert(device *Device) error {
+	query := `
+		INSERT INTO devices (serial, device_type, firmware, venues_id, stations_id,
+			heart_rate_offset, stress_offset, humidity_offset, temperature_offset, pressure_offset, calibrated_at)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, 0), $6, $7, $8, $9, $10, $11)
+		RETURNING devices_id, created_at, version`
+
+	o := device.Offsets
+	args := []interface{}{device.Serial, device.Type, device.Firmware, device.VenueID, device.StationID,
+		o.HeartRate, o.Stress, o.Humidity, o.Temperature, o.Pressure, device.CalibratedAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&device.ID, &device.CreatedAt, &device.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "devices_serial_key"`:
+			return ErrDuplicateDevice
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m DeviceModel) Get(id int64) (*Device, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	device, err := scanDevice(m.DB.QueryRowContext(ctx, deviceQuery+` WHERE devices_id = $1`, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return device, nil
+}
+
+func (m DeviceModel) GetBySerial(serial string) (*Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	device, err := scanDevice(m.DB.QueryRowContext(ctx, deviceQuery+` WHERE serial = $1`, serial))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return device, nil
+}
+
+// GetAll returns the registered devices, optionally only those of a venue.
+func (m DeviceModel) GetAll(venueID int64) ([]*Device, error) {
+	query := deviceQuery + `
+		WHERE ($1 = 0 OR venues_id = $1)
+		ORDER BY serial`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	devices := []*Device{}
+
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, device)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func (m DeviceModel) Update(device *Device) error {
+	query := `
+		UPDATE devices
+		SET serial = $1, device_type = $2, firmware = $3, venues_id = NULLIF($4, 0), stations_id = NULLIF($5, 0),
+			heart_rate_offset = $6, stress_offset = $7, humidity_offset = $8, temperature_offset = $9,
+			pressure_offset = $10, calibrated_at = $11, version = version + 1
+		WHERE devices_id = $12 AND version = $13
+		RETURNING version`
+
+	o := device.Offsets
+	args := []interface{}{device.Serial, device.Type, device.Firmware, device.VenueID, device.StationID,
+		o.HeartRate, o.Stress, o.Humidity, o.Temperature, o.Pressure, device.CalibratedAt,
+		device.ID, device.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&device.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "devices_serial_key"`:
+			return ErrDuplicateDevice
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Heartbeat records that a device is up, along with the firmware it reports
+// running if any.
+func (m DeviceModel) Heartbeat(device *Device, firmware string) error {
+	query := `
+		UPDATE devices
+		SET last_seen_at = NOW(),
+			version = version + CASE WHEN $2 <> '' AND $2 <> firmware THEN 1 ELSE 0 END,
+			firmware = CASE WHEN $2 <> '' THEN $2 ELSE firmware END
+		WHERE devices_id = $1
+		RETURNING firmware, last_seen_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, device.ID, firmware).Scan(&device.Firmware, &device.LastSeenAt, &device.Version)
+}
+
+// Touch records that devices were seen sending data at a time.
+func (m DeviceModel) Touch(ids []int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE devices
+		SET last_seen_at = GREATEST(last_seen_at, $2)
+		WHERE devices_id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(ids), at)
+	return err
+}
+
+// QuarantineResult tells how much data a quarantine set aside or restored,
+// and which matches it was used by.
+type QuarantineResult struct {
+	Samples  int64   `json:"samples"`
+	Readings int64   `json:"readings"`
+	Matches  []int64 `json:"matches"`
+}
+
+// Quarantine marks a device as untrustworthy and sets aside the samples and
+// readings it took since a time, so they no longer count towards anything.
+func (m DeviceModel) Quarantine(device *Device, reason string, since time.Time) (*QuarantineResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE devices
+		SET quarantined_at = NOW(), quarantine_reason = $2, version = version + 1
+		WHERE devices_id = $1
+		RETURNING quarantined_at, quarantine_reason, version`,
+		device.ID, reason).Scan(&device.QuarantinedAt, &device.QuarantineReason, &device.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := setQuarantined(ctx, tx, device.ID, since, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit()
+}
+
+// Release lifts a device's quarantine and restores all the data it took.
+func (m DeviceModel) Release(device *Device) (*QuarantineResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE devices
+		SET quarantined_at = NULL, quarantine_reason = '', version = version + 1
+		WHERE devices_id = $1
+		RETURNING version`,
+		device.ID).Scan(&device.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	device.QuarantinedAt = nil
+	device.QuarantineReason = ""
+
+	result, err := setQuarantined(ctx, tx, device.ID, time.Time{}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit()
+}
+
+// setQuarantined flags or unflags a device's data from since onwards. The
+// matches it reports are those with samples from the device, and those
+// played at a station whose readings from it overlapped the match.
+func setQuarantined(ctx context.Context, tx *sql.Tx, deviceID int64, since time.Time, quarantined bool) (*QuarantineResult, error) {
+	result := &QuarantineResult{Matches: []int64{}}
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH s AS (
+			UPDATE match_sensor_samples
+			SET quarantined = $3
+			WHERE devices_id = $1 AND sampled_at >= $2 AND quarantined <> $3
+			RETURNING matches_id
+		)
+		SELECT matches_id, count(*)
+		FROM s
+		GROUP BY matches_id
+		ORDER BY matches_id`,
+		deviceID, since, quarantined)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	matches := make(map[int64]bool)
+
+	for rows.Next() {
+		var matchID, count int64
+
+		err := rows.Scan(&matchID, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Samples += count
+		result.Matches = append(result.Matches, matchID)
+		matches[matchID] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		WITH r AS (
+			UPDATE stations_readings
+			SET quarantined = $3
+			WHERE devices_id = $1 AND read_at >= $2 AND quarantined <> $3
+			RETURNING stations_id, read_at
+		),
+		span AS (
+			SELECT stations_id, count(*) AS readings, min(read_at) AS from_at, max(read_at) AS to_at
+			FROM r
+			GROUP BY stations_id
+		)
+		SELECT sp.stations_id, sp.readings, COALESCE(m.matches_id, 0)
+		FROM span sp
+		LEFT JOIN matches m ON m.stations_id = sp.stations_id
+			AND m.scheduled_at <= sp.to_at
+			AND m.scheduled_at + make_interval(mins => m.estimated_minutes) >= sp.from_at`,
+		deviceID, since, quarantined)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counted := make(map[int64]bool)
+
+	for rows.Next() {
+		var stationID, readings, matchID int64
+
+		err := rows.Scan(&stationID, &readings, &matchID)
+		if err != nil {
+			return nil, err
+		}
+
+		// A station's count repeats for each of its matches.
+		if !counted[stationID] {
+			counted[stationID] = true
+			result.Readings += readings
+		}
+
+		if matchID > 0 && !matches[matchID] {
+			matches[matchID] = true
+			result.Matches = append(result.Matches, matchID)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+type MatchUsage struct {
+	MatchID     int64     `json:"match_id"`
+	Samples     int64     `json:"samples"`
+	Quarantined int64     `json:"quarantined"`
+	FirstAt     time.Time `json:"first_at"`
+	LastAt      time.Time `json:"last_at"`
+}
+
+type StationUsage struct {
+	StationID   int64     `json:"station_id"`
+	Readings    int64     `json:"readings"`
+	Quarantined int64     `json:"quarantined"`
+	FirstAt     time.Time `json:"first_at"`
+	LastAt      time.Time `json:"last_at"`
+}
+
+// DeviceUsage is where a device's data ended up, for tracing what a faulty
+// device may have affected.
+type DeviceUsage struct {
+	Matches  []*MatchUsage   `json:"matches"`
+	Stations []*StationUsage `json:"stations"`
+}
+
+func (m DeviceModel) GetUsage(deviceID int64) (*DeviceUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	usage := &DeviceUsage{Matches: []*MatchUsage{}, Stations: []*StationUsage{}}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT matches_id, count(*), count(*) FILTER (WHERE quarantined), min(sampled_at), max(sampled_at)
+		FROM match_sensor_samples
+		WHERE devices_id = $1
+		GROUP BY matches_id
+		ORDER BY min(sampled_at) DESC`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var mu MatchUsage
+
+		err := rows.Scan(&mu.MatchID, &mu.Samples, &mu.Quarantined, &mu.FirstAt, &mu.LastAt)
+		if err != nil {
+			return nil, err
+		}
+
+		usage.Matches = append(usage.Matches, &mu)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = m.DB.QueryContext(ctx, `
+		SELECT stations_id, count(*), count(*) FILTER (WHERE quarantined), min(read_at), max(read_at)
+		FROM stations_readings
+		WHERE devices_id = $1
+		GROUP BY stations_id
+		ORDER BY min(read_at) DESC`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var su StationUsage
+
+		err := rows.Scan(&su.StationID, &su.Readings, &su.Quarantined, &su.FirstAt, &su.LastAt)
+		if err != nil {
+			return nil, err
+		}
+
+		usage.Stations = append(usage.Stations, &su)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
@@ -3,20 +3,31 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/lib/pq"
 )
 
 type Game struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID           int64      `json:"id"`
+	Name         string     `json:"name"`
+	MapPool      []string   `json:"map_pool"`
+	VetoSequence []VetoStep `json:"veto_sequence"`
+	Version      int        `json:"version"`
 }
 
 func ValidateGame(v *validator.Validator, game *Game) {
 	v.Check(game.Name != "", "name", "must be provided")
 	v.Check(len(game.Name) <= 100, "name", "must not be more than 100 bytes long")
+	ValidateMapPool(v, game.MapPool)
+
+	if len(game.VetoSequence) > 0 {
+		ValidateVetoSequence(v, "veto_sequence", game.VetoSequence, game.MapPool)
+	}
 }
 
 type GameModel struct {
@@ -25,14 +36,19 @@ type GameModel struct {
 
 func (m GameModel) Insert(game *Game) error {
 	query := `
-		INSERT INTO games (games_name)
-		VALUES ($1)
-		RETURNING games_id`
+		INSERT INTO games (games_name, map_pool, veto_sequence)
+		VALUES ($1, $2, $3)
+		RETURNING games_id, version`
+
+	sequence, err := json.Marshal(game.VetoSequence)
+	if err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, game.Name).Scan(&game.ID)
+	err = m.DB.QueryRowContext(ctx, query, game.Name, pq.Array(game.MapPool), sequence).Scan(&game.ID, &game.Version)
 	if err != nil {
 		return err
 	}
@@ -41,11 +57,12 @@ func (m GameModel) Insert(game *Game) error {
 
 func (m GameModel) Get(id int64) (*Game, error) {
 	query := `
-		SELECT games_id, games_name
+		SELECT games_id, games_name, map_pool, veto_sequence, version
 		FROM games
 		WHERE games_id = $1`
 
 	var game Game
+	var sequence []byte
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -53,6 +70,9 @@ func (m GameModel) Get(id int64) (*Game, error) {
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&game.ID,
 		&game.Name,
+		pq.Array(&game.MapPool),
+		&sequence,
+		&game.Version,
 	)
 
 	if err != nil {
@@ -64,12 +84,17 @@ func (m GameModel) Get(id int64) (*Game, error) {
 		}
 	}
 
+	err = json.Unmarshal(sequence, &game.VetoSequence)
+	if err != nil {
+		return nil, err
+	}
+
 	return &game, nil
 }
 
 func (m GameModel) GetAll() ([]*Game, error) {
 	query := `
-		SELECT games_id, games_name
+		SELECT games_id, games_name, map_pool, veto_sequence, version
 		FROM games`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -86,15 +111,24 @@ func (m GameModel) GetAll() ([]*Game, error) {
 
 	for rows.Next() {
 		var game Game
+		var sequence []byte
 
 		err := rows.Scan(
 			&game.ID,
 			&game.Name,
+			pq.Array(&game.MapPool),
+			&sequence,
+			&game.Version,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		err = json.Unmarshal(sequence, &game.VetoSequence)
+		if err != nil {
+			return nil, err
+		}
+
 		games = append(games, &game)
 	}
 
@@ -108,16 +142,25 @@ func (m GameModel) GetAll() ([]*Game, error) {
 func (m GameModel) Update(game *Game) error {
 	query := `
 		UPDATE games
-		SET games_name = $1
-		WHERE games_id = $2`
+		SET games_name = $1, map_pool = $2, veto_sequence = $3, version = version + 1
+		WHERE games_id = $4 AND version = $5
+		RETURNING version`
+
+	sequence, err := json.Marshal(game.VetoSequence)
+	if err != nil {
+		return err
+	}
 
 	args := []interface{}{
 		game.Name,
+		pq.Array(game.MapPool),
+		sequence,
 		game.ID,
+		game.Version,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&game.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -129,19 +172,21 @@ func (m GameModel) Update(game *Game) error {
 	return nil
 }
 
-func (m GameModel) Delete(id int64) error {
+// Delete removes the game. A non-zero version makes the delete conditional
+// on the row not having changed since it was read.
+func (m GameModel) Delete(id int64, version int) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
 		DELETE FROM games
-		WHERE games_id = $1`
+		WHERE games_id = $1 AND ($2 = 0 OR version = $2)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -152,6 +197,9 @@ func (m GameModel) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
+		if version > 0 {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 
@@ -0,0 +1,226 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// GameSchema holds the JSON Schemas a game's match results and per-player
+// stats have to satisfy. Schemas are never edited in place: every change
+// creates a new version so that historical results keep validating against
+// the schema they were recorded under.
+type GameSchema struct {
+	GameID       int64           `json:"game_id"`
+	Version      int             `json:"version"`
+	MatchSchema  json.RawMessage `json:"match_schema"`
+	PlayerSchema json.RawMessage `json:"player_schema"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+func compileSchema(name string, raw json.RawMessage) (*jsonschema.Schema, error) {
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+
+	err := compiler.AddResource(name, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile(name)
+}
+
+func ValidateGameSchema(v *validator.Validator, schema *GameSchema) {
+	_, err := compileSchema("match.json", schema.MatchSchema)
+	v.Check(err == nil, "match_schema", "must be a valid JSON Schema")
+
+	_, err = compileSchema("player.json", schema.PlayerSchema)
+	v.Check(err == nil, "player_schema", "must be a valid JSON Schema")
+}
+
+// validatePayload checks a JSON document against one of the schemas and
+// records every violation under key.
+func validatePayload(v *validator.Validator, key string, raw, schema json.RawMessage) {
+	compiled, err := compileSchema(key+".json", schema)
+	if err != nil {
+		v.AddError(key, "the stored schema can not be compiled")
+		return
+	}
+
+	var doc interface{}
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	err = json.Unmarshal(raw, &doc)
+	if err != nil {
+		v.AddError(key, "must be valid JSON")
+		return
+	}
+
+	err = compiled.Validate(doc)
+	if err != nil {
+		var ve *jsonschema.ValidationError
+		if errors.As(err, &ve) {
+			v.AddError(key, describe(ve))
+			return
+		}
+		v.AddError(key, err.Error())
+	}
+}
+
+// describe flattens a schema validation error into a single message listing
+// the offending locations.
+func describe(ve *jsonschema.ValidationError) string {
+	leaves := []string{}
+
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			location := e.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			leaves = append(leaves, fmt.Sprintf("%s: %s", location, e.Message))
+			return
+		}
+		for _, c := range e.Causes {
+			walk(c)
+		}
+	}
+	walk(ve)
+
+	return "does not match the game schema (" + strings.Join(leaves, "; ") + ")"
+}
+
+type GameSchemaModel struct {
+	DB *sql.DB
+}
+
+// Insert stores the schema as the next version for its game.
+func (m GameSchemaModel) Insert(schema *GameSchema) error {
+	query := `
+		INSERT INTO games_schemas (games_id, version, match_schema, player_schema)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3
+		FROM games_schemas
+		WHERE games_id = $1
+		RETURNING version, created_at`
+
+	args := []interface{}{schema.GameID, []byte(schema.MatchSchema), []byte(schema.PlayerSchema)}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&schema.Version, &schema.CreatedAt)
+	if err != nil {
+		switch {
+		case strings.HasPrefix(err.Error(), `pq: duplicate key value violates unique constraint "games_schemas_pkey"`):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a specific schema version of a game.
+func (m GameSchemaModel) Get(gameID int64, version int) (*GameSchema, error) {
+	query := `
+		SELECT games_id, version, match_schema, player_schema, created_at
+		FROM games_schemas
+		WHERE games_id = $1 AND version = $2`
+
+	return m.get(query, gameID, version)
+}
+
+// GetLatest returns the current schema of a game.
+func (m GameSchemaModel) GetLatest(gameID int64) (*GameSchema, error) {
+	query := `
+		SELECT games_id, version, match_schema, player_schema, created_at
+		FROM games_schemas
+		WHERE games_id = $1
+		ORDER BY version DESC
+		LIMIT 1`
+
+	return m.get(query, gameID)
+}
+
+func (m GameSchemaModel) get(query string, args ...interface{}) (*GameSchema, error) {
+	var schema GameSchema
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&schema.GameID,
+		&schema.Version,
+		(*[]byte)(&schema.MatchSchema),
+		(*[]byte)(&schema.PlayerSchema),
+		&schema.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &schema, nil
+}
+
+func (m GameSchemaModel) GetAllByGame(gameID int64) ([]*GameSchema, error) {
+	query := `
+		SELECT games_id, version, match_schema, player_schema, created_at
+		FROM games_schemas
+		WHERE games_id = $1
+		ORDER BY version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	schemas := []*GameSchema{}
+
+	for rows.Next() {
+		var schema GameSchema
+
+		err := rows.Scan(
+			&schema.GameID,
+			&schema.Version,
+			(*[]byte)(&schema.MatchSchema),
+			(*[]byte)(&schema.PlayerSchema),
+			&schema.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		schemas = append(schemas, &schema)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return schemas, nil
+}
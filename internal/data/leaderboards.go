@@ -0,0 +1,196 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	LeaderboardPlayers = "player"
+	LeaderboardTeams   = "team"
+)
+
+// leaderboardSorts maps each order a leaderboard can be ranked in to its
+// column in the leaderboards view.
+var leaderboardSorts = map[string]string{
+	"elo":         "elo_rating",
+	"glicko2":     "glicko2_rating",
+	"prize_money": "prize_money",
+	"wins":        "wins",
+}
+
+// LeaderboardEntry is a player or team's standing in a game over a season,
+// or over all time.
+type LeaderboardEntry struct {
+	Rank          int      `json:"rank"`
+	UserID        int64    `json:"user_id,omitempty"`
+	TeamID        int64    `json:"team_id,omitempty"`
+	Name          string   `json:"name"`
+	Region        string   `json:"region"`
+	EloRating     *float64 `json:"elo_rating"`
+	Glicko2Rating *float64 `json:"glicko2_rating"`
+	Matches       int      `json:"matches"`
+	Tournaments   int      `json:"tournaments"`
+	Wins          int      `json:"wins"`
+	BestPlacement *int     `json:"best_placement"`
+	PrizeMoney    float64  `json:"prize_money"`
+}
+
+type LeaderboardFilter struct {
+	Type     string
+	GameID   int64
+	SeasonID int64
+	Region   string
+	Sort     string
+	Limit    int
+}
+
+func ValidateLeaderboardFilter(v *validator.Validator, f LeaderboardFilter) {
+	v.Check(validator.In(f.Type, LeaderboardPlayers, LeaderboardTeams), "type", "must be player or team")
+	v.Check(f.GameID > 0, "game", "must be provided")
+	v.Check(f.SeasonID >= 0, "season", "must not be negative")
+	v.Check(len(f.Region) <= 32, "region", "must not be more than 32 bytes long")
+
+	_, ok := leaderboardSorts[f.Sort]
+	v.Check(ok, "sort", "must be elo, glicko2, prize_money or wins")
+
+	v.Check(f.Limit > 0 && f.Limit <= 100, "limit", "must be between 1 and 100")
+}
+
+// LeaderboardCursor marks the last entry of a page, so that the next page
+// carries on after it however the leaderboard changed in between.
+type LeaderboardCursor struct {
+	Value float64 `json:"v"`
+	ID    int64   `json:"id"`
+	Rank  int     `json:"n"`
+}
+
+func (c *LeaderboardCursor) Encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func DecodeLeaderboardCursor(s string) (*LeaderboardCursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor LeaderboardCursor
+
+	err = json.Unmarshal(js, &cursor)
+	if err != nil || cursor.ID < 1 || cursor.Rank < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+type LeaderboardModel struct {
+	DB *sql.DB
+}
+
+// Get returns a page of the leaderboard, starting after the cursor if there
+// is one, and the cursor of the next page if there are more entries. Entries
+// without a value to rank by, such as players without a rating in the
+// season, are left out.
+func (m LeaderboardModel) Get(f LeaderboardFilter, after *LeaderboardCursor) ([]*LeaderboardEntry, *LeaderboardCursor, error) {
+	column := leaderboardSorts[f.Sort]
+
+	query := `
+		SELECT entity_id, name, region, elo_rating, glicko2_rating, matches, tournaments, wins,
+			best_placement, prize_money, ` + column + `::double precision
+		FROM leaderboards
+		WHERE entity_type = $1 AND games_id = $2 AND seasons_id = $3
+		AND ($4 = '' OR region = $4)
+		AND ` + column + ` IS NOT NULL
+		AND ($5 = 0 OR ` + column + ` < $6 OR (` + column + ` = $6 AND entity_id > $5))
+		ORDER BY ` + column + ` DESC, entity_id
+		LIMIT $7`
+
+	var afterID int64
+	var afterValue float64
+	rank := 0
+
+	if after != nil {
+		afterID, afterValue, rank = after.ID, after.Value, after.Rank
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, f.Type, f.GameID, f.SeasonID, f.Region, afterID, afterValue, f.Limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*LeaderboardEntry{}
+	var next *LeaderboardCursor
+
+	for rows.Next() {
+		var entry LeaderboardEntry
+		var id int64
+		var value float64
+
+		err := rows.Scan(
+			&id,
+			&entry.Name,
+			&entry.Region,
+			&entry.EloRating,
+			&entry.Glicko2Rating,
+			&entry.Matches,
+			&entry.Tournaments,
+			&entry.Wins,
+			&entry.BestPlacement,
+			&entry.PrizeMoney,
+			&value,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(entries) == f.Limit {
+			last := entries[len(entries)-1]
+			next = &LeaderboardCursor{Value: afterValue, ID: afterID, Rank: last.Rank}
+			break
+		}
+
+		rank++
+		entry.Rank = rank
+
+		if f.Type == LeaderboardTeams {
+			entry.TeamID = id
+		} else {
+			entry.UserID = id
+		}
+
+		afterID, afterValue = id, value
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return entries, next, nil
+}
+
+// Refresh rebuilds the leaderboards from the current ratings, placements and
+// prizes. Reads carry on against the previous leaderboards meanwhile.
+func (m LeaderboardModel) Refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY leaderboards`)
+	return err
+}
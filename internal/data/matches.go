@@ -3,87 +3,429 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"hash/fnv"
 	"time"
 
 	"github.com/WrastAct/maestro/internal/validator"
 )
 
+const (
+	MatchScheduled = "scheduled"
+	MatchLive      = "live"
+	MatchFinished  = "finished"
+	MatchForfeit   = "forfeit"
+	MatchNoShow    = "no_show"
+)
+
+var (
+	ErrScheduleConflict = errors.New("schedule conflict")
+)
+
+// MatchMap is the result of a single map or game within a series.
+type MatchMap struct {
+	Number              int             `json:"number"`
+	Name                string          `json:"name"`
+	HomeScore           int             `json:"home_score"`
+	AwayScore           int             `json:"away_score"`
+	WinnerParticipantID int64           `json:"winner_participant_id,omitempty"`
+	Extras              json.RawMessage `json:"extras,omitempty"`
+}
+
 type Match struct {
-	ID           int64  `json:"id"`
-	TournamentID int64  `json:"tournament_id"`
-	Matchdata    string `json:"data"`
+	ID                  int64           `json:"id"`
+	TournamentID        int64           `json:"tournament_id"`
+	HomeParticipantID   int64           `json:"home_participant_id,omitempty"`
+	AwayParticipantID   int64           `json:"away_participant_id,omitempty"`
+	Stage               string          `json:"stage"`
+	ScheduledAt         *time.Time      `json:"scheduled_at,omitempty"`
+	TimeZone            string          `json:"time_zone"`
+	EstimatedMinutes    int             `json:"estimated_minutes"`
+	StationID           int64           `json:"station_id,omitempty"`
+	Venue               string          `json:"venue"`
+	Station             string          `json:"station"`
+	Status              string          `json:"status"`
+	HomeScore           int             `json:"home_score"`
+	AwayScore           int             `json:"away_score"`
+	WinnerParticipantID int64           `json:"winner_participant_id,omitempty"`
+	Maps                []MatchMap      `json:"maps,omitempty"`
+	Extras              json.RawMessage `json:"extras"`
+	SchemaVersion       int             `json:"schema_version,omitempty"`
+	Sequence            int             `json:"-"`
+	Version             int             `json:"version"`
+}
+
+// IsDecided reports whether the match has reached a final result.
+func (match *Match) IsDecided() bool {
+	return validator.In(match.Status, MatchFinished, MatchForfeit, MatchNoShow)
+}
+
+// IsLegacy reports whether the match was carried over from the free-form
+// records that predate structured results. Those were taken to be finished
+// without anyone knowing who played them.
+func (match *Match) IsLegacy() bool {
+	if match.HomeParticipantID != 0 || match.AwayParticipantID != 0 {
+		return false
+	}
+
+	var extras map[string]json.RawMessage
+	if json.Unmarshal(match.Extras, &extras) != nil {
+		return false
+	}
+
+	_, ok := extras["legacy_data"]
+	return ok
+}
+
+// DeriveWinner fills in the winner of a finished match and of each of its
+// maps from the scores, unless a winner was given explicitly. Drawn matches
+// are left without a winner.
+func (match *Match) DeriveWinner() {
+	for i := range match.Maps {
+		mp := &match.Maps[i]
+		if mp.WinnerParticipantID == 0 {
+			mp.WinnerParticipantID = winnerOf(match, mp.HomeScore, mp.AwayScore)
+		}
+	}
+
+	if match.WinnerParticipantID == 0 && match.Status == MatchFinished {
+		match.WinnerParticipantID = winnerOf(match, match.HomeScore, match.AwayScore)
+	}
+}
+
+func winnerOf(match *Match, home, away int) int64 {
+	switch {
+	case home > away:
+		return match.HomeParticipantID
+	case away > home:
+		return match.AwayParticipantID
+	default:
+		return 0
+	}
+}
+
+// EndsAt is the estimated end of a scheduled match.
+func (match *Match) EndsAt() time.Time {
+	if match.ScheduledAt == nil {
+		return time.Time{}
+	}
+	return match.ScheduledAt.Add(time.Duration(match.EstimatedMinutes) * time.Minute)
+}
+
+// localize presents the scheduled time in the match's own time zone.
+func (match *Match) localize() {
+	if match.ScheduledAt == nil {
+		return
+	}
+	loc, err := time.LoadLocation(match.TimeZone)
+	if err != nil {
+		return
+	}
+	t := match.ScheduledAt.In(loc)
+	match.ScheduledAt = &t
+}
+
+// ScheduleConflict describes an already scheduled match that overlaps with
+// the one being scheduled.
+type ScheduleConflict struct {
+	MatchID      int64     `json:"match_id"`
+	TournamentID int64     `json:"tournament_id"`
+	ScheduledAt  time.Time `json:"scheduled_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	Station      bool      `json:"station"`
+	Participants bool      `json:"participants"`
 }
 
 type MatchModel struct {
 	DB *sql.DB
 }
 
-func ValidateMatch(v *validator.Validator, match *Match) {
+// ValidateMatch checks the match and, if the game defines one, validates its
+// extras against the game's match schema.
+func ValidateMatch(v *validator.Validator, match *Match, schema *GameSchema) {
 	v.Check(match.TournamentID > 0, "tournament_id", "must be greater than 0")
-	v.Check(len(match.Matchdata) > 0, "data", "must be included")
+	v.Check(match.HomeParticipantID == 0 || match.HomeParticipantID != match.AwayParticipantID, "away_participant_id", "must differ from home_participant_id")
+	v.Check(len(match.Stage) <= 64, "stage", "must not be more than 64 bytes long")
+	ValidateSchedule(v, match)
+	ValidateMatchResult(v, match)
+
+	if schema != nil && v.Valid() {
+		validatePayload(v, "extras", match.Extras, schema.MatchSchema)
+	}
+}
+
+func ValidateMatchResult(v *validator.Validator, match *Match) {
+	sides := []int64{match.HomeParticipantID, match.AwayParticipantID}
+
+	v.Check(validator.In(match.Status, MatchScheduled, MatchLive, MatchFinished, MatchForfeit, MatchNoShow), "status", "must be one of scheduled, live, finished, forfeit or no_show")
+	v.Check(match.HomeScore >= 0 && match.AwayScore >= 0, "score", "must not be negative")
+	v.Check(match.WinnerParticipantID == 0 || validator.InInts(match.WinnerParticipantID, sides...), "winner_participant_id", "must be one of the match participants")
+	v.Check(match.Status == MatchScheduled || (match.HomeParticipantID > 0 && match.AwayParticipantID > 0) || match.IsLegacy(), "status", "requires both participants to be set")
+	v.Check(!validator.In(match.Status, MatchForfeit, MatchNoShow) || match.WinnerParticipantID > 0, "winner_participant_id", "must be provided for a forfeit or no-show")
+	v.Check(isJSONObject(match.Extras), "extras", "must be a JSON object")
+
+	numbers := make(map[int]bool)
+	for _, mp := range match.Maps {
+		v.Check(mp.Number > 0, "maps", "map numbers must be greater than 0")
+		v.Check(!numbers[mp.Number], "maps", "map numbers must be unique")
+		v.Check(len(mp.Name) <= 100, "maps", "map names must not be more than 100 bytes long")
+		v.Check(mp.HomeScore >= 0 && mp.AwayScore >= 0, "maps", "scores must not be negative")
+		v.Check(mp.WinnerParticipantID == 0 || validator.InInts(mp.WinnerParticipantID, sides...), "maps", "winners must be one of the match participants")
+		v.Check(len(mp.Extras) == 0 || isJSONObject(mp.Extras), "maps", "extras must be a JSON object")
+		numbers[mp.Number] = true
+	}
+}
+
+func isJSONObject(raw json.RawMessage) bool {
+	var obj map[string]interface{}
+	return json.Unmarshal(raw, &obj) == nil && obj != nil
+}
+
+// maxEstimatedMinutes is the longest a match may be expected to last.
+const maxEstimatedMinutes = 24 * 60
+
+func ValidateSchedule(v *validator.Validator, match *Match) {
+	_, err := time.LoadLocation(match.TimeZone)
+	v.Check(match.TimeZone != "" && err == nil, "time_zone", "must be a valid IANA time zone")
+	v.Check(match.EstimatedMinutes > 0, "estimated_minutes", "must be greater than 0")
+	v.Check(match.EstimatedMinutes <= maxEstimatedMinutes, "estimated_minutes", "must not be more than a day")
+	v.Check(match.StationID >= 0, "station_id", "must not be negative")
 }
 
 func (m MatchModel) Insert(match *Match) error {
 	query := `
-		INSERT INTO matches (tournaments_id, match_data)
-		VALUES ($1, $2)
-		RETURNING matches_id`
+		INSERT INTO matches (tournaments_id, home_participant_id, away_participant_id, stage, time_zone,
+			estimated_minutes, stations_id, status, home_score, away_score, winner_participant_id, extras,
+			schema_version, finished_at)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4, $5, $6, NULLIF($7, 0), $8, $9, $10, NULLIF($11, 0), $12,
+			NULLIF($13, 0), CASE WHEN $8 = 'finished' THEN NOW() END)
+		RETURNING matches_id, version`
 
+	args := []interface{}{
+		match.TournamentID,
+		match.HomeParticipantID,
+		match.AwayParticipantID,
+		match.Stage,
+		match.TimeZone,
+		match.EstimatedMinutes,
+		match.StationID,
+		match.Status,
+		match.HomeScore,
+		match.AwayScore,
+		match.WinnerParticipantID,
+		[]byte(match.Extras),
+		match.SchemaVersion,
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, match.TournamentID, match.Matchdata).Scan(&match.ID)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&match.ID, &match.Version)
+	if err != nil {
+		return err
+	}
+
+	err = replaceMaps(ctx, tx, match)
+	if err != nil {
+		return err
+	}
+
+	err = nameStation(ctx, tx, match)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m MatchModel) GetAll() ([]*Match, error) {
+// nameStation fills in the names of the match's station and its venue.
+func nameStation(ctx context.Context, q querier, match *Match) error {
+	match.Venue, match.Station = "", ""
+
+	if match.StationID == 0 {
+		return nil
+	}
+
 	query := `
-		SELECT matches_id, tournaments_id, match_data
-		FROM matches`
+		SELECT v.venues_name, s.stations_name
+		FROM stations s
+		INNER JOIN venues v ON v.venues_id = s.venues_id
+		WHERE s.stations_id = $1`
+
+	return q.QueryRowContext(ctx, query, match.StationID).Scan(&match.Venue, &match.Station)
+}
+
+func (m MatchModel) Get(id int64) (*Match, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT m.matches_id, m.tournaments_id, COALESCE(m.home_participant_id, 0),
+			COALESCE(m.away_participant_id, 0), m.stage, m.scheduled_at, m.time_zone, m.estimated_minutes,
+			COALESCE(m.stations_id, 0), COALESCE(v.venues_name, ''), COALESCE(s.stations_name, ''), m.status,
+			m.home_score, m.away_score, COALESCE(m.winner_participant_id, 0), m.extras,
+			COALESCE(m.schema_version, 0), m.sequence, m.version
+		FROM matches m
+		LEFT JOIN stations s ON s.stations_id = m.stations_id
+		LEFT JOIN venues v ON v.venues_id = s.venues_id
+		WHERE m.matches_id = $1`
+
+	var match Match
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&match.ID,
+		&match.TournamentID,
+		&match.HomeParticipantID,
+		&match.AwayParticipantID,
+		&match.Stage,
+		&match.ScheduledAt,
+		&match.TimeZone,
+		&match.EstimatedMinutes,
+		&match.StationID,
+		&match.Venue,
+		&match.Station,
+		&match.Status,
+		&match.HomeScore,
+		&match.AwayScore,
+		&match.WinnerParticipantID,
+		(*[]byte)(&match.Extras),
+		&match.SchemaVersion,
+		&match.Sequence,
+		&match.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	match.localize()
+
+	match.Maps, err = m.GetMaps(match.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &match, nil
+}
+
+func (m MatchModel) GetMaps(matchID int64) ([]MatchMap, error) {
+	query := `
+		SELECT map_number, map_name, home_score, away_score, COALESCE(winner_participant_id, 0), extras
+		FROM matches_maps
+		WHERE matches_id = $1
+		ORDER BY map_number`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, matchID)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	matches := []*Match{}
+	maps := []MatchMap{}
 
 	for rows.Next() {
-		var match Match
+		var mp MatchMap
 
 		err := rows.Scan(
-			&match.ID,
-			&match.TournamentID,
-			&match.Matchdata,
+			&mp.Number,
+			&mp.Name,
+			&mp.HomeScore,
+			&mp.AwayScore,
+			&mp.WinnerParticipantID,
+			(*[]byte)(&mp.Extras),
 		)
 		if err != nil {
 			return nil, err
 		}
 
-		matches = append(matches, &match)
+		maps = append(maps, mp)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return matches, nil
+	return maps, nil
+}
+
+// replaceMaps swaps the stored per-map breakdown of a match for match.Maps.
+func replaceMaps(ctx context.Context, tx *sql.Tx, match *Match) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM matches_maps WHERE matches_id = $1`, match.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, mp := range match.Maps {
+		extras := []byte(mp.Extras)
+		if len(extras) == 0 {
+			extras = []byte("{}")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO matches_maps (matches_id, map_number, map_name, home_score, away_score,
+				winner_participant_id, extras)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7)`,
+			match.ID, mp.Number, mp.Name, mp.HomeScore, mp.AwayScore, mp.WinnerParticipantID, extras)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m MatchModel) GetAll() ([]*Match, error) {
+	query := `
+		SELECT m.matches_id, m.tournaments_id, COALESCE(m.home_participant_id, 0),
+			COALESCE(m.away_participant_id, 0), m.stage, m.scheduled_at, m.time_zone, m.estimated_minutes,
+			COALESCE(m.stations_id, 0), COALESCE(v.venues_name, ''), COALESCE(s.stations_name, ''), m.status,
+			m.home_score, m.away_score, COALESCE(m.winner_participant_id, 0), m.extras,
+			COALESCE(m.schema_version, 0), m.sequence, m.version
+		FROM matches m
+		LEFT JOIN stations s ON s.stations_id = m.stations_id
+		LEFT JOIN venues v ON v.venues_id = s.venues_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMatches(rows)
 }
 
 func (m MatchModel) GetByTournamentID(tournamentID int64) ([]*Match, error) {
 	query := `
-		SELECT tournaments_id, matches_id, match_data
-		FROM matches
-		WHERE tournaments_id = $1`
+		SELECT m.matches_id, m.tournaments_id, COALESCE(m.home_participant_id, 0),
+			COALESCE(m.away_participant_id, 0), m.stage, m.scheduled_at, m.time_zone, m.estimated_minutes,
+			COALESCE(m.stations_id, 0), COALESCE(v.venues_name, ''), COALESCE(s.stations_name, ''), m.status,
+			m.home_score, m.away_score, COALESCE(m.winner_participant_id, 0), m.extras,
+			COALESCE(m.schema_version, 0), m.sequence, m.version
+		FROM matches m
+		LEFT JOIN stations s ON s.stations_id = m.stations_id
+		LEFT JOIN venues v ON v.venues_id = s.venues_id
+		WHERE m.tournaments_id = $1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -93,6 +435,60 @@ func (m MatchModel) GetByTournamentID(tournamentID int64) ([]*Match, error) {
 		return nil, err
 	}
 
+	return scanMatches(rows)
+}
+
+// GetScheduled returns every match, across all tournaments, that starts in
+// the half-open interval [from, to), ordered by start time.
+func (m MatchModel) GetScheduled(from, to time.Time) ([]*Match, error) {
+	query := `
+		SELECT m.matches_id, m.tournaments_id, COALESCE(m.home_participant_id, 0),
+			COALESCE(m.away_participant_id, 0), m.stage, m.scheduled_at, m.time_zone, m.estimated_minutes,
+			COALESCE(m.stations_id, 0), COALESCE(v.venues_name, ''), COALESCE(s.stations_name, ''), m.status,
+			m.home_score, m.away_score, COALESCE(m.winner_participant_id, 0), m.extras,
+			COALESCE(m.schema_version, 0), m.sequence, m.version
+		FROM matches m
+		LEFT JOIN stations s ON s.stations_id = m.stations_id
+		LEFT JOIN venues v ON v.venues_id = s.venues_id
+		WHERE m.scheduled_at >= $1 AND m.scheduled_at < $2
+		ORDER BY m.scheduled_at, m.matches_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMatches(rows)
+}
+
+// GetLiveAtStation returns the matches being played at a station.
+func (m MatchModel) GetLiveAtStation(stationID int64) ([]*Match, error) {
+	query := `
+		SELECT m.matches_id, m.tournaments_id, COALESCE(m.home_participant_id, 0),
+			COALESCE(m.away_participant_id, 0), m.stage, m.scheduled_at, m.time_zone, m.estimated_minutes,
+			COALESCE(m.stations_id, 0), COALESCE(v.venues_name, ''), COALESCE(s.stations_name, ''), m.status,
+			m.home_score, m.away_score, COALESCE(m.winner_participant_id, 0), m.extras,
+			COALESCE(m.schema_version, 0), m.sequence, m.version
+		FROM matches m
+		LEFT JOIN stations s ON s.stations_id = m.stations_id
+		LEFT JOIN venues v ON v.venues_id = s.venues_id
+		WHERE m.stations_id = $1 AND m.status = 'live'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, stationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMatches(rows)
+}
+
+func scanMatches(rows *sql.Rows) ([]*Match, error) {
 	defer rows.Close()
 
 	matches := []*Match{}
@@ -101,37 +497,78 @@ func (m MatchModel) GetByTournamentID(tournamentID int64) ([]*Match, error) {
 		var match Match
 
 		err := rows.Scan(
-			&match.TournamentID,
 			&match.ID,
-			&match.Matchdata,
+			&match.TournamentID,
+			&match.HomeParticipantID,
+			&match.AwayParticipantID,
+			&match.Stage,
+			&match.ScheduledAt,
+			&match.TimeZone,
+			&match.EstimatedMinutes,
+			&match.StationID,
+			&match.Venue,
+			&match.Station,
+			&match.Status,
+			&match.HomeScore,
+			&match.AwayScore,
+			&match.WinnerParticipantID,
+			(*[]byte)(&match.Extras),
+			&match.SchemaVersion,
+			&match.Sequence,
+			&match.Version,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		match.localize()
+
 		matches = append(matches, &match)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return matches, nil
 }
 
+// Update stores the participants and result of the match together with its
+// per-map breakdown. Only a decided match keeps a winner, and only a finished
+// one a finish time. Scheduling fields are changed through Schedule instead.
 func (m MatchModel) Update(match *Match) error {
 	query := `
 		UPDATE matches
-		SET match_data = $1
-		WHERE matches_id = $2`
+		SET home_participant_id = NULLIF($1, 0), away_participant_id = NULLIF($2, 0), stage = $3,
+			status = $4, home_score = $5, away_score = $6,
+			winner_participant_id = CASE WHEN $4 IN ('finished', 'forfeit', 'no_show') THEN NULLIF($7, 0) END,
+			extras = $8, finished_at = CASE WHEN $4 = 'finished' THEN COALESCE(finished_at, NOW()) END,
+			version = version + 1
+		WHERE matches_id = $9 AND version = $10
+		RETURNING version`
 
 	args := []interface{}{
-		match.Matchdata,
+		match.HomeParticipantID,
+		match.AwayParticipantID,
+		match.Stage,
+		match.Status,
+		match.HomeScore,
+		match.AwayScore,
+		match.WinnerParticipantID,
+		[]byte(match.Extras),
 		match.ID,
+		match.Version,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&match.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -140,22 +577,219 @@ func (m MatchModel) Update(match *Match) error {
 			return err
 		}
 	}
-	return nil
+
+	err = replaceMaps(ctx, tx, match)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scheduleLockName names the advisory lock that serialises all scheduling
+// writes, so that two matches can't be booked into the same slot by
+// concurrent requests.
+const scheduleLockName = "matches.schedule"
+
+// scheduleLockKey is the advisory lock key derived from scheduleLockName.
+var scheduleLockKey = func() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(scheduleLockName))
+	return int64(h.Sum64())
+}()
+
+// Schedule stores the match's schedule and station. The match is
+// rejected with ErrScheduleConflict, and the overlapping matches returned, if
+// any of its participants, their players or its station are already booked
+// for an overlapping period.
+func (m MatchModel) Schedule(match *Match) ([]*ScheduleConflict, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, scheduleLockKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if match.ScheduledAt != nil {
+		conflicts, err := findConflicts(ctx, tx, match)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(conflicts) > 0 {
+			return conflicts, ErrScheduleConflict
+		}
+	}
+
+	query := `
+		UPDATE matches
+		SET scheduled_at = $1, time_zone = $2, estimated_minutes = $3, stations_id = NULLIF($4, 0),
+			stage = $5, version = version + 1,
+			sequence = CASE
+				WHEN scheduled_at IS DISTINCT FROM $1 OR estimated_minutes <> $3
+					OR stations_id IS DISTINCT FROM NULLIF($4, 0) THEN sequence + 1
+				ELSE sequence
+			END
+		WHERE matches_id = $6 AND version = $7
+		RETURNING sequence, version`
+
+	args := []interface{}{
+		match.ScheduledAt,
+		match.TimeZone,
+		match.EstimatedMinutes,
+		match.StationID,
+		match.Stage,
+		match.ID,
+		match.Version,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&match.Sequence, &match.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	err = nameStation(ctx, tx, match)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	match.localize()
+
+	return nil, nil
+}
+
+// findConflicts looks for scheduled matches overlapping the given one that
+// either use the same station or share a team or a player with it. Players
+// are taken from the matches' player records and from the rosters of the
+// teams taking part on the day each match is played. Only matches starting
+// within maxEstimatedMinutes before the slot can overlap it, which keeps the
+// search to the slot's neighbourhood.
+func findConflicts(ctx context.Context, tx *sql.Tx, match *Match) ([]*ScheduleConflict, error) {
+	query := `
+		WITH overlapping AS (
+			SELECT m.matches_id, m.tournaments_id, m.scheduled_at, m.estimated_minutes, m.stations_id,
+				m.home_participant_id, m.away_participant_id
+			FROM matches m
+			WHERE m.matches_id <> $1
+			AND m.scheduled_at > $2::timestamptz - make_interval(mins => $7)
+			AND m.scheduled_at < $3
+			AND m.scheduled_at + make_interval(mins => m.estimated_minutes) > $2
+		),
+		involved AS (
+			SELECT o.matches_id, p.teams_id, COALESCE(p.users_id, tu.user_id) AS users_id
+			FROM overlapping o
+			INNER JOIN tournaments_participants p
+				ON p.participants_id IN (o.home_participant_id, o.away_participant_id)
+			LEFT JOIN teams_users tu ON tu.teams_id = p.teams_id
+				AND tu.join_date <= o.scheduled_at::date
+				AND COALESCE(tu.leave_date, 'infinity') >= o.scheduled_at::date
+			UNION
+			SELECT um.matches_id, NULL, um.users_id
+			FROM users_matches um
+			INNER JOIN overlapping o ON o.matches_id = um.matches_id
+		),
+		candidate AS (
+			SELECT p.teams_id, COALESCE(p.users_id, tu.user_id) AS users_id
+			FROM tournaments_participants p
+			LEFT JOIN teams_users tu ON tu.teams_id = p.teams_id
+				AND tu.join_date <= $2::timestamptz::date
+				AND COALESCE(tu.leave_date, 'infinity') >= $2::timestamptz::date
+			WHERE p.participants_id IN ($5, $6)
+			UNION
+			SELECT NULL, um.users_id
+			FROM users_matches um
+			WHERE um.matches_id = $1
+		)
+		SELECT o.matches_id, o.tournaments_id, o.scheduled_at,
+			o.scheduled_at + make_interval(mins => o.estimated_minutes),
+			($4 > 0 AND o.stations_id = $4),
+			EXISTS (
+				SELECT 1
+				FROM involved i
+				INNER JOIN candidate c ON i.teams_id = c.teams_id OR i.users_id = c.users_id
+				WHERE i.matches_id = o.matches_id
+			)
+		FROM overlapping o
+		ORDER BY o.scheduled_at`
+
+	args := []interface{}{
+		match.ID,
+		match.ScheduledAt,
+		match.EndsAt(),
+		match.StationID,
+		match.HomeParticipantID,
+		match.AwayParticipantID,
+		maxEstimatedMinutes,
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	conflicts := []*ScheduleConflict{}
+
+	for rows.Next() {
+		var conflict ScheduleConflict
+
+		err := rows.Scan(
+			&conflict.MatchID,
+			&conflict.TournamentID,
+			&conflict.ScheduledAt,
+			&conflict.EndsAt,
+			&conflict.Station,
+			&conflict.Participants,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if conflict.Station || conflict.Participants {
+			conflicts = append(conflicts, &conflict)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
 }
 
-func (m MatchModel) Delete(id int64) error {
+// Delete removes the match. A non-zero version makes the delete conditional
+// on the row not having changed since it was read.
+func (m MatchModel) Delete(id int64, version int) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
 		DELETE FROM matches
-		WHERE matches_id = $1`
+		WHERE matches_id = $1 AND ($2 = 0 OR version = $2)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -166,6 +800,9 @@ func (m MatchModel) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
+		if version > 0 {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 
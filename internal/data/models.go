@@ -20,6 +20,21 @@ type Models struct {
 	Tournament  TournamentModel
 	Match       MatchModel
 	UserMatch   UserMatchModel
+	Participant ParticipantModel
+	GameSchema  GameSchemaModel
+	Report      ReportModel
+	Veto        VetoModel
+	Sample      SampleModel
+	Alert       AlertModel
+	Venue       VenueModel
+	Station     StationModel
+	Device      DeviceModel
+	Consent     ConsentModel
+	Retention   RetentionModel
+	Rating      RatingModel
+	Season      SeasonModel
+	Leaderboard LeaderboardModel
+	Career      CareerModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -33,5 +48,20 @@ func NewModels(db *sql.DB) Models {
 		Tournament:  TournamentModel{DB: db},
 		Match:       MatchModel{DB: db},
 		UserMatch:   UserMatchModel{DB: db},
+		Participant: ParticipantModel{DB: db},
+		GameSchema:  GameSchemaModel{DB: db},
+		Report:      ReportModel{DB: db},
+		Veto:        VetoModel{DB: db},
+		Sample:      SampleModel{DB: db},
+		Alert:       AlertModel{DB: db},
+		Venue:       VenueModel{DB: db},
+		Station:     StationModel{DB: db},
+		Device:      DeviceModel{DB: db},
+		Consent:     ConsentModel{DB: db},
+		Retention:   RetentionModel{DB: db},
+		Rating:      RatingModel{DB: db},
+		Season:      SeasonModel{DB: db},
+		Leaderboard: LeaderboardModel{DB: db},
+		Career:      CareerModel{DB: db},
 	}
 }
@@ -0,0 +1,345 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateParticipant = errors.New("duplicate participant")
+)
+
+type Participant struct {
+	ID                int64   `json:"id"`
+	TournamentID      int64   `json:"tournament_id"`
+	TeamID            int64   `json:"team_id,omitempty"`
+	UserID            int64   `json:"user_id,omitempty"`
+	Region            string  `json:"region"`
+	Group             string  `json:"group"`
+	Rating            float64 `json:"rating"`
+	Seed              int     `json:"seed,omitempty"`
+	Placement         int     `json:"placement,omitempty"`
+	PreviousPlacement int     `json:"previous_placement,omitempty"`
+}
+
+func ValidateParticipant(v *validator.Validator, participant *Participant) {
+	v.Check(participant.TournamentID > 0, "tournament_id", "must be greater than 0")
+	v.Check((participant.TeamID > 0) != (participant.UserID > 0), "team_id", "exactly one of team_id or user_id must be provided")
+	v.Check(len(participant.Region) <= 32, "region", "must not be more than 32 bytes long")
+	v.Check(len(participant.Group) <= 32, "group", "must not be more than 32 bytes long")
+	v.Check(participant.Rating >= 0, "rating", "must not be negative")
+}
+
+type ParticipantModel struct {
+	DB *sql.DB
+}
+
+func (m ParticipantModel) Insert(participant *Participant) error {
+	query := `
+		INSERT INTO tournaments_participants (tournaments_id, teams_id, users_id, region, group_name, rating)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4, $5, $6)
+		RETURNING participants_id`
+
+	args := []interface{}{
+		participant.TournamentID,
+		participant.TeamID,
+		participant.UserID,
+		participant.Region,
+		participant.Group,
+		participant.Rating,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&participant.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tournaments_participants_tournaments_id_teams_id_key"`,
+			err.Error() == `pq: duplicate key value violates unique constraint "tournaments_participants_tournaments_id_users_id_key"`:
+			return ErrDuplicateParticipant
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllByTournament returns the participants ordered by seed. The previous
+// placement is the one from the participant's latest finished tournament in
+// the same game.
+func (m ParticipantModel) GetAllByTournament(tournamentID int64) ([]*Participant, error) {
+	query := `
+		SELECT p.participants_id, p.tournaments_id, COALESCE(p.teams_id, 0), COALESCE(p.users_id, 0),
+			p.region, p.group_name, p.rating, COALESCE(p.seed, 0), COALESCE(p.placement, 0),
+			COALESCE((
+				SELECT prev.placement
+				FROM tournaments_participants prev
+				INNER JOIN tournaments pt ON pt.tournaments_id = prev.tournaments_id
+				WHERE prev.placement IS NOT NULL
+				AND prev.tournaments_id <> p.tournaments_id
+				AND pt.games_id = t.games_id
+				AND pt.end_date <= t.start_date
+				AND (prev.teams_id = p.teams_id OR prev.users_id = p.users_id)
+				ORDER BY pt.end_date DESC
+				LIMIT 1
+			), 0)
+		FROM tournaments_participants p
+		INNER JOIN tournaments t ON t.tournaments_id = p.tournaments_id
+		WHERE p.tournaments_id = $1
+		ORDER BY p.seed NULLS LAST, p.participants_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tournamentID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	participants := []*Participant{}
+
+	for rows.Next() {
+		var participant Participant
+
+		err := rows.Scan(
+			&participant.ID,
+			&participant.TournamentID,
+			&participant.TeamID,
+			&participant.UserID,
+			&participant.Region,
+			&participant.Group,
+			&participant.Rating,
+			&participant.Seed,
+			&participant.Placement,
+			&participant.PreviousPlacement,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		participants = append(participants, &participant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return participants, nil
+}
+
+// UpdateSeeds replaces all seeds of a tournament in a single transaction.
+// Seeds are cleared first so the unique constraint is not tripped while
+// participants swap places.
+func (m ParticipantModel) UpdateSeeds(tournamentID int64, seeds map[int64]int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tournaments_participants
+		SET seed = NULL
+		WHERE tournaments_id = $1`, tournamentID)
+	if err != nil {
+		return err
+	}
+
+	for participantID, seed := range seeds {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE tournaments_participants
+			SET seed = $1
+			WHERE participants_id = $2 AND tournaments_id = $3`, seed, participantID, tournamentID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m ParticipantModel) Delete(tournamentID, participantID int64) error {
+	if participantID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM tournaments_participants
+		WHERE participants_id = $1 AND tournaments_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, participantID, tournamentID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetEmailsByTournament returns the addresses of every player taking part in
+// the tournament, either directly or as a current member of a registered team.
+func (m ParticipantModel) GetEmailsByTournament(tournamentID int64) ([]string, error) {
+	query := `
+		SELECT DISTINCT u.email
+		FROM tournaments_participants p
+		LEFT JOIN teams_users tu ON tu.teams_id = p.teams_id
+			AND (tu.leave_date IS NULL OR tu.leave_date >= CURRENT_DATE)
+		INNER JOIN users u ON u.users_id = COALESCE(p.users_id, tu.user_id)
+		WHERE p.tournaments_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tournamentID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	emails := []string{}
+
+	for rows.Next() {
+		var email string
+
+		err := rows.Scan(&email)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// IsTeamLocked reports whether the team is registered for a tournament that is
+// currently live, in which case its roster must not change.
+func (m ParticipantModel) IsTeamLocked(teamID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM tournaments_participants p
+			INNER JOIN tournaments t ON t.tournaments_id = p.tournaments_id
+			WHERE p.teams_id = $1 AND t.status = 'live'
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var locked bool
+
+	err := m.DB.QueryRowContext(ctx, query, teamID).Scan(&locked)
+	if err != nil {
+		return false, err
+	}
+
+	return locked, nil
+}
+
+// IsEntered reports whether the user is in the tournament, on their own or as
+// a current member of a participating team.
+func (m ParticipantModel) IsEntered(tournamentID, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM tournaments_participants p
+			LEFT JOIN teams_users tu ON tu.teams_id = p.teams_id AND tu.user_id = $2
+				AND tu.join_date <= CURRENT_DATE
+				AND (tu.leave_date IS NULL OR tu.leave_date >= CURRENT_DATE)
+			WHERE p.tournaments_id = $1
+			AND (p.users_id = $2 OR tu.user_id IS NOT NULL)
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entered bool
+
+	err := m.DB.QueryRowContext(ctx, query, tournamentID, userID).Scan(&entered)
+	return entered, err
+}
+
+// CaptainedBy returns which of the given participants the user speaks for:
+// the user themself for individual entries, or a team they currently
+// captain.
+func (m ParticipantModel) CaptainedBy(userID int64, participantIDs ...int64) ([]int64, error) {
+	query := `
+		SELECT p.participants_id
+		FROM tournaments_participants p
+		WHERE p.participants_id = ANY($1)
+		AND (
+			p.users_id = $2
+			OR EXISTS (
+				SELECT 1 FROM teams_users tu
+				WHERE tu.teams_id = p.teams_id
+				AND tu.user_id = $2
+				AND tu.role = 'captain'
+				AND (tu.leave_date IS NULL OR tu.leave_date >= CURRENT_DATE)
+			)
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(participantIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,735 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/rating"
+
+	"github.com/lib/pq"
+)
+
+// Rating is the current skill rating of a player or team in one game under
+// one rating system. A Glicko-2 deviation is shown grown for the time since
+// the last match.
+type Rating struct {
+	GameID       int64     `json:"game_id"`
+	System       string    `json:"system"`
+	UserID       int64     `json:"user_id,omitempty"`
+	TeamID       int64     `json:"team_id,omitempty"`
+	Name         string    `json:"name"`
+	Rating       float64   `json:"rating"`
+	Deviation    float64   `json:"deviation,omitempty"`
+	Volatility   float64   `json:"volatility,omitempty"`
+	Matches      int       `json:"matches"`
+	LastPlayedAt time.Time `json:"last_played_at"`
+}
+
+// RatingChange is a rating as it stood after one match.
+type RatingChange struct {
+	MatchID    int64     `json:"match_id"`
+	PlayedAt   time.Time `json:"played_at"`
+	Rating     float64   `json:"rating"`
+	Deviation  float64   `json:"deviation,omitempty"`
+	Volatility float64   `json:"volatility,omitempty"`
+	Delta      float64   `json:"delta"`
+}
+
+type ratingKey struct {
+	system string
+	userID int64
+	teamID int64
+}
+
+type ratingEntry struct {
+	key      ratingKey
+	matchID  int64
+	playedAt time.Time
+	rating   rating.Rating
+	delta    float64
+}
+
+// ratedSide is one side of a rated match: a solo player, or a team together
+// with those of its players who recorded the match.
+type ratedSide struct {
+	userID  int64
+	teamID  int64
+	players []int64
+}
+
+func (s ratedSide) key(system string) ratingKey {
+	return ratingKey{system: system, userID: s.userID, teamID: s.teamID}
+}
+
+type ratedMatch struct {
+	id       int64
+	playedAt time.Time
+	home     ratedSide
+	away     ratedSide
+	score    float64
+}
+
+// ratingBook plays matches into ratings in memory, keeping the entries it
+// changes in the order it changed them so that writing them out is
+// deterministic.
+type ratingBook struct {
+	ratings map[ratingKey]rating.Rating
+	changed map[ratingKey]bool
+	touched []ratingKey
+	history []ratingEntry
+}
+
+func newRatingBook() *ratingBook {
+	return &ratingBook{
+		ratings: make(map[ratingKey]rating.Rating),
+		changed: make(map[ratingKey]bool),
+	}
+}
+
+func (b *ratingBook) get(key ratingKey) rating.Rating {
+	if r, ok := b.ratings[key]; ok {
+		return r
+	}
+	return rating.New(key.system)
+}
+
+func (b *ratingBook) set(key ratingKey, match ratedMatch, before, after rating.Rating) {
+	if !b.changed[key] {
+		b.changed[key] = true
+		b.touched = append(b.touched, key)
+	}
+
+	b.ratings[key] = after
+	b.history = append(b.history, ratingEntry{
+		key:      key,
+		matchID:  match.id,
+		playedAt: match.playedAt,
+		rating:   after,
+		delta:    after.Rating - before.Rating,
+	})
+}
+
+// play rates both sides of the match against each other in every system
+// and, when both are teams with players on record, each player against the
+// other team's players taken together.
+func (b *ratingBook) play(match ratedMatch) {
+	for _, system := range rating.Systems {
+		home, away := match.home.key(system), match.away.key(system)
+		h, a := b.get(home), b.get(away)
+
+		b.set(home, match, h, rating.Update(system, h, a, match.score, match.playedAt))
+		b.set(away, match, a, rating.Update(system, a, h, 1-match.score, match.playedAt))
+
+		if match.home.teamID == 0 || match.away.teamID == 0 || len(match.home.players) == 0 || len(match.away.players) == 0 {
+			continue
+		}
+
+		homePlayers := b.players(system, match.home.players)
+		awayPlayers := b.players(system, match.away.players)
+		homeAverage := averageAt(system, homePlayers, match.playedAt)
+		awayAverage := averageAt(system, awayPlayers, match.playedAt)
+
+		for i, id := range match.home.players {
+			key := ratingKey{system: system, userID: id}
+			b.set(key, match, homePlayers[i], rating.Update(system, homePlayers[i], awayAverage, match.score, match.playedAt))
+		}
+
+		for i, id := range match.away.players {
+			key := ratingKey{system: system, userID: id}
+			b.set(key, match, awayPlayers[i], rating.Update(system, awayPlayers[i], homeAverage, 1-match.score, match.playedAt))
+		}
+	}
+}
+
+func (b *ratingBook) players(system string, ids []int64) []rating.Rating {
+	ratings := make([]rating.Rating, len(ids))
+	for i, id := range ids {
+		ratings[i] = b.get(ratingKey{system: system, userID: id})
+	}
+	return ratings
+}
+
+// averageAt combines players into one opponent as of a match. Each player is
+// decayed before averaging, since the average has no time of its own for
+// Update to decay it from; the players' own ratings are left for Update.
+func averageAt(system string, ratings []rating.Rating, at time.Time) rating.Rating {
+	decayed := make([]rating.Rating, len(ratings))
+	for i, r := range ratings {
+		decayed[i] = rating.Decay(system, r, at)
+	}
+	return rating.Average(decayed)
+}
+
+type RatingModel struct {
+	DB *sql.DB
+}
+
+// RateMatch brings the ratings of the match's game up to date with the
+// match's result. A newly finished match that is the latest of its game is
+// simply played into the ratings. Anything else, a match already rated whose
+// result changed or that is no longer finished, or one played before matches
+// already rated, has the whole game replayed.
+func (m RatingModel) RateMatch(matchID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var gameID int64
+
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT t.games_id
+		FROM matches m
+		INNER JOIN tournaments t ON t.tournaments_id = m.tournaments_id
+		WHERE m.matches_id = $1`, matchID).Scan(&gameID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockGame(ctx, tx, gameID)
+	if err != nil {
+		return err
+	}
+
+	matches, err := loadRatedMatches(ctx, tx, gameID, matchID)
+	if err != nil {
+		return err
+	}
+
+	var stale bool
+
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ratings_history WHERE matches_id = $1)`, matchID).Scan(&stale)
+	if err != nil {
+		return err
+	}
+
+	if !stale && len(matches) == 1 {
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM ratings_history
+				WHERE games_id = $1 AND (played_at, matches_id) > ($2, $3)
+			)`, gameID, matches[0].playedAt, matchID).Scan(&stale)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case stale:
+		_, err = replayGame(ctx, tx, gameID)
+		if err != nil {
+			return err
+		}
+	case len(matches) == 1:
+		book, err := loadRatingBook(ctx, tx, gameID, matches[0])
+		if err != nil {
+			return err
+		}
+
+		book.play(matches[0])
+
+		err = saveRatingBook(ctx, tx, gameID, book, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Recompute throws away the ratings of the game and replays all its finished
+// matches in the order they were played. The result depends only on the
+// matches, so it is the same every time. It returns the number of matches
+// replayed.
+func (m RatingModel) Recompute(gameID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = lockGame(ctx, tx, gameID)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed, err := replayGame(ctx, tx, gameID)
+	if err != nil {
+		return 0, err
+	}
+
+	return replayed, tx.Commit()
+}
+
+// lockGame makes changes to the ratings of a game one at a time.
+func lockGame(ctx context.Context, tx *sql.Tx, gameID int64) error {
+	var id int64
+
+	err := tx.QueryRowContext(ctx, `SELECT games_id FROM games WHERE games_id = $1 FOR UPDATE`, gameID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func replayGame(ctx context.Context, tx *sql.Tx, gameID int64) (int, error) {
+	_, err := tx.ExecContext(ctx, `DELETE FROM ratings_history WHERE games_id = $1`, gameID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM ratings WHERE games_id = $1`, gameID)
+	if err != nil {
+		return 0, err
+	}
+
+	matches, err := loadRatedMatches(ctx, tx, gameID, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	book := newRatingBook()
+	for _, match := range matches {
+		book.play(match)
+	}
+
+	return len(matches), saveRatingBook(ctx, tx, gameID, book, true)
+}
+
+// loadRatedMatches returns the finished matches of the game between two
+// participants, or just the one given, in the order they were played.
+// Forfeits and no-shows are left out even though they have a winner: nothing
+// was played, so they say nothing about how strong either side is.
+func loadRatedMatches(ctx context.Context, tx *sql.Tx, gameID, matchID int64) ([]ratedMatch, error) {
+	query := `
+		SELECT m.matches_id, COALESCE(m.scheduled_at, m.finished_at),
+			COALESCE(hp.users_id, 0), COALESCE(hp.teams_id, 0),
+			COALESCE(ap.users_id, 0), COALESCE(ap.teams_id, 0),
+			CASE m.winner_participant_id
+				WHEN m.home_participant_id THEN 1
+				WHEN m.away_participant_id THEN 0
+				ELSE 0.5
+			END
+		FROM matches m
+		INNER JOIN tournaments t ON t.tournaments_id = m.tournaments_id
+		INNER JOIN tournaments_participants hp ON hp.participants_id = m.home_participant_id
+		INNER JOIN tournaments_participants ap ON ap.participants_id = m.away_participant_id
+		WHERE t.games_id = $1 AND m.status = 'finished' AND ($2 = 0 OR m.matches_id = $2)
+		ORDER BY 2, m.matches_id`
+
+	rows, err := tx.QueryContext(ctx, query, gameID, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []ratedMatch{}
+	index := make(map[int64]int)
+
+	for rows.Next() {
+		var match ratedMatch
+
+		err := rows.Scan(
+			&match.id,
+			&match.playedAt,
+			&match.home.userID,
+			&match.home.teamID,
+			&match.away.userID,
+			&match.away.teamID,
+			&match.score,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		index[match.id] = len(matches)
+		matches = append(matches, match)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The players of a team are those on its roster on the day of the match
+	// who recorded it.
+	query = `
+		SELECT DISTINCT um.matches_id, tu.teams_id, um.users_id
+		FROM users_matches um
+		INNER JOIN matches m ON m.matches_id = um.matches_id
+		INNER JOIN tournaments t ON t.tournaments_id = m.tournaments_id
+		INNER JOIN tournaments_participants p ON p.participants_id IN (m.home_participant_id, m.away_participant_id)
+		INNER JOIN teams_users tu ON tu.teams_id = p.teams_id AND tu.user_id = um.users_id
+			AND tu.join_date <= COALESCE(m.scheduled_at, m.finished_at)::date
+			AND COALESCE(tu.leave_date, 'infinity') >= COALESCE(m.scheduled_at, m.finished_at)::date
+		WHERE t.games_id = $1 AND m.status = 'finished' AND ($2 = 0 OR m.matches_id = $2)
+		ORDER BY 1, 2, 3`
+
+	rows, err = tx.QueryContext(ctx, query, gameID, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, teamID, userID int64
+
+		err := rows.Scan(&id, &teamID, &userID)
+		if err != nil {
+			return nil, err
+		}
+
+		i, ok := index[id]
+		if !ok {
+			continue
+		}
+
+		match := &matches[i]
+
+		switch teamID {
+		case match.home.teamID:
+			match.home.players = append(match.home.players, userID)
+		case match.away.teamID:
+			match.away.players = append(match.away.players, userID)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// loadRatingBook reads the current ratings of everyone taking part in the
+// match.
+func loadRatingBook(ctx context.Context, tx *sql.Tx, gameID int64, match ratedMatch) (*ratingBook, error) {
+	users := append([]int64{match.home.userID, match.away.userID}, match.home.players...)
+	users = append(users, match.away.players...)
+	teams := []int64{match.home.teamID, match.away.teamID}
+
+	query := `
+		SELECT rating_system, COALESCE(users_id, 0), COALESCE(teams_id, 0), rating, deviation,
+			volatility, matches, last_played_at
+		FROM ratings
+		WHERE games_id = $1 AND (users_id = ANY($2) OR teams_id = ANY($3))`
+
+	rows, err := tx.QueryContext(ctx, query, gameID, pq.Array(users), pq.Array(teams))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	book := newRatingBook()
+
+	for rows.Next() {
+		var key ratingKey
+		var r rating.Rating
+
+		err := rows.Scan(
+			&key.system,
+			&key.userID,
+			&key.teamID,
+			&r.Rating,
+			&r.Deviation,
+			&r.Volatility,
+			&r.Matches,
+			&r.LastPlayed,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		book.ratings[key] = r
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// saveRatingBook writes out the ratings the book changed and their history.
+// After a replay the game has no ratings left to update, so they are simply
+// copied in.
+func saveRatingBook(ctx context.Context, tx *sql.Tx, gameID int64, book *ratingBook, fresh bool) error {
+	if fresh {
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("ratings",
+			"games_id", "rating_system", "users_id", "teams_id", "rating", "deviation", "volatility", "matches", "last_played_at"))
+		if err != nil {
+			return err
+		}
+
+		for _, key := range book.touched {
+			r := book.ratings[key]
+
+			_, err = stmt.ExecContext(ctx, gameID, key.system, nullID(key.userID), nullID(key.teamID),
+				r.Rating, r.Deviation, r.Volatility, r.Matches, r.LastPlayed)
+			if err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+
+		_, err = stmt.ExecContext(ctx)
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+
+		err = stmt.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, key := range book.touched {
+			r := book.ratings[key]
+
+			target := "users_id"
+			if key.teamID > 0 {
+				target = "teams_id"
+			}
+
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO ratings (games_id, rating_system, users_id, teams_id, rating, deviation, volatility,
+					matches, last_played_at)
+				VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), $5, $6, $7, $8, $9)
+				ON CONFLICT (games_id, rating_system, `+target+`)
+				DO UPDATE SET rating = EXCLUDED.rating, deviation = EXCLUDED.deviation,
+					volatility = EXCLUDED.volatility, matches = EXCLUDED.matches,
+					last_played_at = EXCLUDED.last_played_at`,
+				gameID, key.system, key.userID, key.teamID, r.Rating, r.Deviation, r.Volatility, r.Matches, r.LastPlayed)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("ratings_history",
+		"games_id", "rating_system", "users_id", "teams_id", "matches_id", "played_at", "rating", "deviation", "volatility", "delta"))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range book.history {
+		_, err = stmt.ExecContext(ctx, gameID, entry.key.system, nullID(entry.key.userID), nullID(entry.key.teamID),
+			entry.matchID, entry.playedAt, entry.rating.Rating, entry.rating.Deviation, entry.rating.Volatility, entry.delta)
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		stmt.Close()
+		return err
+	}
+
+	return stmt.Close()
+}
+
+func nullID(id int64) interface{} {
+	if id > 0 {
+		return id
+	}
+	return nil
+}
+
+const ratingColumns = `
+	r.games_id, r.rating_system, COALESCE(r.users_id, 0), COALESCE(r.teams_id, 0),
+	COALESCE(u.users_name, t.teams_name), r.rating, r.deviation, r.volatility, r.matches, r.last_played_at`
+
+const ratingJoins = `
+	LEFT JOIN users u ON u.users_id = r.users_id
+	LEFT JOIN teams t ON t.teams_id = r.teams_id`
+
+// GetAllByGame returns the best rated players, or teams, of the game.
+func (m RatingModel) GetAllByGame(gameID int64, system string, teams bool, limit int) ([]*Rating, error) {
+	query := `
+		SELECT ` + ratingColumns + `
+		FROM ratings r` + ratingJoins + `
+		WHERE r.games_id = $1 AND r.rating_system = $2 AND (r.teams_id IS NOT NULL) = $3
+		ORDER BY r.rating DESC, r.users_id, r.teams_id
+		LIMIT $4`
+
+	return m.query(query, gameID, system, teams, limit)
+}
+
+// GetAllFor returns the ratings of a player, or a team, in every game.
+func (m RatingModel) GetAllFor(userID, teamID int64) ([]*Rating, error) {
+	query := `
+		SELECT ` + ratingColumns + `
+		FROM ratings r` + ratingJoins + `
+		WHERE r.users_id = NULLIF($1, 0) OR r.teams_id = NULLIF($2, 0)
+		ORDER BY r.games_id, r.rating_system`
+
+	return m.query(query, userID, teamID)
+}
+
+func (m RatingModel) query(query string, args ...interface{}) ([]*Rating, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	now := time.Now()
+	ratings := []*Rating{}
+
+	for rows.Next() {
+		var r Rating
+
+		err := rows.Scan(
+			&r.GameID,
+			&r.System,
+			&r.UserID,
+			&r.TeamID,
+			&r.Name,
+			&r.Rating,
+			&r.Deviation,
+			&r.Volatility,
+			&r.Matches,
+			&r.LastPlayedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		decayed := rating.Decay(r.System, rating.Rating{
+			Rating:     r.Rating,
+			Deviation:  r.Deviation,
+			Volatility: r.Volatility,
+			LastPlayed: r.LastPlayedAt,
+		}, now)
+		r.Deviation = decayed.Deviation
+
+		ratings = append(ratings, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ratings, nil
+}
+
+// GetHistory returns how a player's, or a team's, rating in a game changed
+// match by match, oldest first.
+func (m RatingModel) GetHistory(gameID int64, system string, userID, teamID int64) ([]*RatingChange, error) {
+	query := `
+		SELECT matches_id, played_at, rating, deviation, volatility, delta
+		FROM ratings_history
+		WHERE games_id = $1 AND rating_system = $2 AND (users_id = NULLIF($3, 0) OR teams_id = NULLIF($4, 0))
+		ORDER BY played_at, matches_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, gameID, system, userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	changes := []*RatingChange{}
+
+	for rows.Next() {
+		var change RatingChange
+
+		err := rows.Scan(
+			&change.MatchID,
+			&change.PlayedAt,
+			&change.Rating,
+			&change.Deviation,
+			&change.Volatility,
+			&change.Delta,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// GetForParticipants returns the rating in the tournament's game of each of
+// its participants, with the starting rating for those not yet rated.
+func (m RatingModel) GetForParticipants(tournamentID int64, system string) (map[int64]float64, error) {
+	query := `
+		SELECT p.participants_id, r.rating
+		FROM tournaments_participants p
+		INNER JOIN tournaments t ON t.tournaments_id = p.tournaments_id
+		LEFT JOIN ratings r ON r.games_id = t.games_id AND r.rating_system = $2
+			AND (r.users_id = p.users_id OR r.teams_id = p.teams_id)
+		WHERE p.tournaments_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tournamentID, system)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ratings := make(map[int64]float64)
+
+	for rows.Next() {
+		var id int64
+		var r sql.NullFloat64
+
+		err := rows.Scan(&id, &r)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.Valid {
+			ratings[id] = r.Float64
+		} else {
+			ratings[id] = rating.New(system).Rating
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ratings, nil
+}
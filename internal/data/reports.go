@@ -0,0 +1,876 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+const (
+	ReportPending      = "pending"
+	ReportConfirmed    = "confirmed"
+	ReportAutoAccepted = "auto_accepted"
+	ReportDisputed     = "disputed"
+	ReportUpheld       = "upheld"
+	ReportOverturned   = "overturned"
+	ReportVoided       = "voided"
+
+	DisputeOpen     = "open"
+	DisputeResolved = "resolved"
+
+	DecisionUphold   = "uphold"
+	DecisionOverturn = "overturn"
+	DecisionVoid     = "void"
+)
+
+var (
+	ErrOpenReport    = errors.New("match already has an open report")
+	ErrReportClosed  = errors.New("report is no longer pending")
+	ErrDisputeClosed = errors.New("dispute is already resolved")
+	ErrMatchDecided  = errors.New("match already has a result")
+)
+
+// autoAcceptBatch caps how many overdue reports a single AutoAccept run
+// settles, keeping its transaction short.
+const autoAcceptBatch = 100
+
+const (
+	reportColumns = `reports_id, matches_id, participants_id, COALESCE(reported_by, 0), status, match_status,
+		home_score, away_score, COALESCE(winner_participant_id, 0), maps, extras, confirm_by,
+		COALESCE(confirmed_by, 0), created_at, decided_at`
+
+	disputeColumns = `d.disputes_id, d.reports_id, r.matches_id, COALESCE(d.raised_by, 0), d.reason, d.status,
+		d.decision, d.resolution, COALESCE(d.referee_id, 0), d.created_at, d.resolved_at
+		FROM matches_disputes d
+		INNER JOIN matches_reports r ON r.reports_id = d.reports_id`
+)
+
+// Report is a result submitted by one side of a match. It only becomes the
+// match result once the other side confirms it, the confirmation window runs
+// out, or a referee upholds it.
+type Report struct {
+	ID                  int64           `json:"id"`
+	MatchID             int64           `json:"match_id"`
+	ParticipantID       int64           `json:"participant_id"`
+	ReportedBy          int64           `json:"reported_by"`
+	Status              string          `json:"status"`
+	MatchStatus         string          `json:"match_status"`
+	HomeScore           int             `json:"home_score"`
+	AwayScore           int             `json:"away_score"`
+	WinnerParticipantID int64           `json:"winner_participant_id,omitempty"`
+	Maps                []MatchMap      `json:"maps"`
+	Extras              json.RawMessage `json:"extras"`
+	ConfirmBy           time.Time       `json:"confirm_by"`
+	ConfirmedBy         int64           `json:"confirmed_by,omitempty"`
+	CreatedAt           time.Time       `json:"created_at"`
+	DecidedAt           *time.Time      `json:"decided_at,omitempty"`
+}
+
+// ResultFor returns a copy of match carrying the reported result, with the
+// winners derived from the scores where none were given.
+func (report *Report) ResultFor(match *Match) *Match {
+	result := *match
+	result.Status = report.MatchStatus
+	result.HomeScore = report.HomeScore
+	result.AwayScore = report.AwayScore
+	result.WinnerParticipantID = report.WinnerParticipantID
+	result.Maps = report.Maps
+	result.Extras = report.Extras
+	result.DeriveWinner()
+	return &result
+}
+
+func ValidateReport(v *validator.Validator, report *Report, result *Match, schema *GameSchema) {
+	v.Check(validator.In(report.MatchStatus, MatchFinished, MatchForfeit, MatchNoShow), "match_status", "must be one of finished, forfeit or no_show")
+	ValidateMatch(v, result, schema)
+}
+
+type Dispute struct {
+	ID         int64       `json:"id"`
+	ReportID   int64       `json:"report_id"`
+	MatchID    int64       `json:"match_id"`
+	RaisedBy   int64       `json:"raised_by"`
+	Reason     string      `json:"reason"`
+	Status     string      `json:"status"`
+	Decision   string      `json:"decision,omitempty"`
+	Resolution string      `json:"resolution,omitempty"`
+	RefereeID  int64       `json:"referee_id,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	ResolvedAt *time.Time  `json:"resolved_at,omitempty"`
+	Evidence   []*Evidence `json:"evidence,omitempty"`
+}
+
+func ValidateDispute(v *validator.Validator, dispute *Dispute) {
+	v.Check(dispute.Reason != "", "reason", "must be provided")
+	v.Check(len(dispute.Reason) <= 2000, "reason", "must not be more than 2000 bytes long")
+
+	for _, e := range dispute.Evidence {
+		ValidateEvidence(v, e)
+	}
+}
+
+func ValidateResolution(v *validator.Validator, dispute *Dispute) {
+	v.Check(validator.In(dispute.Decision, DecisionUphold, DecisionOverturn, DecisionVoid), "decision", "must be one of uphold, overturn or void")
+	v.Check(dispute.Resolution != "", "resolution", "must be provided")
+	v.Check(len(dispute.Resolution) <= 2000, "resolution", "must not be more than 2000 bytes long")
+}
+
+// Evidence is a link to a screenshot, demo or recording backing a dispute.
+type Evidence struct {
+	ID          int64     `json:"id"`
+	DisputeID   int64     `json:"dispute_id"`
+	SubmittedBy int64     `json:"submitted_by"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func ValidateEvidence(v *validator.Validator, e *Evidence) {
+	v.Check(strings.HasPrefix(e.URL, "https://") || strings.HasPrefix(e.URL, "http://"), "evidence", "urls must be http or https links")
+	v.Check(len(e.URL) <= 2000, "evidence", "urls must not be more than 2000 bytes long")
+	v.Check(len(e.Description) <= 500, "evidence", "descriptions must not be more than 500 bytes long")
+}
+
+// AuditEntry records a single step in how a match result came about.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	MatchID   int64           `json:"match_id"`
+	UserID    int64           `json:"user_id,omitempty"`
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Insert stores a pending report that the opponent has until window from now
+// to confirm or dispute. It returns ErrMatchDecided if the match has a result
+// by then.
+func (m ReportModel) Insert(report *Report, window time.Duration) error {
+	maps, err := json.Marshal(report.Maps)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO matches_reports (matches_id, participants_id, reported_by, match_status, home_score,
+			away_score, winner_participant_id, maps, extras, confirm_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8, $9, NOW() + make_interval(secs => $10))
+		RETURNING reports_id, status, confirm_by, created_at`
+
+	args := []interface{}{
+		report.MatchID,
+		report.ParticipantID,
+		report.ReportedBy,
+		report.MatchStatus,
+		report.HomeScore,
+		report.AwayScore,
+		report.WinnerParticipantID,
+		maps,
+		[]byte(report.Extras),
+		window.Seconds(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	undecided, err := lockUndecidedMatch(ctx, tx, report.MatchID)
+	if err != nil {
+		return err
+	}
+
+	if !undecided {
+		return ErrMatchDecided
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&report.ID, &report.Status, &report.ConfirmBy, &report.CreatedAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `"idx_matches_reports_open"`):
+			return ErrOpenReport
+		default:
+			return err
+		}
+	}
+
+	err = audit(ctx, tx, report.MatchID, report.ReportedBy, "result_reported", map[string]interface{}{
+		"report_id":             report.ID,
+		"participant_id":        report.ParticipantID,
+		"match_status":          report.MatchStatus,
+		"home_score":            report.HomeScore,
+		"away_score":            report.AwayScore,
+		"winner_participant_id": report.WinnerParticipantID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ReportModel) Get(id int64) (*Report, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + reportColumns + ` FROM matches_reports WHERE reports_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	reports, err := scanReports(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reports) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return reports[0], nil
+}
+
+func (m ReportModel) GetAllByMatch(matchID int64) ([]*Report, error) {
+	query := `SELECT ` + reportColumns + ` FROM matches_reports WHERE matches_id = $1 ORDER BY created_at, reports_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanReports(rows)
+}
+
+func scanReports(rows *sql.Rows) ([]*Report, error) {
+	defer rows.Close()
+
+	reports := []*Report{}
+
+	for rows.Next() {
+		var report Report
+		var maps []byte
+
+		err := rows.Scan(
+			&report.ID,
+			&report.MatchID,
+			&report.ParticipantID,
+			&report.ReportedBy,
+			&report.Status,
+			&report.MatchStatus,
+			&report.HomeScore,
+			&report.AwayScore,
+			&report.WinnerParticipantID,
+			&maps,
+			(*[]byte)(&report.Extras),
+			&report.ConfirmBy,
+			&report.ConfirmedBy,
+			&report.CreatedAt,
+			&report.DecidedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(maps, &report.Maps)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, &report)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// Confirm accepts a pending report on behalf of the opponent and makes it the
+// match result.
+func (m ReportModel) Confirm(report *Report, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = decideReport(ctx, tx, report, ReportPending, ReportConfirmed)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE matches_reports SET confirmed_by = $1 WHERE reports_id = $2`, userID, report.ID)
+	if err != nil {
+		return err
+	}
+	report.ConfirmedBy = userID
+
+	err = applyReport(ctx, tx, report)
+	if err != nil {
+		return err
+	}
+
+	err = audit(ctx, tx, report.MatchID, userID, "result_confirmed", map[string]interface{}{
+		"report_id": report.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AutoAccept makes every pending report whose confirmation window has run out
+// the result of its match and returns the accepted reports. Reports locked
+// by a concurrent confirmation or dispute are left for the next run, and
+// those whose match was given a result some other way are voided.
+func (m ReportModel) AutoAccept() ([]*Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + reportColumns + `
+		FROM matches_reports
+		WHERE status = 'pending' AND confirm_by <= NOW()
+		ORDER BY confirm_by
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.QueryContext(ctx, query, autoAcceptBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	reports, err := scanReports(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := []*Report{}
+
+	for _, report := range reports {
+		undecided, err := lockUndecidedMatch(ctx, tx, report.MatchID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !undecided {
+			err = decideReport(ctx, tx, report, ReportPending, ReportVoided)
+			if err != nil {
+				return nil, err
+			}
+
+			err = audit(ctx, tx, report.MatchID, 0, "result_report_voided", map[string]interface{}{
+				"report_id": report.ID,
+				"reason":    "match already decided",
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		err = decideReport(ctx, tx, report, ReportPending, ReportAutoAccepted)
+		if err != nil {
+			return nil, err
+		}
+
+		err = applyReport(ctx, tx, report)
+		if err != nil {
+			return nil, err
+		}
+
+		err = audit(ctx, tx, report.MatchID, 0, "result_auto_accepted", map[string]interface{}{
+			"report_id":  report.ID,
+			"confirm_by": report.ConfirmBy,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		accepted = append(accepted, report)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return accepted, nil
+}
+
+// Dispute stops the confirmation window of a pending report and opens a
+// dispute for a referee to resolve.
+func (m ReportModel) Dispute(report *Report, dispute *Dispute) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE matches_reports
+		SET status = 'disputed'
+		WHERE reports_id = $1 AND status = 'pending'`, report.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrReportClosed
+	}
+
+	report.Status = ReportDisputed
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO matches_disputes (reports_id, raised_by, reason)
+		VALUES ($1, $2, $3)
+		RETURNING disputes_id, status, created_at`,
+		report.ID, dispute.RaisedBy, dispute.Reason).Scan(&dispute.ID, &dispute.Status, &dispute.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	dispute.ReportID = report.ID
+	dispute.MatchID = report.MatchID
+
+	for _, e := range dispute.Evidence {
+		e.DisputeID = dispute.ID
+		e.SubmittedBy = dispute.RaisedBy
+
+		err = insertEvidence(ctx, tx, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = audit(ctx, tx, report.MatchID, dispute.RaisedBy, "result_disputed", map[string]interface{}{
+		"report_id":  report.ID,
+		"dispute_id": dispute.ID,
+		"reason":     dispute.Reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddEvidence attaches evidence to a dispute that is still open.
+func (m ReportModel) AddEvidence(dispute *Dispute, e *Evidence) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT status FROM matches_disputes WHERE disputes_id = $1 FOR SHARE`, dispute.ID).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if status != DisputeOpen {
+		return ErrDisputeClosed
+	}
+
+	e.DisputeID = dispute.ID
+
+	err = insertEvidence(ctx, tx, e)
+	if err != nil {
+		return err
+	}
+
+	err = audit(ctx, tx, dispute.MatchID, e.SubmittedBy, "evidence_added", map[string]interface{}{
+		"dispute_id":  dispute.ID,
+		"evidence_id": e.ID,
+		"url":         e.URL,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertEvidence(ctx context.Context, tx *sql.Tx, e *Evidence) error {
+	return tx.QueryRowContext(ctx, `
+		INSERT INTO matches_disputes_evidence (disputes_id, submitted_by, url, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING evidence_id, created_at`,
+		e.DisputeID, e.SubmittedBy, e.URL, e.Description).Scan(&e.ID, &e.CreatedAt)
+}
+
+// Resolve closes the dispute with the referee's decision. Upholding makes the
+// disputed report the match result, overturning applies the referee's own
+// result instead and voiding discards the report so that it can be reported
+// again.
+func (m ReportModel) Resolve(dispute *Dispute, report *Report, result *Report) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE matches_disputes
+		SET status = 'resolved', decision = $1, resolution = $2, referee_id = $3, resolved_at = NOW()
+		WHERE disputes_id = $4 AND status = 'open'
+		RETURNING status, resolved_at`,
+		dispute.Decision, dispute.Resolution, dispute.RefereeID, dispute.ID).Scan(&dispute.Status, &dispute.ResolvedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrDisputeClosed
+		default:
+			return err
+		}
+	}
+
+	status := map[string]string{
+		DecisionUphold:   ReportUpheld,
+		DecisionOverturn: ReportOverturned,
+		DecisionVoid:     ReportVoided,
+	}[dispute.Decision]
+
+	err = decideReport(ctx, tx, report, ReportDisputed, status)
+	if err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{
+		"report_id":  report.ID,
+		"dispute_id": dispute.ID,
+		"decision":   dispute.Decision,
+		"resolution": dispute.Resolution,
+	}
+
+	switch dispute.Decision {
+	case DecisionUphold:
+		err = applyReport(ctx, tx, report)
+	case DecisionOverturn:
+		err = applyReport(ctx, tx, result)
+		details["match_status"] = result.MatchStatus
+		details["home_score"] = result.HomeScore
+		details["away_score"] = result.AwayScore
+		details["winner_participant_id"] = result.WinnerParticipantID
+	}
+	if err != nil {
+		return err
+	}
+
+	err = audit(ctx, tx, report.MatchID, dispute.RefereeID, "dispute_resolved", details)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// decideReport moves the report from one status to a final one, failing
+// with ErrReportClosed if it was no longer in the expected status.
+func decideReport(ctx context.Context, tx *sql.Tx, report *Report, from, to string) error {
+	err := tx.QueryRowContext(ctx, `
+		UPDATE matches_reports
+		SET status = $1, decided_at = NOW()
+		WHERE reports_id = $2 AND status = $3
+		RETURNING status, decided_at`, to, report.ID, from).Scan(&report.Status, &report.DecidedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrReportClosed
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// lockUndecidedMatch locks the match for the rest of the transaction and
+// reports whether it is still waiting for a result.
+func lockUndecidedMatch(ctx context.Context, tx *sql.Tx, matchID int64) (bool, error) {
+	var undecided bool
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT status NOT IN ('finished', 'forfeit', 'no_show')
+		FROM matches
+		WHERE matches_id = $1
+		FOR UPDATE`, matchID).Scan(&undecided)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return undecided, nil
+}
+
+// applyReport writes the reported result and map breakdown to the match. A
+// match that was given a result some other way in the meantime is left as
+// it is, and the report fails with ErrReportClosed.
+func applyReport(ctx context.Context, tx *sql.Tx, report *Report) error {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE matches
+		SET status = $1, home_score = $2, away_score = $3, winner_participant_id = NULLIF($4, 0),
+			extras = $5, finished_at = CASE WHEN $1 = 'finished' THEN COALESCE(finished_at, NOW()) END,
+			version = version + 1
+		WHERE matches_id = $6 AND status NOT IN ('finished', 'forfeit', 'no_show')`,
+		report.MatchStatus, report.HomeScore, report.AwayScore, report.WinnerParticipantID,
+		[]byte(report.Extras), report.MatchID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrReportClosed
+	}
+
+	return replaceMaps(ctx, tx, &Match{ID: report.MatchID, Maps: report.Maps})
+}
+
+func audit(ctx context.Context, tx *sql.Tx, matchID, userID int64, action string, details map[string]interface{}) error {
+	js, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO matches_audit (matches_id, users_id, action, details)
+		VALUES ($1, NULLIF($2, 0), $3, $4)`, matchID, userID, action, js)
+	return err
+}
+
+func (m ReportModel) GetDispute(id int64) (*Dispute, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + disputeColumns + ` WHERE d.disputes_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	disputes, err := scanDisputes(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(disputes) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	dispute := disputes[0]
+
+	dispute.Evidence, err = m.GetEvidence(dispute.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return dispute, nil
+}
+
+// GetDisputes returns the referee queue: disputes in the given status, oldest
+// first. An empty status returns every dispute.
+func (m ReportModel) GetDisputes(status string) ([]*Dispute, error) {
+	query := `
+		SELECT ` + disputeColumns + `
+		WHERE ($1 = '' OR d.status = $1)
+		ORDER BY d.created_at, d.disputes_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDisputes(rows)
+}
+
+func scanDisputes(rows *sql.Rows) ([]*Dispute, error) {
+	defer rows.Close()
+
+	disputes := []*Dispute{}
+
+	for rows.Next() {
+		var dispute Dispute
+
+		err := rows.Scan(
+			&dispute.ID,
+			&dispute.ReportID,
+			&dispute.MatchID,
+			&dispute.RaisedBy,
+			&dispute.Reason,
+			&dispute.Status,
+			&dispute.Decision,
+			&dispute.Resolution,
+			&dispute.RefereeID,
+			&dispute.CreatedAt,
+			&dispute.ResolvedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		disputes = append(disputes, &dispute)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return disputes, nil
+}
+
+func (m ReportModel) GetEvidence(disputeID int64) ([]*Evidence, error) {
+	query := `
+		SELECT evidence_id, disputes_id, COALESCE(submitted_by, 0), url, description, created_at
+		FROM matches_disputes_evidence
+		WHERE disputes_id = $1
+		ORDER BY created_at, evidence_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, disputeID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	evidence := []*Evidence{}
+
+	for rows.Next() {
+		var e Evidence
+
+		err := rows.Scan(
+			&e.ID,
+			&e.DisputeID,
+			&e.SubmittedBy,
+			&e.URL,
+			&e.Description,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		evidence = append(evidence, &e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return evidence, nil
+}
+
+func (m ReportModel) GetAudit(matchID int64) ([]*AuditEntry, error) {
+	query := `
+		SELECT id, matches_id, COALESCE(users_id, 0), action, details, created_at
+		FROM matches_audit
+		WHERE matches_id = $1
+		ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+
+	for rows.Next() {
+		var entry AuditEntry
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.MatchID,
+			&entry.UserID,
+			&entry.Action,
+			(*[]byte)(&entry.Details),
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
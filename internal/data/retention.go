@@ -0,0 +1,321 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrPurgeRunning = errors.New("purge already running")
+
+// retentionLockKey names the advisory lock held while data is purged, so that
+// only one API instance purges at a time.
+const retentionLockKey = 7245093501
+
+// purgeBatchSize is how many rows are deleted per statement, to keep each
+// delete short and the locks it takes brief.
+const purgeBatchSize = 10000
+
+type retentionTarget struct {
+	table  string
+	column string
+}
+
+// RetentionTargets are the kinds of data that can be purged once old enough.
+// Player records and other aggregates derived from them are kept for good and
+// are not targets.
+var RetentionTargets = []string{"samples", "readings", "stress_alerts", "station_alerts", "tokens"}
+
+var retentionTargets = map[string]retentionTarget{
+	"samples":        {"match_sensor_samples", "sampled_at"},
+	"readings":       {"stations_readings", "read_at"},
+	"stress_alerts":  {"stress_alerts", "raised_at"},
+	"station_alerts": {"stations_alerts", "resolved_at"},
+	"tokens":         {"tokens", "expiry"},
+}
+
+// RetentionPolicy is how long one kind of data is kept: for MaxAge past its
+// timestamp, or forever. The timestamp of tokens is their expiry, so a MaxAge
+// of zero purges them as soon as they expire; open station alerts are never
+// purged.
+type RetentionPolicy struct {
+	Target  string
+	MaxAge  time.Duration
+	Forever bool
+}
+
+// ParseRetentionAge reads how long data is kept: "forever", a number of days
+// such as "90d", or a Go duration such as "12h".
+func ParseRetentionAge(s string) (maxAge time.Duration, forever bool, err error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case s == "forever":
+		return 0, true, nil
+	case strings.HasSuffix(s, "d"):
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid number of days %q", s)
+		}
+		maxAge = time.Duration(days) * 24 * time.Hour
+	default:
+		maxAge, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	if maxAge < 0 {
+		return 0, false, fmt.Errorf("retention %q must not be negative", s)
+	}
+
+	return maxAge, false, nil
+}
+
+// Keep describes the policy's retention the way ParseRetentionAge reads it.
+func (p RetentionPolicy) Keep() string {
+	switch {
+	case p.Forever:
+		return "forever"
+	case p.MaxAge > 0 && p.MaxAge%(24*time.Hour) == 0:
+		return strconv.Itoa(int(p.MaxAge/(24*time.Hour))) + "d"
+	default:
+		return p.MaxAge.String()
+	}
+}
+
+// IsRetentionTarget reports whether data of the named kind can be purged.
+func IsRetentionTarget(target string) bool {
+	_, ok := retentionTargets[target]
+	return ok
+}
+
+// RetentionResult is how much of one kind of data a run deleted, or would
+// have in a dry run.
+type RetentionResult struct {
+	Target  string    `json:"target"`
+	Cutoff  time.Time `json:"cutoff"`
+	Deleted int64     `json:"deleted"`
+}
+
+type RetentionRun struct {
+	ID          int64             `json:"id"`
+	StartedAt   time.Time         `json:"started_at"`
+	FinishedAt  time.Time         `json:"finished_at"`
+	DryRun      bool              `json:"dry_run"`
+	TriggeredBy int64             `json:"triggered_by,omitempty"`
+	Results     []RetentionResult `json:"results"`
+}
+
+type RetentionModel struct {
+	DB *sql.DB
+}
+
+// Run purges the data older than each policy allows and records the run. A
+// dry run only counts what would be deleted. It returns ErrPurgeRunning if
+// another purge holds the lock.
+func (m RetentionModel) Run(policies []RetentionPolicy, dryRun bool, triggeredBy int64) (*RetentionRun, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if !dryRun {
+		var locked bool
+
+		err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, retentionLockKey).Scan(&locked)
+		if err != nil {
+			return nil, err
+		}
+
+		if !locked {
+			return nil, ErrPurgeRunning
+		}
+
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, retentionLockKey)
+	}
+
+	run := &RetentionRun{
+		StartedAt:   time.Now(),
+		DryRun:      dryRun,
+		TriggeredBy: triggeredBy,
+		Results:     []RetentionResult{},
+	}
+
+	for _, policy := range policies {
+		target, ok := retentionTargets[policy.Target]
+		if !ok || policy.Forever {
+			continue
+		}
+
+		result := RetentionResult{
+			Target: policy.Target,
+			Cutoff: run.StartedAt.Add(-policy.MaxAge),
+		}
+
+		if dryRun {
+			query := fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s < $1`, target.table, target.column)
+
+			err = conn.QueryRowContext(ctx, query, result.Cutoff).Scan(&result.Deleted)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			result.Deleted, err = purge(ctx, conn, target, result.Cutoff)
+			if err != nil {
+				return nil, fmt.Errorf("purging %s: %w", policy.Target, err)
+			}
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	run.FinishedAt = time.Now()
+
+	results, err := json.Marshal(run.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.QueryRowContext(ctx, `
+		INSERT INTO retention_runs (started_at, finished_at, dry_run, triggered_by, results)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5)
+		RETURNING runs_id`,
+		run.StartedAt, run.FinishedAt, run.DryRun, run.TriggeredBy, results).Scan(&run.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func purge(ctx context.Context, conn *sql.Conn, target retentionTarget, cutoff time.Time) (int64, error) {
+	query := fmt.Sprintf(`
+		DELETE FROM %[1]s
+		WHERE ctid = ANY(ARRAY(
+			SELECT ctid
+			FROM %[1]s
+			WHERE %[2]s < $1
+			LIMIT $2
+		))`, target.table, target.column)
+
+	var deleted int64
+
+	for {
+		result, err := conn.ExecContext(ctx, query, cutoff, purgeBatchSize)
+		if err != nil {
+			return deleted, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += n
+
+		if n < purgeBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// GetRuns returns the latest runs, newest first.
+func (m RetentionModel) GetRuns(limit int) ([]*RetentionRun, error) {
+	query := `
+		SELECT runs_id, started_at, finished_at, dry_run, COALESCE(triggered_by, 0), results
+		FROM retention_runs
+		ORDER BY started_at DESC, runs_id DESC
+		LIMIT $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	runs := []*RetentionRun{}
+
+	for rows.Next() {
+		var run RetentionRun
+		var results []byte
+
+		err := rows.Scan(
+			&run.ID,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&run.DryRun,
+			&run.TriggeredBy,
+			&results,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(results, &run.Results)
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, &run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// GetLastRun returns the latest run that actually purged data.
+func (m RetentionModel) GetLastRun() (*RetentionRun, error) {
+	query := `
+		SELECT runs_id, started_at, finished_at, dry_run, COALESCE(triggered_by, 0), results
+		FROM retention_runs
+		WHERE NOT dry_run
+		ORDER BY started_at DESC, runs_id DESC
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var run RetentionRun
+	var results []byte
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(
+		&run.ID,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.DryRun,
+		&run.TriggeredBy,
+		&results,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(results, &run.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// SensorSample is a single reading from a player's sensor rig. Device is the
+// serial of the wearable that took it, if the rig says.
+type SensorSample struct {
+	UserID      int64     `json:"user_id"`
+	Device      string    `json:"device,omitempty"`
+	DeviceID    int64     `json:"-"`
+	At          time.Time `json:"at"`
+	HeartRate   float64   `json:"heart_rate"`
+	Stress      float64   `json:"stress"`
+	Humidity    float64   `json:"humidity"`
+	Temperature float64   `json:"temperature"`
+	Pressure    float64   `json:"pressure"`
+}
+
+// maxSampleSkew is how far a sample's timestamp may be from the server clock.
+const maxSampleSkew = 5 * time.Minute
+
+// ValidateSensorSample checks a sample streamed live, which must have been
+// taken around now.
+func ValidateSensorSample(v *validator.Validator, sample *SensorSample, now time.Time) {
+	v.Check(sample.At.Sub(now) <= maxSampleSkew && now.Sub(sample.At) <= maxSampleSkew, "at", "must be within 5 minutes of the server time")
+	validateReadings(v, sample)
+}
+
+// ValidateUploadedSample checks a sample uploaded after the fact, which may be
+// of any age but not from the future.
+func ValidateUploadedSample(v *validator.Validator, sample *SensorSample, now time.Time) {
+	v.Check(sample.At.Sub(now) <= maxSampleSkew, "at", "must not be in the future")
+	validateReadings(v, sample)
+}
+
+func validateReadings(v *validator.Validator, sample *SensorSample) {
+	v.Check(sample.UserID > 0, "user_id", "must be greater than 0")
+	v.Check(!sample.At.IsZero(), "at", "must be provided")
+	v.Check(sample.HeartRate >= 0 && sample.HeartRate <= 300, "heart_rate", "must be between 0 and 300")
+	v.Check(sample.Stress >= 0 && sample.Stress <= 100, "stress", "must be between 0 and 100")
+	v.Check(sample.Humidity >= 0 && sample.Humidity <= 100, "humidity", "must be between 0 and 100")
+	v.Check(sample.Temperature >= -50 && sample.Temperature <= 100, "temperature", "must be between -50 and 100")
+	v.Check(sample.Pressure >= 0 && sample.Pressure <= 2000, "pressure", "must be between 0 and 2000")
+}
+
+// GetPlayerIDs returns the users playing in the match: individual entrants,
+// the current rosters of entered teams and anyone with a player record.
+func (m MatchModel) GetPlayerIDs(matchID int64) (map[int64]bool, error) {
+	query := `
+		SELECT COALESCE(p.users_id, tu.user_id)
+		FROM matches m
+		INNER JOIN tournaments_participants p
+			ON p.participants_id IN (m.home_participant_id, m.away_participant_id)
+		LEFT JOIN teams_users tu ON tu.teams_id = p.teams_id
+			AND (tu.leave_date IS NULL OR tu.leave_date >= CURRENT_DATE)
+		WHERE m.matches_id = $1
+		AND COALESCE(p.users_id, tu.user_id) IS NOT NULL
+		UNION
+		SELECT users_id
+		FROM users_matches
+		WHERE matches_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	players := make(map[int64]bool)
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		players[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return players, nil
+}
+
+type SampleModel struct {
+	DB *sql.DB
+}
+
+// Insert bulk loads samples for a match with COPY. Samples are staged in a
+// temporary table first so that ones already stored for the same player and
+// timestamp are skipped instead of failing the whole batch. It returns how
+// many samples were new.
+func (m SampleModel) Insert(matchID int64, samples []SensorSample) (int64, error) {
+	if len(samples) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TEMPORARY TABLE samples_staging
+			(LIKE match_sensor_samples INCLUDING DEFAULTS)
+		ON COMMIT DROP`)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("samples_staging",
+		"matches_id", "users_id", "sampled_at", "heart_rate", "stress", "humidity", "temperature", "pressure", "devices_id"))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sample := range samples {
+		var deviceID interface{}
+		if sample.DeviceID > 0 {
+			deviceID = sample.DeviceID
+		}
+
+		_, err = stmt.ExecContext(ctx, matchID, sample.UserID, sample.At, sample.HeartRate,
+			sample.Stress, sample.Humidity, sample.Temperature, sample.Pressure, deviceID)
+		if err != nil {
+			stmt.Close()
+			return 0, err
+		}
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		stmt.Close()
+		return 0, err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO match_sensor_samples
+		SELECT DISTINCT ON (matches_id, users_id, sampled_at) *
+		FROM samples_staging
+		ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return 0, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, tx.Commit()
+}
+
+// GetByPlayer returns a player's samples for a match in time order, leaving
+// out quarantined ones.
+func (m SampleModel) GetByPlayer(matchID, userID int64) ([]SensorSample, error) {
+	query := `
+		SELECT s.users_id, COALESCE(d.serial, ''), COALESCE(s.devices_id, 0), s.sampled_at,
+			s.heart_rate, s.stress, s.humidity, s.temperature, s.pressure
+		FROM match_sensor_samples s
+		LEFT JOIN devices d ON d.devices_id = s.devices_id
+		WHERE s.matches_id = $1 AND s.users_id = $2 AND NOT s.quarantined
+		ORDER BY s.sampled_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, matchID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	samples := []SensorSample{}
+
+	for rows.Next() {
+		var sample SensorSample
+
+		err := rows.Scan(
+			&sample.UserID,
+			&sample.Device,
+			&sample.DeviceID,
+			&sample.At,
+			&sample.HeartRate,
+			&sample.Stress,
+			&sample.Humidity,
+			&sample.Temperature,
+			&sample.Pressure,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, sample)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// Summarize recomputes the players' records of a match from what was
+// measured during it. Stress comes from each player's own samples. The room's
+// humidity, temperature and pressure come from the readings of the match's
+// station while it was played, or failing that from the player's samples.
+// Quarantined samples and readings are left out. A player whose samples are
+// all quarantined is left without a stress average, while records with
+// nothing measured at all keep what was entered for them. It returns how many
+// records were updated.
+func (m SampleModel) Summarize(matchID int64) (int64, error) {
+	query := `
+		WITH played AS (
+			SELECT m.stations_id,
+				COALESCE(min(s.sampled_at), m.scheduled_at) AS from_at,
+				COALESCE(max(s.sampled_at), m.scheduled_at + make_interval(mins => m.estimated_minutes)) AS to_at
+			FROM matches m
+			LEFT JOIN match_sensor_samples s ON s.matches_id = m.matches_id AND NOT s.quarantined
+			WHERE m.matches_id = $1
+			GROUP BY m.matches_id
+		),
+		room AS (
+			SELECT avg(r.humidity) AS humidity, avg(r.temperature) AS temperature, avg(r.pressure) AS pressure
+			FROM played p
+			INNER JOIN stations_readings r ON r.stations_id = p.stations_id
+				AND r.read_at BETWEEN p.from_at AND p.to_at
+				AND NOT r.quarantined
+		),
+		player AS (
+			SELECT users_id, avg(stress) FILTER (WHERE NOT quarantined) AS stress,
+				avg(humidity) FILTER (WHERE NOT quarantined) AS humidity,
+				avg(temperature) FILTER (WHERE NOT quarantined) AS temperature,
+				avg(pressure) FILTER (WHERE NOT quarantined) AS pressure
+			FROM match_sensor_samples
+			WHERE matches_id = $1
+			GROUP BY users_id
+		)
+		UPDATE users_matches um
+		SET (average_stress, humidity, temperature, pressure) = (
+			SELECT CASE WHEN p.users_id IS NULL THEN um.average_stress ELSE p.stress END,
+				COALESCE(room.humidity, p.humidity, um.humidity),
+				COALESCE(room.temperature, p.temperature, um.temperature),
+				COALESCE(room.pressure, p.pressure, um.pressure)
+			FROM room
+			LEFT JOIN player p ON p.users_id = um.users_id
+		)
+		WHERE um.matches_id = $1
+		AND (um.users_id IN (SELECT users_id FROM player) OR (SELECT humidity FROM room) IS NOT NULL)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, matchID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
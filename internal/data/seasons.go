@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+// Season is a stretch of dates that leaderboards can be narrowed to, either
+// for one game or, without a GameID, for all of them.
+type Season struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	GameID    int64  `json:"game_id,omitempty"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Version   int    `json:"version"`
+}
+
+func ValidateSeason(v *validator.Validator, season *Season) {
+	v.Check(season.Name != "", "name", "must be provided")
+	v.Check(len(season.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(season.GameID >= 0, "game_id", "must not be negative")
+
+	start, err := time.Parse("2006-01-02", season.StartDate)
+	v.Check(err == nil, "start_date", "must be a date like 2006-01-02")
+
+	end, err := time.Parse("2006-01-02", season.EndDate)
+	v.Check(err == nil, "end_date", "must be a date like 2006-01-02")
+
+	v.Check(start.IsZero() || end.IsZero() || !end.Before(start), "end_date", "must not be before start_date")
+}
+
+type SeasonModel struct {
+	DB *sql.DB
+}
+
+func (m SeasonModel) Insert(season *Season) error {
+	query := `
+		INSERT INTO seasons (seasons_name, games_id, start_date, end_date)
+		VALUES ($1, NULLIF($2, 0), $3, $4)
+		RETURNING seasons_id, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, season.Name, season.GameID, season.StartDate, season.EndDate).Scan(&season.ID, &season.Version)
+}
+
+const seasonQuery = `
+	SELECT seasons_id, seasons_name, COALESCE(games_id, 0), to_char(start_date, 'YYYY-MM-DD'),
+		to_char(end_date, 'YYYY-MM-DD'), version
+	FROM seasons`
+
+func scanSeason(row interface{ Scan(...interface{}) error }) (*Season, error) {
+	var season Season
+
+	err := row.Scan(
+		&season.ID,
+		&season.Name,
+		&season.GameID,
+		&season.StartDate,
+		&season.EndDate,
+		&season.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &season, nil
+}
+
+func (m SeasonModel) Get(id int64) (*Season, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	season, err := scanSeason(m.DB.QueryRowContext(ctx, seasonQuery+` WHERE seasons_id = $1`, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return season, nil
+}
+
+// GetAll returns the seasons, latest first. A non-zero gameID keeps only the
+// seasons of that game and those covering every game.
+func (m SeasonModel) GetAll(gameID int64) ([]*Season, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, seasonQuery+`
+		WHERE ($1 = 0 OR games_id IS NULL OR games_id = $1)
+		ORDER BY start_date DESC, seasons_id DESC`, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	seasons := []*Season{}
+
+	for rows.Next() {
+		season, err := scanSeason(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		seasons = append(seasons, season)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return seasons, nil
+}
+
+func (m SeasonModel) Update(season *Season) error {
+	query := `
+		UPDATE seasons
+		SET seasons_name = $1, games_id = NULLIF($2, 0), start_date = $3, end_date = $4, version = version + 1
+		WHERE seasons_id = $5 AND version = $6
+		RETURNING version`
+
+	args := []interface{}{season.Name, season.GameID, season.StartDate, season.EndDate, season.ID, season.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&season.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the season. A non-zero version makes the delete conditional
+// on the row not having changed since it was read.
+func (m SeasonModel) Delete(id int64, version int) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM seasons
+		WHERE seasons_id = $1 AND ($2 = 0 OR version = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		if version > 0 {
+			return ErrEditConflict
+		}
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	RosterJoined = "joined"
+	RosterLeft   = "left"
+)
+
+// RosterEntry is a member's spell with a team. A member is current until the
+// end of their leave date.
+type RosterEntry struct {
+	UserID      int64   `json:"user_id"`
+	Name        string  `json:"name"`
+	Nationality string  `json:"nationality"`
+	Role        string  `json:"role"`
+	JoinDate    string  `json:"join_date"`
+	LeaveDate   *string `json:"leave_date"`
+	Current     bool    `json:"-"`
+}
+
+// RosterChange is a member joining or leaving a team.
+type RosterChange struct {
+	Date   string `json:"date"`
+	Change string `json:"change"`
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+}
+
+// RosterTimeline lists the joins and departures of a roster in the order they
+// happened. Departures of current members have not happened yet and are left
+// out.
+func RosterTimeline(roster []*RosterEntry) []RosterChange {
+	changes := []RosterChange{}
+
+	for _, e := range roster {
+		changes = append(changes, RosterChange{Date: e.JoinDate, Change: RosterJoined, UserID: e.UserID, Name: e.Name, Role: e.Role})
+
+		if e.LeaveDate != nil && !e.Current {
+			changes = append(changes, RosterChange{Date: *e.LeaveDate, Change: RosterLeft, UserID: e.UserID, Name: e.Name, Role: e.Role})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Date < changes[j].Date })
+
+	return changes
+}
+
+// TeamResult is the outcome of a decided match from one team's side.
+type TeamResult struct {
+	MatchID        int64     `json:"match_id"`
+	TournamentID   int64     `json:"tournament_id"`
+	GameID         int64     `json:"game_id"`
+	GameName       string    `json:"game_name"`
+	Stage          string    `json:"stage"`
+	PlayedAt       time.Time `json:"played_at"`
+	OpponentTeamID int64     `json:"opponent_team_id,omitempty"`
+	OpponentName   string    `json:"opponent_name"`
+	Score          int       `json:"score"`
+	OpponentScore  int       `json:"opponent_score"`
+	Outcome        string    `json:"outcome"`
+}
+
+// GetRoster returns everyone who has been part of the team, in the order they
+// joined.
+func (m TeamModel) GetRoster(teamID int64) ([]*RosterEntry, error) {
+	query := `
+		SELECT tu.user_id, u.users_name, u.nationality, tu.role,
+			to_char(tu.join_date, 'YYYY-MM-DD'), to_char(tu.leave_date, 'YYYY-MM-DD'),
+			tu.leave_date IS NULL OR tu.leave_date >= CURRENT_DATE
+		FROM teams_users tu
+		INNER JOIN users u ON u.users_id = tu.user_id
+		WHERE tu.teams_id = $1
+		ORDER BY tu.join_date, tu.user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roster := []*RosterEntry{}
+
+	for rows.Next() {
+		var entry RosterEntry
+
+		err := rows.Scan(
+			&entry.UserID,
+			&entry.Name,
+			&entry.Nationality,
+			&entry.Role,
+			&entry.JoinDate,
+			&entry.LeaveDate,
+			&entry.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		roster = append(roster, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roster, nil
+}
+
+// GetTournaments returns the tournaments the team entered, latest first, with
+// the prize money it won once they were completed. Participants tied on a
+// placement share the prizes of the places they tie for.
+func (m TeamModel) GetTournaments(teamID int64) ([]*CareerTournament, error) {
+	query := `
+		SELECT p.tournaments_id, t.tournaments_name, t.games_id, g.games_name,
+			to_char(t.start_date, 'YYYY-MM-DD'), t.status, p.placement,
+			CASE
+				WHEN p.placement IS NULL OR t.status NOT IN ('completed', 'archived') THEN 0
+				ELSE COALESCE(prizes.money, 0)::double precision / tied.n
+			END
+		FROM tournaments_participants p
+		INNER JOIN tournaments t ON t.tournaments_id = p.tournaments_id
+		INNER JOIN games g ON g.games_id = t.games_id
+		LEFT JOIN LATERAL (
+			SELECT count(*) AS n
+			FROM tournaments_participants o
+			WHERE o.tournaments_id = p.tournaments_id AND o.placement = p.placement
+		) tied ON true
+		LEFT JOIN LATERAL (
+			SELECT sum(pp.money) AS money
+			FROM tournaments_prize_pool pp
+			WHERE pp.tournaments_id = p.tournaments_id
+			AND pp.place BETWEEN p.placement AND p.placement + tied.n - 1
+		) prizes ON true
+		WHERE p.teams_id = $1
+		ORDER BY t.start_date DESC, p.tournaments_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tournaments := []*CareerTournament{}
+
+	for rows.Next() {
+		var tournament CareerTournament
+
+		err := rows.Scan(
+			&tournament.TournamentID,
+			&tournament.TournamentName,
+			&tournament.GameID,
+			&tournament.GameName,
+			&tournament.StartDate,
+			&tournament.Status,
+			&tournament.Placement,
+			&tournament.PrizeMoney,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tournaments = append(tournaments, &tournament)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tournaments, nil
+}
+
+// GetResults returns the team's decided matches, latest first. A non-zero
+// opponentID keeps only the matches against that team.
+func (m TeamModel) GetResults(teamID, opponentID int64) ([]*TeamResult, error) {
+	query := `
+		SELECT m.matches_id, m.tournaments_id, t.games_id, g.games_name, m.stage,
+			COALESCE(m.scheduled_at, m.finished_at, t.start_date::timestamptz),
+			COALESCE(o.teams_id, 0), COALESCE(ot.teams_name, ou.users_name, ''),
+			CASE WHEN m.home_participant_id = p.participants_id THEN m.home_score ELSE m.away_score END,
+			CASE WHEN m.home_participant_id = p.participants_id THEN m.away_score ELSE m.home_score END,
+			CASE
+				WHEN m.winner_participant_id = p.participants_id THEN 'win'
+				WHEN m.winner_participant_id IS NOT NULL THEN 'loss'
+				ELSE 'draw'
+			END
+		FROM tournaments_participants p
+		INNER JOIN matches m ON p.participants_id IN (m.home_participant_id, m.away_participant_id)
+		INNER JOIN tournaments t ON t.tournaments_id = m.tournaments_id
+		INNER JOIN games g ON g.games_id = t.games_id
+		LEFT JOIN tournaments_participants o ON o.participants_id =
+			CASE WHEN m.home_participant_id = p.participants_id THEN m.away_participant_id ELSE m.home_participant_id END
+		LEFT JOIN teams ot ON ot.teams_id = o.teams_id
+		LEFT JOIN users ou ON ou.users_id = o.users_id
+		WHERE p.teams_id = $1
+		AND m.status IN ('finished', 'forfeit', 'no_show')
+		AND ($2 = 0 OR o.teams_id = $2)
+		ORDER BY 6 DESC, m.matches_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, teamID, opponentID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []*TeamResult{}
+
+	for rows.Next() {
+		var result TeamResult
+
+		err := rows.Scan(
+			&result.MatchID,
+			&result.TournamentID,
+			&result.GameID,
+			&result.GameName,
+			&result.Stage,
+			&result.PlayedAt,
+			&result.OpponentTeamID,
+			&result.OpponentName,
+			&result.Score,
+			&result.OpponentScore,
+			&result.Outcome,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
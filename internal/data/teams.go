@@ -14,12 +14,15 @@ type Team struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Region      string `json:"region"`
+	GameID      int64  `json:"game_id,omitempty"`
+	Version     int    `json:"version"`
 }
 
 func ValidateTeam(v *validator.Validator, team *Team) {
 	v.Check(team.Name != "", "name", "must be provided")
 	v.Check(len(team.Name) <= 100, "name", "must not be more than 100 bytes long")
 	v.Check(len(team.Region) <= 32, "region", "must not be more than 32 bytes long")
+	v.Check(team.GameID >= 0, "game_id", "must not be negative")
 }
 
 type TeamModel struct {
@@ -32,7 +35,7 @@ func (m TeamModel) Get(id int64) (*Team, error) {
 	}
 
 	query := `
-		SELECT teams_id, teams_name, teams_description, teams_region
+		SELECT teams_id, teams_name, teams_description, teams_region, COALESCE(games_id, 0), version
 		FROM teams
 		WHERE teams_id = $1`
 
@@ -46,6 +49,8 @@ func (m TeamModel) Get(id int64) (*Team, error) {
 		&team.Name,
 		&team.Description,
 		&team.Region,
+		&team.GameID,
+		&team.Version,
 	)
 
 	if err != nil {
@@ -62,45 +67,76 @@ func (m TeamModel) Get(id int64) (*Team, error) {
 
 func (m TeamModel) Insert(team *Team) error {
 	query := `
-		INSERT INTO teams (teams_name, teams_description, teams_region)
-		VALUES ($1, $2, $3)
-		RETURNING teams_id`
+		INSERT INTO teams (teams_name, teams_description, teams_region, games_id)
+		VALUES ($1, $2, $3, NULLIF($4, 0))
+		RETURNING teams_id, version`
 
-	args := []interface{}{team.Name, team.Description, team.Region}
+	args := []interface{}{team.Name, team.Description, team.Region, team.GameID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&team.ID)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&team.ID, &team.Version)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// Update saves the team and moves its memberships to its game. It returns
+// ErrMembershipOverlap if that would put a member in two teams of the game
+// at once.
 func (m TeamModel) Update(team *Team) error {
 	query := `
 		UPDATE teams
-		SET teams_name = $1, teams_description = $2, teams_region = $3
-		WHERE teams_id = $4`
+		SET teams_name = $1, teams_description = $2, teams_region = $3, games_id = NULLIF($4, 0), version = version + 1
+		WHERE teams_id = $5 AND version = $6
+		RETURNING version`
 
 	args := []interface{}{
 		team.Name,
 		team.Description,
 		team.Region,
+		team.GameID,
 		team.ID,
+		team.Version,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&team.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE teams_users SET games_id = $2
+		WHERE teams_id = $1 AND games_id <> $2`, team.ID, team.GameID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: conflicting key value violates exclusion constraint "teams_users_no_overlap"`:
+			return ErrMembershipOverlap
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (m TeamModel) GetAll() ([]*Team, error) {
 	query := `
-		SELECT teams_id, teams_name, teams_description, teams_region
+		SELECT teams_id, teams_name, teams_description, teams_region, COALESCE(games_id, 0), version
 		FROM teams`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -123,6 +159,8 @@ func (m TeamModel) GetAll() ([]*Team, error) {
 			&team.Name,
 			&team.Description,
 			&team.Region,
+			&team.GameID,
+			&team.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -140,7 +178,7 @@ func (m TeamModel) GetAll() ([]*Team, error) {
 
 func (m TeamModel) GetAllByRegion(region string) ([]*Team, error) {
 	query := `
-		SELECT teams_name, teams_description
+		SELECT teams_id, teams_name, teams_description, teams_region, COALESCE(games_id, 0), version
 		FROM teams
 		WHERE teams_region = $1`
 
@@ -160,8 +198,12 @@ func (m TeamModel) GetAllByRegion(region string) ([]*Team, error) {
 		var team Team
 
 		err := rows.Scan(
+			&team.ID,
 			&team.Name,
 			&team.Description,
+			&team.Region,
+			&team.GameID,
+			&team.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -177,19 +219,21 @@ func (m TeamModel) GetAllByRegion(region string) ([]*Team, error) {
 	return teams, nil
 }
 
-func (m TeamModel) Delete(id int64) error {
+// Delete removes the team. A non-zero version makes the delete conditional
+// on the row not having changed since it was read.
+func (m TeamModel) Delete(id int64, version int) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
 		DELETE FROM teams
-		WHERE teams_id = $1`
+		WHERE teams_id = $1 AND ($2 = 0 OR version = $2)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -200,6 +244,9 @@ func (m TeamModel) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
+		if version > 0 {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 
@@ -3,65 +3,449 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrMembershipOverlap = errors.New("membership overlaps another")
+	ErrCaptainTaken      = errors.New("team already has a captain")
+	ErrNotMember         = errors.New("user is not a member of the team")
 )
 
+const (
+	RolePlayer     = "player"
+	RoleCaptain    = "captain"
+	RoleSubstitute = "substitute"
+	RoleCoach      = "coach"
+	RoleAnalyst    = "analyst"
+	RoleManager    = "manager"
+)
+
+var Roles = []string{RolePlayer, RoleCaptain, RoleSubstitute, RoleCoach, RoleAnalyst, RoleManager}
+
+// StaffRoles are the team roles of people looking after players rather than
+// playing.
+var StaffRoles = []string{RoleCoach, RoleAnalyst, RoleManager}
+
+// TeamUsers is a spell of a user with a team. Both dates are inclusive, and
+// LeaveDate is nil while the user is with the team for the foreseeable
+// future.
 type TeamUsers struct {
-	UserID    int64  `json:"user_id"`
-	TeamID    int64  `json:"team_id"`
-	JoinDate  string `json:"join_date"`
-	LeaveDate string `json:"leave_date"`
-	Role      string `json:"role"`
+	UserID    int64   `json:"user_id"`
+	TeamID    int64   `json:"team_id"`
+	JoinDate  string  `json:"join_date"`
+	LeaveDate *string `json:"leave_date"`
+	Role      string  `json:"role"`
+}
+
+func ValidateTeamUsers(v *validator.Validator, teamUsers *TeamUsers) {
+	v.Check(teamUsers.UserID > 0, "user_id", "must be provided")
+	v.Check(validator.In(teamUsers.Role, Roles...), "role", "must be one of player, captain, substitute, coach, analyst or manager")
+
+	join, err := time.Parse("2006-01-02", teamUsers.JoinDate)
+	v.Check(err == nil, "join_date", "must be a date like 2006-01-02")
+
+	if teamUsers.LeaveDate != nil {
+		leave, err := time.Parse("2006-01-02", *teamUsers.LeaveDate)
+		v.Check(err == nil, "leave_date", "must be a date like 2006-01-02")
+		v.Check(join.IsZero() || leave.IsZero() || !leave.Before(join), "leave_date", "must not be before join_date")
+	}
 }
 
 type TeamUsersModel struct {
 	DB *sql.DB
 }
 
-func (m TeamUsersModel) Insert(teamUsers *TeamUsers) error {
+// lock serialises roster changes of the user and of the teams, so that checks
+// for overlapping memberships and captains hold until the change commits.
+func (m TeamUsersModel) lock(ctx context.Context, tx *sql.Tx, userID int64, teamIDs ...int64) error {
+	var id int64
+
+	err := tx.QueryRowContext(ctx, `SELECT users_id FROM users WHERE users_id = $1 FOR UPDATE`, userID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT teams_id
+		FROM teams
+		WHERE teams_id = ANY($1)
+		ORDER BY teams_id
+		FOR UPDATE`, pq.Array(teamIDs))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	locked := make(map[int64]bool)
+
+	for rows.Next() {
+		err := rows.Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		locked[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, teamID := range teamIDs {
+		if !locked[teamID] {
+			return ErrRecordNotFound
+		}
+	}
+
+	return nil
+}
+
+// insert adds the membership unless the user is already in the team, or in
+// another team of the same game, for some of its dates, or it would give the
+// team two captains at once. Teams without a game count as one game.
+// teams_users_no_overlap holds the same rule in the database.
+func (m TeamUsersModel) insert(ctx context.Context, tx *sql.Tx, teamUsers *TeamUsers) error {
+	var overlap bool
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM teams_users tu
+			INNER JOIN teams t ON t.teams_id = tu.teams_id
+			INNER JOIN teams joined ON joined.teams_id = $2
+			WHERE tu.user_id = $1
+			AND (tu.teams_id = joined.teams_id OR COALESCE(t.games_id, 0) = COALESCE(joined.games_id, 0))
+			AND tu.join_date <= COALESCE($4::date, 'infinity')
+			AND COALESCE(tu.leave_date, 'infinity') >= $3::date
+		)`, teamUsers.UserID, teamUsers.TeamID, teamUsers.JoinDate, teamUsers.LeaveDate).Scan(&overlap)
+	if err != nil {
+		return err
+	}
+
+	if overlap {
+		return ErrMembershipOverlap
+	}
+
+	if teamUsers.Role == RoleCaptain {
+		err = checkCaptaincy(ctx, tx, teamUsers)
+		if err != nil {
+			return err
+		}
+	}
+
 	query := `
-		INSERT INTO teams_users (user_id, teams_id, join_date, leave_date, role)
-		VALUES ($1, $2, $3, $4, $5)`
+		INSERT INTO teams_users (user_id, teams_id, join_date, leave_date, role, games_id)
+		SELECT $1, $2, $3, $4, $5, COALESCE(games_id, 0)
+		FROM teams
+		WHERE teams_id = $2`
 
 	args := []interface{}{teamUsers.UserID, teamUsers.TeamID, teamUsers.JoinDate,
 		teamUsers.LeaveDate, teamUsers.Role}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: conflicting key value violates exclusion constraint "teams_users_no_overlap"`:
+			return ErrMembershipOverlap
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Join adds a user to a team.
+func (m TeamUsersModel) Join(teamUsers *TeamUsers) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	err = m.lock(ctx, tx, teamUsers.UserID, teamUsers.TeamID)
+	if err != nil {
+		return err
+	}
+
+	err = m.insert(ctx, tx, teamUsers)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m TeamUsersModel) Update(teamUsers *TeamUsers) error {
+// Leave ends the user's membership of the team on the given date, which is
+// their last day with it. It returns ErrRecordNotFound if the user is not in
+// the team on that date, or has already left by the end of it.
+func (m TeamUsersModel) Leave(teamID, userID int64, date string) (*TeamUsers, error) {
 	query := `
 		UPDATE teams_users
-		SET join_date = $1, leave_date = $2, role = $3
-		WHERE teams_id = $4 AND user_id = $5`
+		SET leave_date = $3
+		WHERE teams_id = $1 AND user_id = $2
+		AND join_date <= $3::date AND (leave_date IS NULL OR leave_date > $3::date)
+		RETURNING to_char(join_date, 'YYYY-MM-DD'), to_char(leave_date, 'YYYY-MM-DD'), role`
 
-	args := []interface{}{
-		teamUsers.JoinDate,
-		teamUsers.LeaveDate,
-		teamUsers.Role,
-		teamUsers.TeamID,
-		teamUsers.UserID,
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	teamUsers := TeamUsers{UserID: userID, TeamID: teamID}
+
+	err := m.DB.QueryRowContext(ctx, query, teamID, userID, date).Scan(&teamUsers.JoinDate, &teamUsers.LeaveDate, &teamUsers.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
+
+	return &teamUsers, nil
+}
+
+// Transfer moves a user from one team to another. The new membership starts
+// on its join date and the old one ends the day before. It returns
+// ErrNotMember if the user is not in the old team on both days.
+func (m TeamUsersModel) Transfer(fromTeamID int64, to *TeamUsers) (*TeamUsers, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = m.lock(ctx, tx, to.UserID, fromTeamID, to.TeamID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := TeamUsers{UserID: to.UserID, TeamID: fromTeamID}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE teams_users
+		SET leave_date = $3::date - 1
+		WHERE teams_id = $1 AND user_id = $2
+		AND join_date < $3::date AND (leave_date IS NULL OR leave_date >= $3::date)
+		RETURNING to_char(join_date, 'YYYY-MM-DD'), to_char(leave_date, 'YYYY-MM-DD'), role`,
+		fromTeamID, to.UserID, to.JoinDate).Scan(&from.JoinDate, &from.LeaveDate, &from.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotMember
+		default:
+			return nil, err
+		}
+	}
+
+	err = m.insert(ctx, tx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &from, nil
+}
+
+// checkCaptaincy returns ErrCaptainTaken if anyone else is captain of the
+// team for some of the dates of the membership.
+func checkCaptaincy(ctx context.Context, tx *sql.Tx, teamUsers *TeamUsers) error {
+	var captained bool
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM teams_users
+			WHERE teams_id = $1 AND user_id <> $2 AND role = 'captain'
+			AND join_date <= COALESCE($4::date, 'infinity')
+			AND COALESCE(leave_date, 'infinity') >= $3::date
+		)`, teamUsers.TeamID, teamUsers.UserID, teamUsers.JoinDate, teamUsers.LeaveDate).Scan(&captained)
 	if err != nil {
 		return err
 	}
+
+	if captained {
+		return ErrCaptainTaken
+	}
+
 	return nil
 }
 
+// changeRole gives the user's current membership of the team a new role from
+// today on. The days already served keep the role they had, in a spell of
+// their own that ends yesterday, so that the roster history stays as it was.
+// It returns ErrRecordNotFound if the user is not in the team today.
+func changeRole(ctx context.Context, tx *sql.Tx, teamID, userID int64, role string) (*TeamUsers, error) {
+	teamUsers := TeamUsers{UserID: userID, TeamID: teamID}
+
+	var started bool
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT to_char(join_date, 'YYYY-MM-DD'), to_char(leave_date, 'YYYY-MM-DD'), role, join_date < CURRENT_DATE
+		FROM teams_users
+		WHERE teams_id = $1 AND user_id = $2
+		AND join_date <= CURRENT_DATE AND (leave_date IS NULL OR leave_date >= CURRENT_DATE)`,
+		teamID, userID).Scan(&teamUsers.JoinDate, &teamUsers.LeaveDate, &teamUsers.Role, &started)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if teamUsers.Role == role {
+		return &teamUsers, nil
+	}
+
+	if !started {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE teams_users
+			SET role = $3
+			WHERE teams_id = $1 AND user_id = $2 AND join_date = CURRENT_DATE`, teamID, userID, role)
+		if err != nil {
+			return nil, err
+		}
+
+		teamUsers.Role = role
+		return &teamUsers, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE teams_users
+		SET leave_date = CURRENT_DATE - 1
+		WHERE teams_id = $1 AND user_id = $2 AND join_date = $3::date`, teamID, userID, teamUsers.JoinDate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO teams_users (user_id, teams_id, join_date, leave_date, role, games_id)
+		SELECT $1, $2, CURRENT_DATE, $3, $4, COALESCE(games_id, 0)
+		FROM teams
+		WHERE teams_id = $2
+		RETURNING to_char(join_date, 'YYYY-MM-DD')`,
+		userID, teamID, teamUsers.LeaveDate, role).Scan(&teamUsers.JoinDate)
+	if err != nil {
+		return nil, err
+	}
+
+	teamUsers.Role = role
+	return &teamUsers, nil
+}
+
+// SetRole changes the role of the user's current membership of the team from
+// today on. Making them captain hands the captaincy over from whoever holds
+// it today, who carries on as a player. It returns ErrCaptainTaken if someone
+// else is already due to be captain for some of the rest of the membership.
+func (m TeamUsersModel) SetRole(teamID, userID int64, role string) (*TeamUsers, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = m.lock(ctx, tx, userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == RoleCaptain {
+		var captainID int64
+
+		err = tx.QueryRowContext(ctx, `
+			SELECT user_id
+			FROM teams_users
+			WHERE teams_id = $1 AND user_id <> $2 AND role = 'captain'
+			AND join_date <= CURRENT_DATE AND (leave_date IS NULL OR leave_date >= CURRENT_DATE)`,
+			teamID, userID).Scan(&captainID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return nil, err
+		default:
+			_, err = changeRole(ctx, tx, teamID, captainID, RolePlayer)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	teamUsers, err := changeRole(ctx, tx, teamID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == RoleCaptain {
+		err = checkCaptaincy(ctx, tx, teamUsers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return teamUsers, nil
+}
+
+// OverlapsInGame reports whether any member of the team has been in another
+// team of the game at the same time, as would be the case if the team were
+// moved to that game. A game of 0 stands for the teams without one.
+func (m TeamUsersModel) OverlapsInGame(teamID, gameID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM teams_users member
+			INNER JOIN teams_users other ON other.user_id = member.user_id AND other.teams_id <> member.teams_id
+			INNER JOIN teams t ON t.teams_id = other.teams_id
+			WHERE member.teams_id = $1 AND COALESCE(t.games_id, 0) = $2
+			AND other.join_date <= COALESCE(member.leave_date, 'infinity')
+			AND member.join_date <= COALESCE(other.leave_date, 'infinity')
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var overlap bool
+
+	err := m.DB.QueryRowContext(ctx, query, teamID, gameID).Scan(&overlap)
+	return overlap, err
+}
+
 func (m TeamUsersModel) GetAllByTeam(teamID int64) ([]*TeamUsers, error) {
 	query := `
-		SELECT user_id, join_date, leave_date, role
+		SELECT user_id, to_char(join_date, 'YYYY-MM-DD'), to_char(leave_date, 'YYYY-MM-DD'), role
 		FROM teams_users
-		WHERE teams_id = $1`
+		WHERE teams_id = $1
+		ORDER BY join_date, user_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -102,9 +486,10 @@ func (m TeamUsersModel) GetAllByTeam(teamID int64) ([]*TeamUsers, error) {
 
 func (m TeamUsersModel) GetAllByUser(userID int64) ([]*TeamUsers, error) {
 	query := `
-		SELECT teams_id, join_date, leave_date
+		SELECT teams_id, to_char(join_date, 'YYYY-MM-DD'), to_char(leave_date, 'YYYY-MM-DD'), role
 		FROM teams_users
-		WHERE user_id = $1`
+		WHERE user_id = $1
+		ORDER BY join_date, teams_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -124,9 +509,10 @@ func (m TeamUsersModel) GetAllByUser(userID int64) ([]*TeamUsers, error) {
 		teamUser.UserID = userID
 
 		err := rows.Scan(
-			&teamUser.UserID,
+			&teamUser.TeamID,
 			&teamUser.JoinDate,
 			&teamUser.LeaveDate,
+			&teamUser.Role,
 		)
 		if err != nil {
 			return nil, err
@@ -141,3 +527,94 @@ func (m TeamUsersModel) GetAllByUser(userID int64) ([]*TeamUsers, error) {
 
 	return teamsUsers, nil
 }
+
+// GetStaffEmails returns the addresses of the current staff of the player's
+// teams that are playing in the match.
+func (m TeamUsersModel) GetStaffEmails(userID, matchID int64) ([]string, error) {
+	query := `
+		SELECT DISTINCT u.email
+		FROM teams_users player
+		INNER JOIN tournaments_participants p ON p.teams_id = player.teams_id
+		INNER JOIN matches m ON p.participants_id IN (m.home_participant_id, m.away_participant_id)
+		INNER JOIN teams_users staff ON staff.teams_id = player.teams_id
+			AND staff.role = ANY($3)
+			AND (staff.leave_date IS NULL OR staff.leave_date >= CURRENT_DATE)
+		INNER JOIN users u ON u.users_id = staff.user_id
+		WHERE player.user_id = $1
+		AND (player.leave_date IS NULL OR player.leave_date >= CURRENT_DATE)
+		AND m.matches_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, matchID, pq.Array(StaffRoles))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	emails := []string{}
+
+	for rows.Next() {
+		var email string
+
+		err := rows.Scan(&email)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// IsMember reports whether the user, player or staff, is currently part of
+// the team.
+func (m TeamUsersModel) IsMember(teamID, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM teams_users
+			WHERE teams_id = $1 AND user_id = $2
+			AND join_date <= CURRENT_DATE
+			AND (leave_date IS NULL OR leave_date >= CURRENT_DATE)
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var member bool
+
+	err := m.DB.QueryRowContext(ctx, query, teamID, userID).Scan(&member)
+	return member, err
+}
+
+// IsStaffOf reports whether a user is currently on the staff of a team the
+// player currently plays for.
+func (m TeamUsersModel) IsStaffOf(staffID, playerID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM teams_users player
+			INNER JOIN teams_users staff ON staff.teams_id = player.teams_id
+				AND staff.role = ANY($3)
+				AND (staff.leave_date IS NULL OR staff.leave_date >= CURRENT_DATE)
+			WHERE player.user_id = $2
+			AND staff.user_id = $1
+			AND (player.leave_date IS NULL OR player.leave_date >= CURRENT_DATE)
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var staff bool
+
+	err := m.DB.QueryRowContext(ctx, query, staffID, playerID, pq.Array(StaffRoles)).Scan(&staff)
+	return staff, err
+}
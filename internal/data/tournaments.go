@@ -9,12 +9,60 @@ import (
 	"github.com/WrastAct/maestro/internal/validator"
 )
 
+const (
+	TournamentDraft            = "draft"
+	TournamentRegistrationOpen = "registration_open"
+	TournamentCheckIn          = "check_in"
+	TournamentLive             = "live"
+	TournamentCompleted        = "completed"
+	TournamentCancelled        = "cancelled"
+	TournamentArchived         = "archived"
+)
+
+var (
+	ErrInvalidTransition = errors.New("invalid status transition")
+)
+
+// tournamentTransitions lists, for every status, the statuses a tournament
+// is allowed to move to next.
+var tournamentTransitions = map[string][]string{
+	TournamentDraft:            {TournamentRegistrationOpen, TournamentCancelled},
+	TournamentRegistrationOpen: {TournamentDraft, TournamentCheckIn, TournamentCancelled},
+	TournamentCheckIn:          {TournamentRegistrationOpen, TournamentLive, TournamentCancelled},
+	TournamentLive:             {TournamentCompleted, TournamentCancelled},
+	TournamentCompleted:        {TournamentArchived},
+	TournamentCancelled:        {TournamentArchived},
+	TournamentArchived:         {},
+}
+
 type Tournament struct {
 	ID        int64  `json:"id"`
 	Name      string `json:"name"`
 	GameID    int64  `json:"game_id"`
 	StartDate string `json:"start_date"`
 	EndDate   string `json:"end_date"`
+	Status    string `json:"status"`
+	Version   int    `json:"version"`
+}
+
+func (t *Tournament) CanTransition(to string) bool {
+	return validator.In(to, tournamentTransitions[t.Status]...)
+}
+
+// IsEditable reports whether the game and dates of the tournament may still
+// be changed, which is only the case before it goes live.
+func (t *Tournament) IsEditable() bool {
+	return validator.In(t.Status, TournamentDraft, TournamentRegistrationOpen, TournamentCheckIn)
+}
+
+// IsRegistrationOpen reports whether participants may still be added or removed.
+func (t *Tournament) IsRegistrationOpen() bool {
+	return validator.In(t.Status, TournamentDraft, TournamentRegistrationOpen)
+}
+
+func ValidateTournamentStatus(v *validator.Validator, status string) {
+	_, ok := tournamentTransitions[status]
+	v.Check(ok, "status", "must be a valid tournament status")
 }
 
 func ValidateTournament(v *validator.Validator, tournament *Tournament) {
@@ -34,7 +82,7 @@ func (m TournamentModel) Get(id int64) (*Tournament, error) {
 	}
 
 	query := `
-		SELECT tournaments_id, tournaments_name, games_id, start_date, end_date
+		SELECT tournaments_id, tournaments_name, games_id, start_date, end_date, status, version
 		FROM tournaments
 		WHERE tournaments_id = $1`
 
@@ -49,6 +97,8 @@ func (m TournamentModel) Get(id int64) (*Tournament, error) {
 		&tournament.GameID,
 		&tournament.StartDate,
 		&tournament.EndDate,
+		&tournament.Status,
+		&tournament.Version,
 	)
 
 	if err != nil {
@@ -67,13 +117,13 @@ func (m TournamentModel) Insert(tournament *Tournament) error {
 	query := `
 		INSERT INTO tournaments (tournaments_name, games_id, start_date, end_date)
 		VALUES ($1, $2, $3, $4)
-		RETURNING tournaments_id`
+		RETURNING tournaments_id, status, version`
 
 	args := []interface{}{tournament.Name, tournament.GameID, tournament.StartDate, tournament.EndDate}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&tournament.ID)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&tournament.ID, &tournament.Status, &tournament.Version)
 	if err != nil {
 		return err
 	}
@@ -83,8 +133,9 @@ func (m TournamentModel) Insert(tournament *Tournament) error {
 func (m TournamentModel) Update(tournament *Tournament) error {
 	query := `
 		UPDATE tournaments
-		SET tournaments_name = $1, games_id = $2, start_date = $3, end_date = $4
-		WHERE tournaments_id = $5`
+		SET tournaments_name = $1, games_id = $2, start_date = $3, end_date = $4, version = version + 1
+		WHERE tournaments_id = $5 AND version = $6
+		RETURNING version`
 
 	args := []interface{}{
 		tournament.Name,
@@ -92,19 +143,25 @@ func (m TournamentModel) Update(tournament *Tournament) error {
 		tournament.StartDate,
 		tournament.EndDate,
 		tournament.ID,
+		tournament.Version,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&tournament.Version)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
 	return nil
 }
 
 func (m TournamentModel) GetAll() ([]*Tournament, error) {
 	query := `
-		SELECT tournaments_id, tournaments_name, games_id, start_date, end_date
+		SELECT tournaments_id, tournaments_name, games_id, start_date, end_date, status, version
 		FROM tournaments`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -128,6 +185,8 @@ func (m TournamentModel) GetAll() ([]*Tournament, error) {
 			&tournament.GameID,
 			&tournament.StartDate,
 			&tournament.EndDate,
+			&tournament.Status,
+			&tournament.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -143,19 +202,21 @@ func (m TournamentModel) GetAll() ([]*Tournament, error) {
 	return tournaments, nil
 }
 
-func (m TournamentModel) Delete(id int64) error {
+// Delete removes the tournament. A non-zero version makes the delete
+// conditional on the row not having changed since it was read.
+func (m TournamentModel) Delete(id int64, version int) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
 		DELETE FROM tournaments
-		WHERE tournaments_id = $1`
+		WHERE tournaments_id = $1 AND ($2 = 0 OR version = $2)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -166,8 +227,175 @@ func (m TournamentModel) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
+		if version > 0 {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 
 	return nil
 }
+
+// Transition moves the tournament to a new status and applies the side effects
+// of entering it, all in one transaction. The update only succeeds if the
+// tournament is still in the status it was read with, so two admins driving
+// the same tournament can't both win.
+func (m TournamentModel) Transition(tournament *Tournament, to string, userID int64) error {
+	if !tournament.CanTransition(to) {
+		return ErrInvalidTransition
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE tournaments
+		SET status = $1, version = version + 1
+		WHERE tournaments_id = $2 AND status = $3
+		RETURNING version`, to, tournament.ID, tournament.Status).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tournaments_status_history (tournaments_id, from_status, to_status, users_id)
+		VALUES ($1, $2, $3, NULLIF($4, 0))`, tournament.ID, tournament.Status, to, userID)
+	if err != nil {
+		return err
+	}
+
+	if to == TournamentCompleted {
+		err = computeStandings(ctx, tx, tournament.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	tournament.Status = to
+	tournament.Version = version
+	return nil
+}
+
+// computeStandings ranks every participant by the number of matches won in
+// the tournament. Participants with the same number of wins share a place.
+func computeStandings(ctx context.Context, tx *sql.Tx, tournamentID int64) error {
+	query := `
+		WITH wins AS (
+			SELECT p.participants_id, (
+				SELECT COUNT(*)
+				FROM matches m
+				WHERE m.tournaments_id = p.tournaments_id
+				AND m.winner_participant_id = p.participants_id
+				AND m.status IN ('finished', 'forfeit', 'no_show')
+			) AS wins
+			FROM tournaments_participants p
+			WHERE p.tournaments_id = $1
+		)
+		UPDATE tournaments_participants p
+		SET placement = ranked.place
+		FROM (SELECT participants_id, RANK() OVER (ORDER BY wins DESC) AS place FROM wins) ranked
+		WHERE p.participants_id = ranked.participants_id`
+
+	_, err := tx.ExecContext(ctx, query, tournamentID)
+	return err
+}
+
+// Prize is the money awarded for finishing a tournament in a place.
+type Prize struct {
+	Place int `json:"place"`
+	Money int `json:"money"`
+}
+
+func ValidatePrizes(v *validator.Validator, prizes []Prize) {
+	places := make(map[int]bool, len(prizes))
+
+	for _, prize := range prizes {
+		v.Check(prize.Place > 0 && prize.Place <= 32767, "prizes", "place must be between 1 and 32767")
+		v.Check(prize.Money >= 0, "prizes", "money must not be negative")
+		v.Check(!places[prize.Place], "prizes", "must not contain the same place twice")
+		places[prize.Place] = true
+	}
+}
+
+func (m TournamentModel) GetPrizes(tournamentID int64) ([]Prize, error) {
+	query := `
+		SELECT place, money
+		FROM tournaments_prize_pool
+		WHERE tournaments_id = $1
+		ORDER BY place`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tournamentID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	prizes := []Prize{}
+
+	for rows.Next() {
+		var prize Prize
+
+		err := rows.Scan(&prize.Place, &prize.Money)
+		if err != nil {
+			return nil, err
+		}
+
+		prizes = append(prizes, prize)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prizes, nil
+}
+
+// SetPrizes replaces the tournament's prize pool.
+func (m TournamentModel) SetPrizes(tournamentID int64, prizes []Prize) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tournaments_prize_pool WHERE tournaments_id = $1`, tournamentID)
+	if err != nil {
+		return err
+	}
+
+	for _, prize := range prizes {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO tournaments_prize_pool (tournaments_id, place, money)
+			VALUES ($1, $2, $3)`, tournamentID, prize.Place, prize.Money)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -3,19 +3,46 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
 )
 
 type UserMatch struct {
-	UserID        int64   `json:"user_id"`
-	MatchID       int64   `json:"match_id"`
-	TournamentID  int64   `json:"tournament_id"`
-	Result        string  `json:"result"`
-	AverageStress float64 `json:"avg_stress"`
-	Humidity      float64 `json:"humidity"`
-	Temperature   float64 `json:"temperature"`
-	Pressure      float64 `json:"pressure"`
+	UserID        int64           `json:"user_id"`
+	MatchID       int64           `json:"match_id"`
+	TournamentID  int64           `json:"tournament_id"`
+	Result        string          `json:"result"`
+	AverageStress *float64        `json:"avg_stress"`
+	Humidity      float64         `json:"humidity"`
+	Temperature   float64         `json:"temperature"`
+	Pressure      float64         `json:"pressure"`
+	Extras        json.RawMessage `json:"extras"`
+	SchemaVersion int             `json:"schema_version,omitempty"`
+	Redacted      []string        `json:"redacted,omitempty"`
+}
+
+// Redact hides the player's stress from someone without access to it.
+func (userMatch *UserMatch) Redact(access BiometricAccess) {
+	if !access[BiometricStress] {
+		userMatch.AverageStress = nil
+		userMatch.Redacted = append(userMatch.Redacted, "avg_stress")
+	}
+}
+
+// ValidateUserMatch checks the player record and, if the game defines one,
+// validates its extra stats against the game's player schema.
+func ValidateUserMatch(v *validator.Validator, userMatch *UserMatch, schema *GameSchema) {
+	v.Check(userMatch.UserID > 0, "user_id", "must be greater than 0")
+	v.Check(userMatch.MatchID > 0, "match_id", "must be greater than 0")
+	v.Check(userMatch.TournamentID > 0, "tournament_id", "must be greater than 0")
+	v.Check(isJSONObject(userMatch.Extras), "extras", "must be a JSON object")
+
+	if schema != nil && v.Valid() {
+		validatePayload(v, "extras", userMatch.Extras, schema.PlayerSchema)
+	}
 }
 
 type UserMatchModel struct {
@@ -23,10 +50,20 @@ type UserMatchModel struct {
 }
 
 func (m UserMatchModel) Insert(userMatch *UserMatch) error {
+	// Averages come from the player's recorded sensor samples when there are
+	// any; the submitted values only stand in for matches played without.
 	query := `
 		INSERT INTO users_matches (users_id, matches_id, tournaments_id, result, average_stress,
-			humidity, temperature, pressure)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+			humidity, temperature, pressure, extras, schema_version)
+		SELECT $1, $2, $3, $4, COALESCE(s.stress, $5), COALESCE(s.humidity, $6),
+			COALESCE(s.temperature, $7), COALESCE(s.pressure, $8), $9, NULLIF($10, 0)
+		FROM (
+			SELECT avg(stress) AS stress, avg(humidity) AS humidity,
+				avg(temperature) AS temperature, avg(pressure) AS pressure
+			FROM match_sensor_samples
+			WHERE users_id = $1 AND matches_id = $2 AND NOT quarantined
+		) s
+		RETURNING average_stress, humidity, temperature, pressure`
 
 	args := []interface{}{
 		userMatch.UserID,
@@ -37,21 +74,24 @@ func (m UserMatchModel) Insert(userMatch *UserMatch) error {
 		userMatch.Humidity,
 		userMatch.Temperature,
 		userMatch.Pressure,
+		[]byte(userMatch.Extras),
+		userMatch.SchemaVersion,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-	return nil
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&userMatch.AverageStress,
+		&userMatch.Humidity,
+		&userMatch.Temperature,
+		&userMatch.Pressure,
+	)
 }
 
 func (m UserMatchModel) GetMatchesByUser(userID int64) ([]*UserMatch, error) {
 	query := `
 		SELECT users_id, matches_id, tournaments_id, result, average_stress, 
-			humidity, temperature, pressure
+			humidity, temperature, pressure, extras, COALESCE(schema_version, 0)
 		FROM users_matches
 		WHERE users_id = $1`
 
@@ -79,6 +119,8 @@ func (m UserMatchModel) GetMatchesByUser(userID int64) ([]*UserMatch, error) {
 			&match.Humidity,
 			&match.Temperature,
 			&match.Pressure,
+			(*[]byte)(&match.Extras),
+			&match.SchemaVersion,
 		)
 		if err != nil {
 			return nil, err
@@ -97,10 +139,18 @@ func (m UserMatchModel) GetMatchesByUser(userID int64) ([]*UserMatch, error) {
 func (m UserMatchModel) Update(userMatch *UserMatch) error {
 	query := `
 		UPDATE users_matches
-		SET result = $1, average_stress = $2, humidity = $3, temperature = $4, pressure = $5
-		WHERE users_id = $6 
-		 AND matches_id = $7 
-		 AND tournaments_id = $8`
+		SET result = $1, average_stress = COALESCE(s.stress, $2), humidity = COALESCE(s.humidity, $3),
+			temperature = COALESCE(s.temperature, $4), pressure = COALESCE(s.pressure, $5), extras = $6
+		FROM (
+			SELECT avg(stress) AS stress, avg(humidity) AS humidity,
+				avg(temperature) AS temperature, avg(pressure) AS pressure
+			FROM match_sensor_samples
+			WHERE users_id = $7 AND matches_id = $8 AND NOT quarantined
+		) s
+		WHERE users_id = $7 
+		 AND matches_id = $8 
+		 AND tournaments_id = $9
+		RETURNING average_stress, humidity, temperature, pressure`
 
 	args := []interface{}{
 		userMatch.Result,
@@ -108,13 +158,19 @@ func (m UserMatchModel) Update(userMatch *UserMatch) error {
 		userMatch.Humidity,
 		userMatch.Temperature,
 		userMatch.Pressure,
+		[]byte(userMatch.Extras),
 		userMatch.UserID,
 		userMatch.MatchID,
 		userMatch.TournamentID,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&userMatch.AverageStress,
+		&userMatch.Humidity,
+		&userMatch.Temperature,
+		&userMatch.Pressure,
+	)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -125,3 +181,96 @@ func (m UserMatchModel) Update(userMatch *UserMatch) error {
 	}
 	return nil
 }
+
+// PlayedMatch is a player's record for a match together with what analysis
+// needs to know about the match itself.
+type PlayedMatch struct {
+	MatchID        int64
+	TournamentID   int64
+	TournamentName string
+	GameID         int64
+	GameName       string
+	Stage          string
+	PlayedAt       time.Time
+	Outcome        string
+	Stress         *float64
+	Humidity       float64
+	Temperature    float64
+	Pressure       float64
+}
+
+// GetPlayedByUser returns a player's records in the order the matches were
+// played. Matches without a schedule count as played on the tournament's
+// start date. The outcome is taken from the match result where the player's
+// side can be told, from the team they were a member of on the day of the
+// match, and from the record's own result otherwise.
+func (m UserMatchModel) GetPlayedByUser(userID int64) ([]*PlayedMatch, error) {
+	query := `
+		SELECT um.matches_id, um.tournaments_id, t.tournaments_name, t.games_id, g.games_name, m.stage,
+			COALESCE(m.scheduled_at, t.start_date::timestamptz),
+			CASE
+				WHEN side.participants_id IS NULL OR m.status NOT IN ('finished', 'forfeit', 'no_show') THEN um.result
+				WHEN m.winner_participant_id = side.participants_id THEN 'win'
+				WHEN m.winner_participant_id IS NOT NULL THEN 'loss'
+				ELSE 'draw'
+			END,
+			um.average_stress, um.humidity, um.temperature, um.pressure
+		FROM users_matches um
+		INNER JOIN matches m ON m.matches_id = um.matches_id
+		INNER JOIN tournaments t ON t.tournaments_id = um.tournaments_id
+		INNER JOIN games g ON g.games_id = t.games_id
+		LEFT JOIN LATERAL (
+			SELECT min(p.participants_id) AS participants_id
+			FROM tournaments_participants p
+			LEFT JOIN teams_users tu ON tu.teams_id = p.teams_id AND tu.user_id = um.users_id
+				AND tu.join_date <= COALESCE(m.scheduled_at::date, t.start_date)
+				AND (tu.leave_date IS NULL OR tu.leave_date >= COALESCE(m.scheduled_at::date, t.start_date))
+			WHERE p.participants_id IN (m.home_participant_id, m.away_participant_id)
+			AND (p.users_id = um.users_id OR tu.user_id IS NOT NULL)
+			HAVING count(DISTINCT p.participants_id) = 1
+		) side ON true
+		WHERE um.users_id = $1
+		ORDER BY 7, um.matches_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	played := []*PlayedMatch{}
+
+	for rows.Next() {
+		var match PlayedMatch
+
+		err := rows.Scan(
+			&match.MatchID,
+			&match.TournamentID,
+			&match.TournamentName,
+			&match.GameID,
+			&match.GameName,
+			&match.Stage,
+			&match.PlayedAt,
+			&match.Outcome,
+			&match.Stress,
+			&match.Humidity,
+			&match.Temperature,
+			&match.Pressure,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		played = append(played, &match)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return played, nil
+}
@@ -158,6 +158,40 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	query := `
+		SELECT users_id, created_at, users_name, users_description, nationality, 
+			   birthday, email, password_hash, activated, verified_pro, version
+		FROM users
+		WHERE users_id = $1`
+
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Description,
+		&user.Nationality,
+		&user.Birthday,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.VerifiedPro,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 func (m UserModel) DeleteByEmail(email string) error {
 	query := `
 		DELETE FROM users
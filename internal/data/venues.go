@@ -0,0 +1,602 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateVenue   = errors.New("duplicate venue")
+	ErrDuplicateStation = errors.New("duplicate station")
+)
+
+// Thresholds are the environment limits of a venue. Unset limits are not
+// checked.
+type Thresholds struct {
+	MinTemperature *float64 `json:"min_temperature,omitempty"`
+	MaxTemperature *float64 `json:"max_temperature,omitempty"`
+	MinHumidity    *float64 `json:"min_humidity,omitempty"`
+	MaxHumidity    *float64 `json:"max_humidity,omitempty"`
+	MinPressure    *float64 `json:"min_pressure,omitempty"`
+	MaxPressure    *float64 `json:"max_pressure,omitempty"`
+}
+
+type Venue struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Address    string     `json:"address"`
+	TimeZone   string     `json:"time_zone"`
+	Thresholds Thresholds `json:"thresholds"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Version    int        `json:"version"`
+}
+
+type Station struct {
+	ID        int64     `json:"id"`
+	VenueID   int64     `json:"venue_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Reading is a station's measurement of the room around it.
+type Reading struct {
+	At          time.Time `json:"at"`
+	Humidity    float64   `json:"humidity"`
+	Temperature float64   `json:"temperature"`
+	Pressure    float64   `json:"pressure"`
+}
+
+const (
+	AlertAbove = "above"
+	AlertBelow = "below"
+)
+
+// StationAlert is raised when a station's readings leave its venue's limits
+// for a metric, and resolved once they are back within them.
+type StationAlert struct {
+	ID         int64      `json:"id"`
+	StationID  int64      `json:"station_id"`
+	Metric     string     `json:"metric"`
+	Kind       string     `json:"kind"`
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold"`
+	RaisedAt   time.Time  `json:"raised_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+func ValidateVenue(v *validator.Validator, venue *Venue) {
+	v.Check(venue.Name != "", "name", "must be provided")
+	v.Check(len(venue.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(venue.Address) <= 500, "address", "must not be more than 500 bytes long")
+
+	_, err := time.LoadLocation(venue.TimeZone)
+	v.Check(venue.TimeZone != "" && err == nil, "time_zone", "must be a valid IANA time zone")
+
+	t := venue.Thresholds
+	v.Check(t.MinTemperature == nil || t.MaxTemperature == nil || *t.MinTemperature < *t.MaxTemperature, "thresholds", "min_temperature must be below max_temperature")
+	v.Check(t.MinHumidity == nil || t.MaxHumidity == nil || *t.MinHumidity < *t.MaxHumidity, "thresholds", "min_humidity must be below max_humidity")
+	v.Check(t.MinPressure == nil || t.MaxPressure == nil || *t.MinPressure < *t.MaxPressure, "thresholds", "min_pressure must be below max_pressure")
+}
+
+func ValidateStation(v *validator.Validator, station *Station) {
+	v.Check(station.Name != "", "name", "must be provided")
+	v.Check(len(station.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+func ValidateReading(v *validator.Validator, reading *Reading, now time.Time) {
+	v.Check(!reading.At.IsZero(), "at", "must be provided")
+	v.Check(reading.At.Sub(now) <= maxSampleSkew, "at", "must not be in the future")
+	v.Check(reading.Humidity >= 0 && reading.Humidity <= 100, "humidity", "must be between 0 and 100")
+	v.Check(reading.Temperature >= -50 && reading.Temperature <= 100, "temperature", "must be between -50 and 100")
+	v.Check(reading.Pressure >= 0 && reading.Pressure <= 2000, "pressure", "must be between 0 and 2000")
+}
+
+// limit is one metric's allowed range as checked against a reading.
+type limit struct {
+	metric   string
+	value    float64
+	min, max *float64
+}
+
+func (t Thresholds) limits(reading *Reading) []limit {
+	return []limit{
+		{"temperature", reading.Temperature, t.MinTemperature, t.MaxTemperature},
+		{"humidity", reading.Humidity, t.MinHumidity, t.MaxHumidity},
+		{"pressure", reading.Pressure, t.MinPressure, t.MaxPressure},
+	}
+}
+
+type VenueModel struct {
+	DB *sql.DB
+}
+
+func (m VenueModel) Insert(venue *Venue) error {
+	query := `
+		INSERT INTO venues (venues_name, address, time_zone, min_temperature, max_temperature,
+			min_humidity, max_humidity, min_pressure, max_pressure)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING venues_id, created_at, version`
+
+	t := venue.Thresholds
+	args := []interface{}{venue.Name, venue.Address, venue.TimeZone, t.MinTemperature, t.MaxTemperature,
+		t.MinHumidity, t.MaxHumidity, t.MinPressure, t.MaxPressure}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&venue.ID, &venue.CreatedAt, &venue.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "venues_venues_name_key"`:
+			return ErrDuplicateVenue
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+const venueQuery = `
+	SELECT venues_id, venues_name, address, time_zone, min_temperature, max_temperature,
+		min_humidity, max_humidity, min_pressure, max_pressure, created_at, version
+	FROM venues`
+
+func scanVenue(row interface{ Scan(...interface{}) error }) (*Venue, error) {
+	var venue Venue
+
+	err := row.Scan(
+		&venue.ID,
+		&venue.Name,
+		&venue.Address,
+		&venue.TimeZone,
+		&venue.Thresholds.MinTemperature,
+		&venue.Thresholds.MaxTemperature,
+		&venue.Thresholds.MinHumidity,
+		&venue.Thresholds.MaxHumidity,
+		&venue.Thresholds.MinPressure,
+		&venue.Thresholds.MaxPressure,
+		&venue.CreatedAt,
+		&venue.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &venue, nil
+}
+
+func (m VenueModel) Get(id int64) (*Venue, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	venue, err := scanVenue(m.DB.QueryRowContext(ctx, venueQuery+` WHERE venues_id = $1`, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return venue, nil
+}
+
+func (m VenueModel) GetAll() ([]*Venue, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, venueQuery+` ORDER BY venues_name`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	venues := []*Venue{}
+
+	for rows.Next() {
+		venue, err := scanVenue(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		venues = append(venues, venue)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return venues, nil
+}
+
+func (m VenueModel) Update(venue *Venue) error {
+	query := `
+		UPDATE venues
+		SET venues_name = $1, address = $2, time_zone = $3, min_temperature = $4, max_temperature = $5,
+			min_humidity = $6, max_humidity = $7, min_pressure = $8, max_pressure = $9, version = version + 1
+		WHERE venues_id = $10 AND version = $11
+		RETURNING version`
+
+	t := venue.Thresholds
+	args := []interface{}{venue.Name, venue.Address, venue.TimeZone, t.MinTemperature, t.MaxTemperature,
+		t.MinHumidity, t.MaxHumidity, t.MinPressure, t.MaxPressure, venue.ID, venue.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&venue.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "venues_venues_name_key"`:
+			return ErrDuplicateVenue
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+type StationModel struct {
+	DB *sql.DB
+}
+
+func (m StationModel) Insert(station *Station) error {
+	query := `
+		INSERT INTO stations (venues_id, stations_name)
+		VALUES ($1, $2)
+		RETURNING stations_id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, station.VenueID, station.Name).Scan(&station.ID, &station.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "stations_venues_id_stations_name_key"`:
+			return ErrDuplicateStation
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m StationModel) Get(id int64) (*Station, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT stations_id, venues_id, stations_name, created_at
+		FROM stations
+		WHERE stations_id = $1`
+
+	var station Station
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&station.ID,
+		&station.VenueID,
+		&station.Name,
+		&station.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &station, nil
+}
+
+func (m StationModel) GetAllByVenue(venueID int64) ([]*Station, error) {
+	query := `
+		SELECT stations_id, venues_id, stations_name, created_at
+		FROM stations
+		WHERE venues_id = $1
+		ORDER BY stations_name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	stations := []*Station{}
+
+	for rows.Next() {
+		var station Station
+
+		err := rows.Scan(
+			&station.ID,
+			&station.VenueID,
+			&station.Name,
+			&station.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		stations = append(stations, &station)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stations, nil
+}
+
+// AddReadings stores a station's readings, skipping any it already has for
+// the same time, and checks the latest against the venue's thresholds unless
+// the station already has a newer reading, as a late batch says nothing about
+// conditions now. The device that took them is recorded if known. It returns
+// the alerts this raised and resolved.
+func (m StationModel) AddReadings(station *Station, deviceID int64, thresholds Thresholds, readings []Reading) (raised, resolved []*StationAlert, err error) {
+	if len(readings) == 0 {
+		return nil, nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	times := make([]time.Time, len(readings))
+	humidity := make([]float64, len(readings))
+	temperature := make([]float64, len(readings))
+	pressure := make([]float64, len(readings))
+
+	latest := &readings[0]
+
+	for i := range readings {
+		times[i] = readings[i].At
+		humidity[i] = readings[i].Humidity
+		temperature[i] = readings[i].Temperature
+		pressure[i] = readings[i].Pressure
+
+		if readings[i].At.After(latest.At) {
+			latest = &readings[i]
+		}
+	}
+
+	// Batches for the same station are taken one at a time, so that each sees
+	// the readings stored before it.
+	_, err = tx.ExecContext(ctx, `SELECT 1 FROM stations WHERE stations_id = $1 FOR UPDATE`, station.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var stored sql.NullTime
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT max(read_at) FROM stations_readings
+		WHERE stations_id = $1 AND NOT quarantined`, station.ID).Scan(&stored)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO stations_readings (stations_id, read_at, humidity, temperature, pressure, devices_id)
+		SELECT $1, r.*, NULLIF($6, 0)
+		FROM unnest($2::timestamptz[], $3::real[], $4::real[], $5::real[]) AS r
+		ON CONFLICT DO NOTHING`,
+		station.ID, pq.Array(times), pq.Array(humidity), pq.Array(temperature), pq.Array(pressure), deviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stored.Valid && !latest.At.After(stored.Time) {
+		return nil, nil, tx.Commit()
+	}
+
+	for _, l := range thresholds.limits(latest) {
+		var kind string
+		var threshold float64
+
+		switch {
+		case l.max != nil && l.value > *l.max:
+			kind, threshold = AlertAbove, *l.max
+		case l.min != nil && l.value < *l.min:
+			kind, threshold = AlertBelow, *l.min
+		}
+
+		if kind == "" {
+			alert := StationAlert{StationID: station.ID, Metric: l.metric}
+
+			err = tx.QueryRowContext(ctx, `
+				UPDATE stations_alerts
+				SET resolved_at = $3
+				WHERE stations_id = $1 AND metric = $2 AND resolved_at IS NULL
+				RETURNING alerts_id, kind, value, threshold, raised_at, resolved_at`,
+				station.ID, l.metric, latest.At).Scan(&alert.ID, &alert.Kind, &alert.Value, &alert.Threshold, &alert.RaisedAt, &alert.ResolvedAt)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+			case err != nil:
+				return nil, nil, err
+			default:
+				resolved = append(resolved, &alert)
+			}
+			continue
+		}
+
+		alert := StationAlert{
+			StationID: station.ID,
+			Metric:    l.metric,
+			Kind:      kind,
+			Value:     l.value,
+			Threshold: threshold,
+			RaisedAt:  latest.At,
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO stations_alerts (stations_id, metric, kind, value, threshold, raised_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (stations_id, metric) WHERE resolved_at IS NULL DO NOTHING
+			RETURNING alerts_id`,
+			alert.StationID, alert.Metric, alert.Kind, alert.Value, alert.Threshold, alert.RaisedAt).Scan(&alert.ID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// Already alerting on this metric.
+		case err != nil:
+			return nil, nil, err
+		default:
+			raised = append(raised, &alert)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return raised, resolved, nil
+}
+
+// GetAlertsByVenue returns the alerts of a venue's stations, newest first,
+// optionally only those still open.
+func (m StationModel) GetAlertsByVenue(venueID int64, openOnly bool) ([]*StationAlert, error) {
+	query := `
+		SELECT a.alerts_id, a.stations_id, a.metric, a.kind, a.value, a.threshold, a.raised_at, a.resolved_at
+		FROM stations_alerts a
+		INNER JOIN stations s ON s.stations_id = a.stations_id
+		WHERE s.venues_id = $1
+		AND (NOT $2 OR a.resolved_at IS NULL)
+		ORDER BY a.raised_at DESC, a.alerts_id DESC
+		LIMIT 500`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID, openOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	alerts := []*StationAlert{}
+
+	for rows.Next() {
+		var alert StationAlert
+
+		err := rows.Scan(
+			&alert.ID,
+			&alert.StationID,
+			&alert.Metric,
+			&alert.Kind,
+			&alert.Value,
+			&alert.Threshold,
+			&alert.RaisedAt,
+			&alert.ResolvedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		alerts = append(alerts, &alert)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// Range summarises one metric over a period.
+type Range struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+type EnvironmentBucket struct {
+	StationID   int64     `json:"station_id"`
+	Start       time.Time `json:"start"`
+	Count       int       `json:"count"`
+	Humidity    Range     `json:"humidity"`
+	Temperature Range     `json:"temperature"`
+	Pressure    Range     `json:"pressure"`
+}
+
+// GetEnvironment returns the readings of a venue's stations in [from, to),
+// grouped per station into buckets of the given resolution. Quarantined
+// readings are left out.
+func (m StationModel) GetEnvironment(venueID int64, from, to time.Time, resolution time.Duration) ([]*EnvironmentBucket, error) {
+	query := `
+		SELECT r.stations_id,
+			to_timestamp(floor(extract(epoch FROM r.read_at) / $4) * $4) AS bucket,
+			count(*),
+			min(r.humidity), avg(r.humidity), max(r.humidity),
+			min(r.temperature), avg(r.temperature), max(r.temperature),
+			min(r.pressure), avg(r.pressure), max(r.pressure)
+		FROM stations_readings r
+		INNER JOIN stations s ON s.stations_id = r.stations_id
+		WHERE s.venues_id = $1 AND r.read_at >= $2 AND r.read_at < $3 AND NOT r.quarantined
+		GROUP BY r.stations_id, bucket
+		ORDER BY r.stations_id, bucket`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID, from, to, resolution.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	buckets := []*EnvironmentBucket{}
+
+	for rows.Next() {
+		var b EnvironmentBucket
+
+		err := rows.Scan(
+			&b.StationID,
+			&b.Start,
+			&b.Count,
+			&b.Humidity.Min, &b.Humidity.Avg, &b.Humidity.Max,
+			&b.Temperature.Min, &b.Temperature.Avg, &b.Temperature.Max,
+			&b.Pressure.Min, &b.Pressure.Avg, &b.Pressure.Max,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		buckets = append(buckets, &b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
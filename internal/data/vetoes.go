@@ -0,0 +1,510 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+const (
+	VetoBan     = "ban"
+	VetoPick    = "pick"
+	VetoDecider = "decider"
+
+	SideHome = "home"
+	SideAway = "away"
+
+	VetoInProgress = "in_progress"
+	VetoCompleted  = "completed"
+	VetoCancelled  = "cancelled"
+)
+
+var (
+	ErrVetoExists  = errors.New("match already has a veto")
+	ErrVetoClosed  = errors.New("veto is not in progress")
+	ErrNotYourTurn = errors.New("not the participant's turn")
+	ErrMapTaken    = errors.New("map is not available")
+)
+
+// VetoStep is one turn of a veto sequence. Deciders have no side: they take
+// the last map left in the pool.
+type VetoStep struct {
+	Action string `json:"action"`
+	Side   string `json:"side,omitempty"`
+}
+
+type VetoAction struct {
+	Step          int       `json:"step"`
+	Action        string    `json:"action"`
+	ParticipantID int64     `json:"participant_id,omitempty"`
+	Map           string    `json:"map"`
+	Auto          bool      `json:"auto"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Veto is a map pick/ban session bound to a match. Remaining, Next and
+// TurnEndsAt are derived from the stored state for clients.
+type Veto struct {
+	ID                int64        `json:"id"`
+	MatchID           int64        `json:"match_id"`
+	TournamentID      int64        `json:"tournament_id"`
+	HomeParticipantID int64        `json:"home_participant_id"`
+	AwayParticipantID int64        `json:"away_participant_id"`
+	Sequence          []VetoStep   `json:"sequence"`
+	MapPool           []string     `json:"map_pool"`
+	TurnSeconds       int          `json:"turn_seconds"`
+	Status            string       `json:"status"`
+	Step              int          `json:"step"`
+	TurnStartedAt     time.Time    `json:"turn_started_at"`
+	Actions           []VetoAction `json:"actions"`
+	Remaining         []string     `json:"remaining"`
+	Next              *VetoStep    `json:"next,omitempty"`
+	TurnEndsAt        *time.Time   `json:"turn_ends_at,omitempty"`
+	CreatedAt         time.Time    `json:"created_at"`
+	CompletedAt       *time.Time   `json:"completed_at,omitempty"`
+	Version           int          `json:"version"`
+}
+
+func ValidateMapPool(v *validator.Validator, pool []string) {
+	seen := make(map[string]bool)
+	for _, name := range pool {
+		v.Check(strings.TrimSpace(name) != "", "map_pool", "map names must be provided")
+		v.Check(len(name) <= 100, "map_pool", "map names must not be more than 100 bytes long")
+		v.Check(!seen[name], "map_pool", "map names must be unique")
+		seen[name] = true
+	}
+}
+
+// ValidateVetoSequence checks that the sequence can be played out on the
+// pool and that it ends with at least one map to play.
+func ValidateVetoSequence(v *validator.Validator, key string, sequence []VetoStep, pool []string) {
+	v.Check(len(sequence) > 0, key, "must be provided")
+	v.Check(len(sequence) <= len(pool), key, "must not have more steps than there are maps in the pool")
+
+	picks := 0
+	for i, step := range sequence {
+		switch step.Action {
+		case VetoBan, VetoPick:
+			v.Check(validator.In(step.Side, SideHome, SideAway), key, fmt.Sprintf("step %d must be taken by home or away", i+1))
+		case VetoDecider:
+			v.Check(step.Side == "", key, "deciders must not have a side")
+			v.Check(i > 0 && i == len(sequence)-1, key, "a decider can only be the last step after at least one other")
+		default:
+			v.AddError(key, fmt.Sprintf("step %d must be a ban, pick or decider", i+1))
+		}
+		if step.Action != VetoBan {
+			picks++
+		}
+	}
+
+	v.Check(picks > 0, key, "must pick at least one map")
+}
+
+func ValidateVeto(v *validator.Validator, veto *Veto) {
+	v.Check(len(veto.MapPool) > 0, "map_pool", "must be provided")
+	ValidateMapPool(v, veto.MapPool)
+	ValidateVetoSequence(v, "sequence", veto.Sequence, veto.MapPool)
+	v.Check(veto.TurnSeconds > 0, "turn_seconds", "must be greater than 0")
+	v.Check(veto.TurnSeconds <= 3600, "turn_seconds", "must not be more than an hour")
+}
+
+// remaining returns the maps not yet banned or picked, in pool order.
+func (veto *Veto) remaining() []string {
+	taken := make(map[string]bool)
+	for _, a := range veto.Actions {
+		taken[a.Map] = true
+	}
+
+	maps := []string{}
+	for _, name := range veto.MapPool {
+		if !taken[name] {
+			maps = append(maps, name)
+		}
+	}
+	return maps
+}
+
+func (veto *Veto) sideOf(side string) int64 {
+	if side == SideHome {
+		return veto.HomeParticipantID
+	}
+	return veto.AwayParticipantID
+}
+
+// Picks returns the maps to be played, in the order they were picked.
+func (veto *Veto) Picks() []string {
+	picks := []string{}
+	for _, a := range veto.Actions {
+		if a.Action != VetoBan {
+			picks = append(picks, a.Map)
+		}
+	}
+	return picks
+}
+
+// take records the current step and moves on, playing a trailing decider
+// straight away and completing the veto after the last step.
+func (veto *Veto) take(mapName string, auto bool, at time.Time) {
+	step := veto.Sequence[veto.Step]
+
+	veto.Actions = append(veto.Actions, VetoAction{
+		Step:          veto.Step,
+		Action:        step.Action,
+		ParticipantID: veto.sideOf(step.Side),
+		Map:           mapName,
+		Auto:          auto,
+		CreatedAt:     at,
+	})
+	veto.Step++
+	veto.TurnStartedAt = at
+
+	if veto.Step < len(veto.Sequence) && veto.Sequence[veto.Step].Action == VetoDecider {
+		veto.take(veto.remaining()[0], true, at)
+		return
+	}
+
+	if veto.Step == len(veto.Sequence) {
+		veto.Status = VetoCompleted
+		veto.CompletedAt = &at
+	}
+}
+
+// expire plays every turn that ran out before now with the first map left in
+// the pool, so that a missing captain can't stall the veto.
+func (veto *Veto) expire(now time.Time) {
+	turn := time.Duration(veto.TurnSeconds) * time.Second
+
+	for veto.Status == VetoInProgress && !now.Before(veto.TurnStartedAt.Add(turn)) {
+		veto.take(veto.remaining()[0], true, veto.TurnStartedAt.Add(turn))
+	}
+}
+
+// describe fills in the derived fields.
+func (veto *Veto) describe() {
+	veto.Remaining = veto.remaining()
+	veto.Next = nil
+	veto.TurnEndsAt = nil
+
+	if veto.Status == VetoInProgress {
+		step := veto.Sequence[veto.Step]
+		ends := veto.TurnStartedAt.Add(time.Duration(veto.TurnSeconds) * time.Second)
+		veto.Next = &step
+		veto.TurnEndsAt = &ends
+	}
+}
+
+type VetoModel struct {
+	DB *sql.DB
+}
+
+// Insert starts a veto for the match. Its first turn begins immediately.
+func (m VetoModel) Insert(veto *Veto) error {
+	sequence, err := json.Marshal(veto.Sequence)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO matches_vetoes (matches_id, sequence, map_pool, turn_seconds)
+		VALUES ($1, $2, $3, $4)
+		RETURNING vetoes_id, status, step, turn_started_at, created_at, version`
+
+	args := []interface{}{veto.MatchID, sequence, pq.Array(veto.MapPool), veto.TurnSeconds}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&veto.ID,
+		&veto.Status,
+		&veto.Step,
+		&veto.TurnStartedAt,
+		&veto.CreatedAt,
+		&veto.Version,
+	)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `"idx_matches_vetoes_active"`):
+			return ErrVetoExists
+		default:
+			return err
+		}
+	}
+
+	veto.Actions = []VetoAction{}
+	veto.describe()
+	return nil
+}
+
+const vetoQuery = `
+	SELECT v.vetoes_id, v.matches_id, m.tournaments_id, COALESCE(m.home_participant_id, 0), COALESCE(m.away_participant_id, 0),
+		v.sequence, v.map_pool, v.turn_seconds, v.status, v.step, v.turn_started_at, v.created_at,
+		v.completed_at, v.version
+	FROM matches_vetoes v
+	INNER JOIN matches m ON m.matches_id = v.matches_id`
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getVeto(ctx context.Context, q querier, filter string, args ...interface{}) (*Veto, error) {
+	var veto Veto
+	var sequence []byte
+
+	err := q.QueryRowContext(ctx, vetoQuery+" "+filter, args...).Scan(
+		&veto.ID,
+		&veto.MatchID,
+		&veto.TournamentID,
+		&veto.HomeParticipantID,
+		&veto.AwayParticipantID,
+		&sequence,
+		pq.Array(&veto.MapPool),
+		&veto.TurnSeconds,
+		&veto.Status,
+		&veto.Step,
+		&veto.TurnStartedAt,
+		&veto.CreatedAt,
+		&veto.CompletedAt,
+		&veto.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(sequence, &veto.Sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT step, action, COALESCE(participants_id, 0), map_name, auto, created_at
+		FROM matches_vetoes_actions
+		WHERE vetoes_id = $1
+		ORDER BY step`, veto.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	veto.Actions = []VetoAction{}
+
+	for rows.Next() {
+		var a VetoAction
+
+		err := rows.Scan(&a.Step, &a.Action, &a.ParticipantID, &a.Map, &a.Auto, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		veto.Actions = append(veto.Actions, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &veto, nil
+}
+
+// GetByMatch returns the most recent veto of the match as stored. It only
+// reads: turns that have timed out are played out by Act and ExpireTurns.
+func (m VetoModel) GetByMatch(matchID int64) (*Veto, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	veto, err := getVeto(ctx, m.DB, `WHERE v.matches_id = $1 ORDER BY v.created_at DESC, v.vetoes_id DESC LIMIT 1`, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	veto.describe()
+	return veto, nil
+}
+
+// Act plays the current turn for participantID with the given map. Expired
+// turns are played out first, so the participant may find it's no longer
+// their turn. A zero participant only plays out expired turns.
+func (m VetoModel) Act(vetoID, participantID int64, mapName string) (*Veto, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	veto, err := getVeto(ctx, tx, `WHERE v.vetoes_id = $1 FOR UPDATE OF v`, vetoID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := len(veto.Actions)
+	now := time.Now()
+
+	veto.expire(now)
+
+	if participantID != 0 {
+		if veto.Status != VetoInProgress {
+			return nil, ErrVetoClosed
+		}
+
+		if veto.sideOf(veto.Sequence[veto.Step].Side) != participantID {
+			return nil, ErrNotYourTurn
+		}
+
+		if !validator.In(mapName, veto.remaining()...) {
+			return nil, ErrMapTaken
+		}
+
+		veto.take(mapName, false, now)
+	}
+
+	if len(veto.Actions) > stored {
+		err = saveVeto(ctx, tx, veto, stored)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	veto.describe()
+	return veto, nil
+}
+
+// ExpireTurns plays out the timed out turns of every running veto and returns
+// the vetoes that were moved on.
+func (m VetoModel) ExpireTurns() ([]*Veto, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT vetoes_id
+		FROM matches_vetoes
+		WHERE status = 'in_progress'
+		AND turn_started_at + make_interval(secs => turn_seconds) <= NOW()`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	vetoes := []*Veto{}
+
+	for _, id := range ids {
+		veto, err := m.Act(id, 0, "")
+		if err != nil {
+			return nil, err
+		}
+
+		vetoes = append(vetoes, veto)
+	}
+
+	return vetoes, nil
+}
+
+// saveVeto stores the actions from index from onwards together with the
+// session state and, once the veto is complete, writes its picks into the
+// match's per-map breakdown.
+func saveVeto(ctx context.Context, tx *sql.Tx, veto *Veto, from int) error {
+	for _, a := range veto.Actions[from:] {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO matches_vetoes_actions (vetoes_id, step, action, participants_id, map_name, auto, created_at)
+			VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7)`,
+			veto.ID, a.Step, a.Action, a.ParticipantID, a.Map, a.Auto, a.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := tx.QueryRowContext(ctx, `
+		UPDATE matches_vetoes
+		SET status = $1, step = $2, turn_started_at = $3, completed_at = $4, version = version + 1
+		WHERE vetoes_id = $5
+		RETURNING version`,
+		veto.Status, veto.Step, veto.TurnStartedAt, veto.CompletedAt, veto.ID).Scan(&veto.Version)
+	if err != nil {
+		return err
+	}
+
+	if veto.Status != VetoCompleted {
+		return nil
+	}
+
+	for i, name := range veto.Picks() {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO matches_maps (matches_id, map_number, map_name)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (matches_id, map_number) DO UPDATE SET map_name = EXCLUDED.map_name`,
+			veto.MatchID, i+1, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE matches SET version = version + 1 WHERE matches_id = $1`, veto.MatchID)
+	return err
+}
+
+// Cancel stops a running veto so that a new one can be started.
+func (m VetoModel) Cancel(matchID int64) error {
+	query := `
+		UPDATE matches_vetoes
+		SET status = 'cancelled', version = version + 1
+		WHERE matches_id = $1 AND status = 'in_progress'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, matchID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrVetoClosed
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("events: hub closed")
+
+// Event is a single message on one or more topics. IDs are unique and
+// increasing across the whole hub, which is what lets a client resume any
+// topic from the last ID it saw.
+type Event struct {
+	ID   uint64
+	Type string
+	Data []byte
+	At   time.Time
+}
+
+func MatchTopic(id int64) string {
+	return fmt.Sprintf("match:%d", id)
+}
+
+func TournamentTopic(id int64) string {
+	return fmt.Sprintf("tournament:%d", id)
+}
+
+type topic struct {
+	buffer  []Event
+	evicted uint64
+	subs    map[*Subscription]struct{}
+}
+
+// Subscription delivers the events of a topic on C. C is closed when the
+// subscriber falls too far behind or the hub shuts down.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	topic string
+}
+
+// Hub is an in-process publish/subscribe broker. Each topic keeps a bounded
+// buffer of recent events for replay; subscribers that can't keep up are
+// dropped rather than slowing publishers down.
+type Hub struct {
+	mu         sync.Mutex
+	firstID    uint64
+	lastID     uint64
+	topics     map[string]*topic
+	replaySize int
+	subBuffer  int
+	maxAge     time.Duration
+	forgotten  uint64
+	closed     bool
+}
+
+// New creates a hub keeping up to replaySize events per topic for at most
+// maxAge, and buffering up to subBuffer undelivered events per subscriber.
+// IDs start from the current time so that they keep increasing across
+// restarts.
+func New(replaySize, subBuffer int, maxAge time.Duration) *Hub {
+	start := uint64(time.Now().UnixMilli())
+
+	return &Hub{
+		firstID:    start + 1,
+		lastID:     start,
+		topics:     make(map[string]*topic),
+		replaySize: replaySize,
+		subBuffer:  subBuffer,
+		maxAge:     maxAge,
+	}
+}
+
+// Publish sends payload, encoded as JSON, to every subscriber of the given
+// topics and records it for replay.
+func (h *Hub) Publish(typ string, payload interface{}, topics ...string) error {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return ErrClosed
+	}
+
+	h.lastID++
+	event := Event{ID: h.lastID, Type: typ, Data: js, At: time.Now()}
+
+	for _, name := range topics {
+		t := h.topic(name)
+
+		t.buffer = append(t.buffer, event)
+		if len(t.buffer) > h.replaySize {
+			t.evicted = t.buffer[0].ID
+			t.buffer = t.buffer[1:]
+		}
+
+		for sub := range t.subs {
+			select {
+			case sub.c <- event:
+			default:
+				delete(t.subs, sub)
+				close(sub.c)
+			}
+		}
+	}
+
+	return nil
+}
+
+// topic returns the named topic, creating it if needed. A new topic may have
+// existed before and been pruned, so it counts everything up to the newest
+// pruned event as evicted. h.mu must be held.
+func (h *Hub) topic(name string) *topic {
+	t, ok := h.topics[name]
+	if !ok {
+		t = &topic{evicted: h.forgotten, subs: make(map[*Subscription]struct{})}
+		h.topics[name] = t
+	}
+	return t
+}
+
+// Subscribe starts delivering the events of a topic and returns the buffered
+// events published after lastID. complete is false if some events after
+// lastID can no longer be replayed, because they were evicted from the buffer
+// or published before the hub was started.
+func (h *Hub) Subscribe(name string, lastID uint64) (sub *Subscription, replay []Event, complete bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, nil, false, ErrClosed
+	}
+
+	t := h.topic(name)
+
+	complete = true
+
+	if lastID > 0 {
+		for _, e := range t.buffer {
+			if e.ID > lastID {
+				replay = append(replay, e)
+			}
+		}
+
+		complete = lastID >= t.evicted && lastID+1 >= h.firstID
+	}
+
+	c := make(chan Event, h.subBuffer)
+	sub = &Subscription{C: c, c: c, topic: name}
+	t.subs[sub] = struct{}{}
+
+	return sub, replay, complete, nil
+}
+
+// Unsubscribe stops delivery to sub. It is safe to call more than once and
+// after the subscription was dropped.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.topics[sub.topic]
+	if !ok {
+		return
+	}
+
+	if _, ok := t.subs[sub]; ok {
+		delete(t.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Prune forgets buffered events older than the hub's maximum age and topics
+// left with neither events nor subscribers.
+func (h *Hub) Prune() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := time.Now().Add(-h.maxAge)
+
+	for name, t := range h.topics {
+		i := 0
+		for i < len(t.buffer) && t.buffer[i].At.Before(cutoff) {
+			t.evicted = t.buffer[i].ID
+			i++
+		}
+		t.buffer = t.buffer[i:]
+
+		if len(t.buffer) == 0 && len(t.subs) == 0 {
+			if t.evicted > h.forgotten {
+				h.forgotten = t.evicted
+			}
+			delete(h.topics, name)
+		}
+	}
+}
+
+// Close ends every subscription and rejects further publishing, letting
+// streaming handlers return before the server shuts down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	for _, t := range h.topics {
+		for sub := range t.subs {
+			close(sub.c)
+		}
+		t.subs = nil
+	}
+}
@@ -0,0 +1,106 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	timeFormat = "20060102T150405Z"
+	lineLimit  = 75
+)
+
+// Event is a single VEVENT. The UID must stay the same for the lifetime of
+// the event and Sequence must grow every time it is rescheduled, so calendar
+// clients update the existing entry instead of adding a new one.
+type Event struct {
+	UID         string
+	Sequence    int
+	Stamp       time.Time
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+}
+
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Write encodes the calendar as RFC 5545 text with CRLF line endings and long
+// lines folded.
+func (c *Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Maestro//Maestro API//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("SEQUENCE", strconv.Itoa(e.Sequence))
+		line("DTSTAMP", e.Stamp.UTC().Format(timeFormat))
+		line("DTSTART", e.Start.UTC().Format(timeFormat))
+		line("DTEND", e.End.UTC().Format(timeFormat))
+		line("SUMMARY", escape(e.Summary))
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	return bw.Flush()
+}
+
+// escape applies the TEXT value escaping from RFC 5545 section 3.3.11.
+func escape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	)
+	return r.Replace(s)
+}
+
+// writeFolded writes a content line, folding it so that no physical line is
+// longer than 75 octets without splitting a UTF-8 sequence.
+func writeFolded(w *bufio.Writer, s string) {
+	limit := lineLimit
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards the limit.
+		limit = lineLimit - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
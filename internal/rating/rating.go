@@ -0,0 +1,189 @@
+package rating
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	SystemElo     = "elo"
+	SystemGlicko2 = "glicko2"
+)
+
+var Systems = []string{SystemElo, SystemGlicko2}
+
+// Outcomes of a match from one side's point of view.
+const (
+	Loss = 0.0
+	Draw = 0.5
+	Win  = 1.0
+)
+
+const (
+	initialRating     = 1500
+	initialDeviation  = 350
+	initialVolatility = 0.06
+
+	// eloK is how far a single Elo result can move a rating.
+	eloK = 32
+
+	// tau constrains how quickly a Glicko-2 volatility can change.
+	tau = 0.5
+
+	// glickoScale converts between the Glicko and Glicko-2 scales.
+	glickoScale = 173.7178
+
+	convergence = 0.000001
+)
+
+// Period is the Glicko-2 rating period. A rating's deviation grows by one
+// period's worth of volatility for every period its owner goes without
+// playing, so that the rating of someone long absent moves quickly again.
+const Period = 7 * 24 * time.Hour
+
+// Rating is the skill estimate of a player or team. Deviation and Volatility
+// are only used by Glicko-2; Elo ratings leave them at zero.
+type Rating struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+	Matches    int
+	LastPlayed time.Time
+}
+
+// New returns the rating someone starts with under the system.
+func New(system string) Rating {
+	if system == SystemGlicko2 {
+		return Rating{Rating: initialRating, Deviation: initialDeviation, Volatility: initialVolatility}
+	}
+	return Rating{Rating: initialRating}
+}
+
+// Decay returns the rating as of at, with the Glicko-2 deviation grown for
+// the time since it was last played, up to that of a new rating.
+func Decay(system string, r Rating, at time.Time) Rating {
+	if system != SystemGlicko2 || r.LastPlayed.IsZero() || !at.After(r.LastPlayed) {
+		return r
+	}
+
+	periods := float64(at.Sub(r.LastPlayed)) / float64(Period)
+	phi := r.Deviation / glickoScale
+
+	phi = math.Sqrt(phi*phi + r.Volatility*r.Volatility*periods)
+	r.Deviation = math.Min(phi*glickoScale, initialDeviation)
+
+	return r
+}
+
+// Update returns the rating after a match played at the given time against an
+// opponent, where score is Win, Draw or Loss. Both ratings are expected to be
+// from before the match.
+func Update(system string, r, opponent Rating, score float64, at time.Time) Rating {
+	r = Decay(system, r, at)
+	opponent = Decay(system, opponent, at)
+
+	if system == SystemGlicko2 {
+		r = updateGlicko2(r, opponent, score)
+	} else {
+		expected := 1 / (1 + math.Pow(10, (opponent.Rating-r.Rating)/400))
+		r.Rating += eloK * (score - expected)
+	}
+
+	r.Matches++
+	r.LastPlayed = at
+
+	return r
+}
+
+// Average combines the ratings of several players into one opponent, for
+// rating each player of a team against the players of the other.
+func Average(ratings []Rating) Rating {
+	var avg Rating
+	if len(ratings) == 0 {
+		return avg
+	}
+
+	var variance float64
+	for _, r := range ratings {
+		avg.Rating += r.Rating
+		avg.Volatility += r.Volatility
+		variance += r.Deviation * r.Deviation
+	}
+
+	n := float64(len(ratings))
+	avg.Rating /= n
+	avg.Volatility /= n
+	avg.Deviation = math.Sqrt(variance / n)
+
+	return avg
+}
+
+// updateGlicko2 treats the match as a rating period of its own, following
+// Glickman's "Example of the Glicko-2 system".
+func updateGlicko2(r, opponent Rating, score float64) Rating {
+	mu := (r.Rating - initialRating) / glickoScale
+	phi := r.Deviation / glickoScale
+	sigma := r.Volatility
+
+	muJ := (opponent.Rating - initialRating) / glickoScale
+	phiJ := opponent.Deviation / glickoScale
+
+	g := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+	e := 1 / (1 + math.Exp(-g*(mu-muJ)))
+
+	v := 1 / (g * g * e * (1 - e))
+	delta := v * g * (score - e)
+
+	sigma = volatility(phi, sigma, v, delta)
+
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * g * (score - e)
+
+	r.Rating = mu*glickoScale + initialRating
+	r.Deviation = math.Min(phi*glickoScale, initialDeviation)
+	r.Volatility = sigma
+
+	return r
+}
+
+// volatility finds the new volatility with the Illinois algorithm.
+func volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+
+	for math.Abs(B-A) > convergence {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
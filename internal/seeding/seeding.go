@@ -0,0 +1,346 @@
+package seeding
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/WrastAct/maestro/internal/rating"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+const (
+	MethodRating    = "rating"
+	MethodPlacement = "placement"
+	MethodRegion    = "region"
+	MethodManual    = "manual"
+)
+
+var (
+	ErrUnknownParticipant = errors.New("unknown participant")
+	ErrIncompleteOrder    = errors.New("manual order must list every participant exactly once")
+)
+
+// Entry is a single participant as seen by the seeding engine.
+type Entry struct {
+	ID        int64
+	Rating    float64
+	Placement int
+	Region    string
+	Group     string
+}
+
+// Override pins a participant to a specific seed regardless of the method.
+type Override struct {
+	ParticipantID int64 `json:"participant_id"`
+	Seed          int   `json:"seed"`
+}
+
+// Options control the seeding. With a RatingSystem, participants are rated by
+// their skill rating in the tournament's game under that system rather than
+// by the rating entered when they registered.
+type Options struct {
+	Method          string     `json:"method"`
+	RatingSystem    string     `json:"rating_system"`
+	ManualOrder     []int64    `json:"manual_order"`
+	Overrides       []Override `json:"overrides"`
+	AvoidSameRegion bool       `json:"avoid_same_region"`
+	AvoidSameGroup  bool       `json:"avoid_same_group"`
+}
+
+type Seed struct {
+	ParticipantID int64 `json:"participant_id"`
+	Seed          int   `json:"seed"`
+}
+
+// Pair is a round one meeting. A zero Low means the High seed receives a bye.
+type Pair struct {
+	High int64 `json:"high"`
+	Low  int64 `json:"low"`
+}
+
+type Result struct {
+	Seeds     []Seed `json:"seeds"`
+	RoundOne  []Pair `json:"round_one"`
+	Conflicts []Pair `json:"conflicts"`
+}
+
+func ValidateOptions(v *validator.Validator, opts Options, participants int) {
+	v.Check(validator.In(opts.Method, MethodRating, MethodPlacement, MethodRegion, MethodManual), "method", "must be one of rating, placement, region or manual")
+
+	v.Check(opts.RatingSystem == "" || validator.In(opts.RatingSystem, rating.Systems...), "rating_system", "must be elo or glicko2")
+
+	if opts.Method == MethodManual {
+		v.Check(len(opts.ManualOrder) == participants, "manual_order", "must list every participant")
+	}
+
+	seeds := make(map[int]bool)
+	ids := make(map[int64]bool)
+	for _, o := range opts.Overrides {
+		v.Check(o.Seed >= 1 && o.Seed <= participants, "overrides", "seed must be between 1 and the number of participants")
+		v.Check(!seeds[o.Seed], "overrides", "must not assign the same seed twice")
+		v.Check(!ids[o.ParticipantID], "overrides", "must not pin the same participant twice")
+		seeds[o.Seed] = true
+		ids[o.ParticipantID] = true
+	}
+}
+
+// Compute orders the entries according to opts, applies the pinned overrides
+// and then, if requested, swaps lower seeds between round one pairs to keep
+// participants from the same region or group apart.
+func Compute(entries []Entry, opts Options) (*Result, error) {
+	byID := make(map[int64]Entry, len(entries))
+	for _, e := range entries {
+		byID[e.ID] = e
+	}
+
+	order, err := rank(entries, opts, byID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, pinned, err := applyOverrides(order, opts.Overrides, byID)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := func(a, b int64) bool {
+		if a == 0 || b == 0 {
+			return false
+		}
+		ea, eb := byID[a], byID[b]
+		if opts.AvoidSameRegion && ea.Region != "" && ea.Region == eb.Region {
+			return true
+		}
+		if opts.AvoidSameGroup && ea.Group != "" && ea.Group == eb.Group {
+			return true
+		}
+		return false
+	}
+
+	if opts.AvoidSameRegion || opts.AvoidSameGroup {
+		protect(order, pinned, conflicts)
+	}
+
+	result := &Result{
+		Seeds:     make([]Seed, len(order)),
+		RoundOne:  []Pair{},
+		Conflicts: []Pair{},
+	}
+
+	for i, id := range order {
+		result.Seeds[i] = Seed{ParticipantID: id, Seed: i + 1}
+	}
+
+	for _, p := range pairings(order) {
+		result.RoundOne = append(result.RoundOne, p)
+		if conflicts(p.High, p.Low) {
+			result.Conflicts = append(result.Conflicts, p)
+		}
+	}
+
+	return result, nil
+}
+
+func rank(entries []Entry, opts Options, byID map[int64]Entry) ([]int64, error) {
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+
+	byRating := func(i, j int) bool {
+		if sorted[i].Rating != sorted[j].Rating {
+			return sorted[i].Rating > sorted[j].Rating
+		}
+		return sorted[i].ID < sorted[j].ID
+	}
+
+	switch opts.Method {
+	case MethodManual:
+		if len(opts.ManualOrder) != len(entries) {
+			return nil, ErrIncompleteOrder
+		}
+		seen := make(map[int64]bool, len(entries))
+		for _, id := range opts.ManualOrder {
+			if _, ok := byID[id]; !ok {
+				return nil, ErrUnknownParticipant
+			}
+			if seen[id] {
+				return nil, ErrIncompleteOrder
+			}
+			seen[id] = true
+		}
+		order := make([]int64, len(opts.ManualOrder))
+		copy(order, opts.ManualOrder)
+		return order, nil
+
+	case MethodPlacement:
+		// Participants without a previous placement go after those with one,
+		// ordered among themselves by rating.
+		sort.SliceStable(sorted, func(i, j int) bool {
+			pi, pj := sorted[i].Placement, sorted[j].Placement
+			switch {
+			case pi > 0 && pj > 0 && pi != pj:
+				return pi < pj
+			case pi > 0 && pj == 0:
+				return true
+			case pi == 0 && pj > 0:
+				return false
+			}
+			return byRating(i, j)
+		})
+
+	case MethodRegion:
+		// Interleave regions so that every region's best participant is
+		// seeded before any region's second best, and so on.
+		sort.SliceStable(sorted, byRating)
+		regions := []string{}
+		buckets := make(map[string][]Entry)
+		for _, e := range sorted {
+			if _, ok := buckets[e.Region]; !ok {
+				regions = append(regions, e.Region)
+			}
+			buckets[e.Region] = append(buckets[e.Region], e)
+		}
+		interleaved := make([]Entry, 0, len(sorted))
+		for len(interleaved) < len(sorted) {
+			for _, region := range regions {
+				if len(buckets[region]) > 0 {
+					interleaved = append(interleaved, buckets[region][0])
+					buckets[region] = buckets[region][1:]
+				}
+			}
+		}
+		sorted = interleaved
+
+	default:
+		sort.SliceStable(sorted, byRating)
+	}
+
+	order := make([]int64, len(sorted))
+	for i, e := range sorted {
+		order[i] = e.ID
+	}
+	return order, nil
+}
+
+func applyOverrides(order []int64, overrides []Override, byID map[int64]Entry) ([]int64, map[int]bool, error) {
+	pinned := make(map[int]bool, len(overrides))
+	if len(overrides) == 0 {
+		return order, pinned, nil
+	}
+
+	result := make([]int64, len(order))
+	isPinned := make(map[int64]bool, len(overrides))
+
+	for _, o := range overrides {
+		if _, ok := byID[o.ParticipantID]; !ok {
+			return nil, nil, ErrUnknownParticipant
+		}
+		result[o.Seed-1] = o.ParticipantID
+		pinned[o.Seed-1] = true
+		isPinned[o.ParticipantID] = true
+	}
+
+	i := 0
+	for _, id := range order {
+		if isPinned[id] {
+			continue
+		}
+		for pinned[i] {
+			i++
+		}
+		result[i] = id
+		i++
+	}
+
+	return result, pinned, nil
+}
+
+// bracketSize returns the smallest power of two able to hold n participants.
+func bracketSize(n int) int {
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	return size
+}
+
+// bracketOrder returns the seeds in standard bracket order, so that the top
+// two seeds can only meet in the final: 1, 8, 4, 5, 2, 7, 3, 6 for eight.
+func bracketOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		total := len(order)*2 + 1
+		for _, s := range order {
+			next = append(next, s, total-s)
+		}
+		order = next
+	}
+	return order
+}
+
+func pairings(order []int64) []Pair {
+	if len(order) == 0 {
+		return nil
+	}
+
+	size := bracketSize(len(order))
+	if size < 2 {
+		size = 2
+	}
+
+	at := func(seed int) int64 {
+		if seed > len(order) {
+			return 0
+		}
+		return order[seed-1]
+	}
+
+	slots := bracketOrder(size)
+	pairs := make([]Pair, 0, size/2)
+	for i := 0; i < len(slots); i += 2 {
+		pairs = append(pairs, Pair{High: at(slots[i]), Low: at(slots[i+1])})
+	}
+	return pairs
+}
+
+// protect resolves round one conflicts by exchanging the lower seed of a
+// conflicting pair with the closest lower seed of another pair, as long as
+// neither participant is pinned and the exchange leaves both pairs clean.
+func protect(order []int64, pinned map[int]bool, conflicts func(a, b int64) bool) {
+	n := len(order)
+	size := bracketSize(n)
+	if size < 2 {
+		return
+	}
+	half := size / 2
+
+	// In round one seed s meets seed size+1-s, so the lower half of the
+	// seeds is the pool that can be moved around.
+	opponent := func(lowIdx int) int64 {
+		return order[size-1-lowIdx]
+	}
+
+	for low := half; low < n; low++ {
+		if pinned[low] || !conflicts(opponent(low), order[low]) {
+			continue
+		}
+
+		best := -1
+		for dist := 1; dist < half && best < 0; dist++ {
+			for _, cand := range []int{low - dist, low + dist} {
+				if cand < half || cand >= n || pinned[cand] {
+					continue
+				}
+				if conflicts(opponent(low), order[cand]) || conflicts(opponent(cand), order[low]) {
+					continue
+				}
+				best = cand
+				break
+			}
+		}
+
+		if best >= 0 {
+			order[low], order[best] = order[best], order[low]
+		}
+	}
+}
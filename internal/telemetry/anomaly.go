@@ -0,0 +1,129 @@
+package telemetry
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+)
+
+const (
+	// baselineAlpha weighs each sample in a player's rolling baseline. At one
+	// sample a second the baseline mostly reflects the last minute or so.
+	baselineAlpha = 0.03
+
+	// baselineWarmup is how many samples a baseline needs before it is
+	// trusted to flag anything.
+	baselineWarmup = 60
+
+	// sustainedSamples is how many samples in a row must be over the threshold
+	// for an alert, so that a single glitchy reading doesn't raise one.
+	sustainedSamples = 3
+
+	// minStdDev keeps a player whose stress has been almost flat from alerting
+	// on the smallest change.
+	minStdDev = 2.0
+)
+
+// Anomaly describes a sample far above its player's baseline.
+type Anomaly struct {
+	MatchID  int64
+	Sample   data.SensorSample
+	Baseline float64
+	StdDev   float64
+	ZScore   float64
+}
+
+type baseline struct {
+	mean     float64
+	variance float64
+	samples  int
+	streak   int
+	alerted  time.Time
+	seen     time.Time
+}
+
+// Detector keeps a rolling baseline of each player's stress during a match,
+// as an exponentially weighted mean and variance, and flags samples whose
+// z-score against it stays at or above a threshold.
+type Detector struct {
+	mu        sync.Mutex
+	baselines map[[2]int64]*baseline
+	threshold float64
+	cooldown  time.Duration
+}
+
+// NewDetector creates a detector flagging z-scores of at least threshold, and
+// at most one anomaly per player every cooldown.
+func NewDetector(threshold float64, cooldown time.Duration) *Detector {
+	return &Detector{
+		baselines: make(map[[2]int64]*baseline),
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Observe adds a sample to its player's baseline and returns an anomaly if the
+// sample is one. Samples must arrive in time order per player.
+func (d *Detector) Observe(matchID int64, sample data.SensorSample) *Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := [2]int64{matchID, sample.UserID}
+
+	b, ok := d.baselines[key]
+	if !ok {
+		b = &baseline{mean: sample.Stress}
+		d.baselines[key] = b
+	}
+
+	b.seen = time.Now()
+
+	var anomaly *Anomaly
+
+	if b.samples >= baselineWarmup {
+		sd := math.Max(math.Sqrt(b.variance), minStdDev)
+		z := (sample.Stress - b.mean) / sd
+
+		if z >= d.threshold {
+			b.streak++
+		} else {
+			b.streak = 0
+		}
+
+		if b.streak >= sustainedSamples && sample.At.Sub(b.alerted) >= d.cooldown {
+			b.alerted = sample.At
+			anomaly = &Anomaly{
+				MatchID:  matchID,
+				Sample:   sample,
+				Baseline: b.mean,
+				StdDev:   sd,
+				ZScore:   z,
+			}
+		}
+	}
+
+	diff := sample.Stress - b.mean
+	incr := baselineAlpha * diff
+	b.mean += incr
+	b.variance = (1 - baselineAlpha) * (b.variance + diff*incr)
+	b.samples++
+
+	return anomaly
+}
+
+// Prune forgets the baselines of players without samples for maxIdle, such as
+// those whose match has ended.
+func (d *Detector) Prune(maxIdle time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := time.Now().Add(-maxIdle)
+
+	for key, b := range d.baselines {
+		if b.seen.Before(cutoff) {
+			delete(d.baselines, key)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package telemetry
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/WrastAct/maestro/internal/data"
+)
+
+var ErrClosed = errors.New("telemetry: hub closed")
+
+// Subscriber receives the samples of one match, optionally limited to a
+// single player. C is closed when the hub shuts down.
+type Subscriber struct {
+	C       <-chan data.SensorSample
+	c       chan data.SensorSample
+	matchID int64
+	userID  int64
+	dropped uint64
+}
+
+// Hub fans live sensor samples out to the subscribers of each match. Samples
+// are never queued beyond a subscriber's buffer: a subscriber that can't keep
+// up misses samples and is told how many through Dropped.
+type Hub struct {
+	mu      sync.Mutex
+	matches map[int64]map[*Subscriber]struct{}
+	buffer  int
+	done    chan struct{}
+	closed  bool
+}
+
+func New(buffer int) *Hub {
+	return &Hub{
+		matches: make(map[int64]map[*Subscriber]struct{}),
+		buffer:  buffer,
+		done:    make(chan struct{}),
+	}
+}
+
+// Done is closed when the hub shuts down, telling sensor connections to
+// finish.
+func (h *Hub) Done() <-chan struct{} {
+	return h.done
+}
+
+func (h *Hub) Publish(matchID int64, sample data.SensorSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.matches[matchID] {
+		if sub.userID != 0 && sub.userID != sample.UserID {
+			continue
+		}
+
+		select {
+		case sub.c <- sample:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Subscribe starts delivering the samples of a match. A non-zero userID only
+// delivers that player's samples.
+func (h *Hub) Subscribe(matchID, userID int64) (*Subscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+
+	c := make(chan data.SensorSample, h.buffer)
+	sub := &Subscriber{C: c, c: c, matchID: matchID, userID: userID}
+
+	if h.matches[matchID] == nil {
+		h.matches[matchID] = make(map[*Subscriber]struct{})
+	}
+	h.matches[matchID][sub] = struct{}{}
+
+	return sub, nil
+}
+
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs := h.matches[sub.matchID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	close(sub.c)
+
+	if len(subs) == 0 {
+		delete(h.matches, sub.matchID)
+	}
+}
+
+// Dropped returns how many samples sub has missed since the last call.
+func (h *Hub) Dropped(sub *Subscriber) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := sub.dropped
+	sub.dropped = 0
+	return n
+}
+
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+
+	for _, subs := range h.matches {
+		for sub := range subs {
+			close(sub.c)
+		}
+	}
+	h.matches = make(map[int64]map[*Subscriber]struct{})
+}
@@ -0,0 +1,215 @@
+package telemetry
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/analytics"
+	"github.com/WrastAct/maestro/internal/data"
+	"github.com/WrastAct/maestro/internal/validator"
+)
+
+var Metrics = []string{"heart_rate", "stress", "humidity", "temperature", "pressure"}
+
+var percentileRX = regexp.MustCompile(`^p(\d{1,2}(\.\d+)?)$`)
+
+// ValidateAggregates checks aggregate names: min, max, avg, or pN for the Nth
+// percentile with 0 < N < 100.
+func ValidateAggregates(v *validator.Validator, aggs []string) {
+	v.Check(len(aggs) > 0, "agg", "must contain at least one aggregate")
+	v.Check(validator.Unique(aggs), "agg", "must not contain duplicate values")
+
+	for _, agg := range aggs {
+		if validator.In(agg, "min", "max", "avg") {
+			continue
+		}
+
+		if p, ok := percentile(agg); !ok || p <= 0 || p >= 100 {
+			v.AddError("agg", "must be min, max, avg or a percentile such as p95")
+			return
+		}
+	}
+}
+
+func ValidateMetrics(v *validator.Validator, metrics []string) {
+	v.Check(len(metrics) > 0, "metrics", "must contain at least one metric")
+	v.Check(validator.Unique(metrics), "metrics", "must not contain duplicate values")
+
+	for _, metric := range metrics {
+		v.Check(validator.In(metric, Metrics...), "metrics", "must only contain heart_rate, stress, humidity, temperature or pressure")
+	}
+}
+
+func percentile(agg string) (float64, bool) {
+	m := percentileRX.FindStringSubmatch(agg)
+	if m == nil {
+		return 0, false
+	}
+
+	p, err := strconv.ParseFloat(m[1], 64)
+	return p, err == nil
+}
+
+func value(sample data.SensorSample, metric string) float64 {
+	switch metric {
+	case "heart_rate":
+		return sample.HeartRate
+	case "stress":
+		return sample.Stress
+	case "humidity":
+		return sample.Humidity
+	case "temperature":
+		return sample.Temperature
+	default:
+		return sample.Pressure
+	}
+}
+
+// Bucket summarises the samples taken in [Start, Start+resolution).
+type Bucket struct {
+	Start   time.Time                     `json:"start"`
+	Count   int                           `json:"count"`
+	Metrics map[string]map[string]float64 `json:"metrics"`
+}
+
+// Aggregate groups samples, which must be in time order, into buckets of the
+// given resolution aligned to the clock, and computes the aggregates of each
+// metric per bucket. Buckets without samples are left out.
+func Aggregate(samples []data.SensorSample, resolution time.Duration, metrics, aggs []string) []Bucket {
+	buckets := []Bucket{}
+
+	for i := 0; i < len(samples); {
+		start := samples[i].At.Truncate(resolution)
+		end := start.Add(resolution)
+
+		j := i
+		for j < len(samples) && samples[j].At.Before(end) {
+			j++
+		}
+
+		bucket := Bucket{
+			Start:   start,
+			Count:   j - i,
+			Metrics: make(map[string]map[string]float64, len(metrics)),
+		}
+
+		values := make([]float64, j-i)
+
+		for _, metric := range metrics {
+			for k, sample := range samples[i:j] {
+				values[k] = value(sample, metric)
+			}
+			bucket.Metrics[metric] = summarize(values, aggs)
+		}
+
+		buckets = append(buckets, bucket)
+		i = j
+	}
+
+	return buckets
+}
+
+// summarize computes the aggregates of values, sorting them in place.
+func summarize(values []float64, aggs []string) map[string]float64 {
+	sort.Float64s(values)
+
+	result := make(map[string]float64, len(aggs))
+
+	for _, agg := range aggs {
+		switch agg {
+		case "min":
+			result[agg] = values[0]
+		case "max":
+			result[agg] = values[len(values)-1]
+		case "avg":
+			sum := 0.0
+			for _, v := range values {
+				sum += v
+			}
+			result[agg] = sum / float64(len(values))
+		default:
+			p, _ := percentile(agg)
+			result[agg] = analytics.Quantile(values, p/100)
+		}
+	}
+
+	return result
+}
+
+type Point struct {
+	At    time.Time `json:"at"`
+	Value float64   `json:"value"`
+}
+
+// Series returns one metric of samples as points.
+func Series(samples []data.SensorSample, metric string) []Point {
+	points := make([]Point, len(samples))
+
+	for i, sample := range samples {
+		points[i] = Point{At: sample.At, Value: value(sample, metric)}
+	}
+
+	return points
+}
+
+// LTTB downsamples points, which must be in time order, to at most threshold
+// points with the Largest-Triangle-Three-Buckets algorithm. It keeps the
+// first and last points and, from each bucket in between, the point that
+// forms the largest triangle with its neighbours, which preserves the peaks
+// and troughs a chart would show.
+func LTTB(points []Point, threshold int) []Point {
+	if threshold >= len(points) || threshold < 3 {
+		return points
+	}
+
+	sampled := make([]Point, 0, threshold)
+	sampled = append(sampled, points[0])
+
+	every := float64(len(points)-2) / float64(threshold-2)
+	a := 0
+
+	for i := 0; i < threshold-2; i++ {
+		// The average of the next bucket stands in for the third point.
+		nextStart := int(float64(i+1)*every) + 1
+		nextEnd := int(float64(i+2)*every) + 1
+		if nextEnd > len(points) {
+			nextEnd = len(points)
+		}
+
+		var avgX, avgY float64
+		for _, p := range points[nextStart:nextEnd] {
+			avgX += x(p)
+			avgY += p.Value
+		}
+		n := float64(nextEnd - nextStart)
+		avgX /= n
+		avgY /= n
+
+		start := int(float64(i)*every) + 1
+		end := int(float64(i+1)*every) + 1
+
+		ax, ay := x(points[a]), points[a].Value
+		maxArea := -1.0
+		next := start
+
+		for j := start; j < end; j++ {
+			area := math.Abs((ax-avgX)*(points[j].Value-ay) - (ax-x(points[j]))*(avgY-ay))
+			if area > maxArea {
+				maxArea = area
+				next = j
+			}
+		}
+
+		sampled = append(sampled, points[next])
+		a = next
+	}
+
+	return append(sampled, points[len(points)-1])
+}
+
+func x(p Point) float64 {
+	return float64(p.At.UnixMilli())
+}
@@ -0,0 +1,119 @@
+package telemetry
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/WrastAct/maestro/internal/data"
+)
+
+func TestAggregateBucketBoundaries(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	samples := []data.SensorSample{
+		{At: base, Stress: 1},
+		{At: base.Add(9 * time.Second), Stress: 3},
+		{At: base.Add(10 * time.Second), Stress: 5},
+		{At: base.Add(35 * time.Second), Stress: 7},
+	}
+
+	buckets := Aggregate(samples, 10*time.Second, []string{"stress"}, []string{"min", "max", "avg"})
+
+	if len(buckets) != 3 {
+		t.Fatalf("got %d buckets, want 3", len(buckets))
+	}
+
+	tests := []struct {
+		start time.Time
+		count int
+		min   float64
+		max   float64
+		avg   float64
+	}{
+		{base, 2, 1, 3, 2},
+		{base.Add(10 * time.Second), 1, 5, 5, 5},
+		{base.Add(30 * time.Second), 1, 7, 7, 7},
+	}
+
+	for i, tt := range tests {
+		got := buckets[i]
+		if !got.Start.Equal(tt.start) {
+			t.Errorf("bucket %d: start %v, want %v", i, got.Start, tt.start)
+		}
+		if got.Count != tt.count {
+			t.Errorf("bucket %d: count %d, want %d", i, got.Count, tt.count)
+		}
+
+		stress := got.Metrics["stress"]
+		if stress["min"] != tt.min || stress["max"] != tt.max || stress["avg"] != tt.avg {
+			t.Errorf("bucket %d: got %v, want min %v max %v avg %v", i, stress, tt.min, tt.max, tt.avg)
+		}
+	}
+}
+
+func TestAggregatePercentile(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var samples []data.SensorSample
+	for _, v := range []float64{40, 10, 30, 20} {
+		samples = append(samples, data.SensorSample{At: base, HeartRate: v})
+		base = base.Add(time.Second)
+	}
+
+	buckets := Aggregate(samples, time.Minute, []string{"heart_rate"}, []string{"p50", "p90"})
+
+	if len(buckets) != 1 {
+		t.Fatalf("got %d buckets, want 1", len(buckets))
+	}
+
+	hr := buckets[0].Metrics["heart_rate"]
+	if hr["p50"] != 25 {
+		t.Errorf("p50 = %v, want 25", hr["p50"])
+	}
+	if math.Abs(hr["p90"]-37) > 1e-9 {
+		t.Errorf("p90 = %v, want 37", hr["p90"])
+	}
+}
+
+func TestLTTB(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	points := make([]Point, 100)
+	for i := range points {
+		points[i] = Point{At: base.Add(time.Duration(i) * time.Second), Value: math.Sin(float64(i) / 5)}
+	}
+	points[42].Value = 10
+
+	for _, n := range []int{3, 10, 25, 99} {
+		sampled := LTTB(points, n)
+
+		if len(sampled) != n {
+			t.Errorf("n=%d: got %d points", n, len(sampled))
+			continue
+		}
+		if sampled[0] != points[0] || sampled[n-1] != points[len(points)-1] {
+			t.Errorf("n=%d: endpoints not kept", n)
+		}
+
+		for i := 1; i < len(sampled); i++ {
+			if !sampled[i].At.After(sampled[i-1].At) {
+				t.Errorf("n=%d: points out of order at %d", n, i)
+			}
+		}
+	}
+
+	found := false
+	for _, p := range LTTB(points, 10) {
+		if p.Value == 10 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("peak was not kept")
+	}
+
+	if got := LTTB(points, len(points)); len(got) != len(points) {
+		t.Errorf("threshold >= len: got %d points, want %d", len(got), len(points))
+	}
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_participants_tournament;
+DROP TABLE IF EXISTS tournaments_participants;
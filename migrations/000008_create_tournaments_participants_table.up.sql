@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS tournaments_participants (
+    participants_id bigserial PRIMARY KEY,
+    tournaments_id bigint NOT NULL REFERENCES tournaments ON DELETE CASCADE,
+    teams_id bigint REFERENCES teams ON DELETE CASCADE,
+    users_id bigint REFERENCES users ON DELETE CASCADE,
+    region text NOT NULL DEFAULT '',
+    group_name text NOT NULL DEFAULT '',
+    rating decimal NOT NULL DEFAULT 0,
+    seed integer,
+    placement integer,
+    CHECK ((teams_id IS NULL) <> (users_id IS NULL)),
+    UNIQUE (tournaments_id, teams_id),
+    UNIQUE (tournaments_id, users_id),
+    UNIQUE (tournaments_id, seed)
+);
+
+CREATE INDEX idx_participants_tournament ON tournaments_participants(tournaments_id);
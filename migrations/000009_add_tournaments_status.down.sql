@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_tournaments_status;
+DROP TABLE IF EXISTS tournaments_status_history;
+ALTER TABLE tournaments DROP CONSTRAINT IF EXISTS tournaments_status_check;
+ALTER TABLE tournaments DROP COLUMN IF EXISTS status;
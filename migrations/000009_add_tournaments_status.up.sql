@@ -0,0 +1,16 @@
+ALTER TABLE tournaments ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'draft';
+
+ALTER TABLE tournaments ADD CONSTRAINT tournaments_status_check CHECK (
+    status IN ('draft', 'registration_open', 'check_in', 'live', 'completed', 'cancelled', 'archived')
+);
+
+CREATE TABLE IF NOT EXISTS tournaments_status_history (
+    id bigserial PRIMARY KEY,
+    tournaments_id bigint NOT NULL REFERENCES tournaments ON DELETE CASCADE,
+    from_status text NOT NULL,
+    to_status text NOT NULL,
+    users_id bigint REFERENCES users ON DELETE SET NULL,
+    changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_tournaments_status ON tournaments(status);
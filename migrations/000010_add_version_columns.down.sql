@@ -0,0 +1,4 @@
+ALTER TABLE matches DROP COLUMN IF EXISTS version;
+ALTER TABLE games DROP COLUMN IF EXISTS version;
+ALTER TABLE teams DROP COLUMN IF EXISTS version;
+ALTER TABLE tournaments DROP COLUMN IF EXISTS version;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_matches_scheduled_at;
+ALTER TABLE matches DROP CONSTRAINT IF EXISTS matches_estimated_minutes_check;
+ALTER TABLE matches DROP COLUMN IF EXISTS station;
+ALTER TABLE matches DROP COLUMN IF EXISTS venue;
+ALTER TABLE matches DROP COLUMN IF EXISTS estimated_minutes;
+ALTER TABLE matches DROP COLUMN IF EXISTS time_zone;
+ALTER TABLE matches DROP COLUMN IF EXISTS scheduled_at;
+ALTER TABLE matches DROP COLUMN IF EXISTS stage;
+ALTER TABLE matches DROP COLUMN IF EXISTS away_participant_id;
+ALTER TABLE matches DROP COLUMN IF EXISTS home_participant_id;
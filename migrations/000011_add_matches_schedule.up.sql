@@ -0,0 +1,12 @@
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS home_participant_id bigint REFERENCES tournaments_participants ON DELETE SET NULL;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS away_participant_id bigint REFERENCES tournaments_participants ON DELETE SET NULL;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS stage text NOT NULL DEFAULT '';
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS scheduled_at timestamp(0) with time zone;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS time_zone text NOT NULL DEFAULT 'UTC';
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS estimated_minutes integer NOT NULL DEFAULT 60;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS venue text NOT NULL DEFAULT '';
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS station text NOT NULL DEFAULT '';
+
+ALTER TABLE matches ADD CONSTRAINT matches_estimated_minutes_check CHECK (estimated_minutes > 0);
+
+CREATE INDEX idx_matches_scheduled_at ON matches(scheduled_at);
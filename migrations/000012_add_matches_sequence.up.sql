@@ -0,0 +1 @@
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS sequence integer NOT NULL DEFAULT 0;
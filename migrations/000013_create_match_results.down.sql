@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_matches_winner;
+DROP INDEX IF EXISTS idx_matches_status;
+DROP TABLE IF EXISTS matches_maps;
+
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS match_data text NOT NULL DEFAULT '';
+UPDATE matches SET match_data = COALESCE(extras->>'legacy_data', extras::text);
+
+ALTER TABLE matches DROP CONSTRAINT IF EXISTS matches_scores_check;
+ALTER TABLE matches DROP CONSTRAINT IF EXISTS matches_status_check;
+ALTER TABLE matches DROP COLUMN IF EXISTS extras;
+ALTER TABLE matches DROP COLUMN IF EXISTS winner_participant_id;
+ALTER TABLE matches DROP COLUMN IF EXISTS away_score;
+ALTER TABLE matches DROP COLUMN IF EXISTS home_score;
+ALTER TABLE matches DROP COLUMN IF EXISTS status;
+ALTER TABLE matches DROP CONSTRAINT IF EXISTS matches_matches_id_key;
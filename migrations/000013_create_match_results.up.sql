@@ -0,0 +1,36 @@
+ALTER TABLE matches ADD CONSTRAINT matches_matches_id_key UNIQUE (matches_id);
+
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'scheduled';
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS home_score integer NOT NULL DEFAULT 0;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS away_score integer NOT NULL DEFAULT 0;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS winner_participant_id bigint REFERENCES tournaments_participants ON DELETE SET NULL;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS extras jsonb NOT NULL DEFAULT '{}';
+
+ALTER TABLE matches ADD CONSTRAINT matches_status_check CHECK (
+    status IN ('scheduled', 'live', 'finished', 'forfeit', 'no_show')
+);
+ALTER TABLE matches ADD CONSTRAINT matches_scores_check CHECK (home_score >= 0 AND away_score >= 0);
+
+-- Matches recorded before this migration only carried free-form text. Keep it
+-- under extras so nothing is lost, and treat those matches as played.
+UPDATE matches
+SET status = 'finished', extras = jsonb_build_object('legacy_data', match_data)
+WHERE match_data <> '';
+
+ALTER TABLE matches DROP COLUMN IF EXISTS match_data;
+
+CREATE TABLE IF NOT EXISTS matches_maps (
+    matches_id bigint NOT NULL REFERENCES matches (matches_id) ON DELETE CASCADE,
+    map_number smallint NOT NULL,
+    map_name text NOT NULL DEFAULT '',
+    home_score integer NOT NULL DEFAULT 0,
+    away_score integer NOT NULL DEFAULT 0,
+    winner_participant_id bigint REFERENCES tournaments_participants ON DELETE SET NULL,
+    extras jsonb NOT NULL DEFAULT '{}',
+    PRIMARY KEY (matches_id, map_number),
+    CHECK (map_number > 0),
+    CHECK (home_score >= 0 AND away_score >= 0)
+);
+
+CREATE INDEX idx_matches_status ON matches(status);
+CREATE INDEX idx_matches_winner ON matches(winner_participant_id);
@@ -0,0 +1,4 @@
+ALTER TABLE users_matches DROP COLUMN IF EXISTS schema_version;
+ALTER TABLE users_matches DROP COLUMN IF EXISTS extras;
+ALTER TABLE matches DROP COLUMN IF EXISTS schema_version;
+DROP TABLE IF EXISTS games_schemas;
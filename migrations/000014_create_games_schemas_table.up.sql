@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS games_schemas (
+    games_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    version integer NOT NULL,
+    match_schema jsonb NOT NULL DEFAULT '{}',
+    player_schema jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (games_id, version),
+    CHECK (version > 0)
+);
+
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS schema_version integer;
+
+ALTER TABLE users_matches ADD COLUMN IF NOT EXISTS extras jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE users_matches ADD COLUMN IF NOT EXISTS schema_version integer;
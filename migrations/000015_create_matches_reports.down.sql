@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code = 'referee';
+
+DROP TABLE IF EXISTS matches_audit;
+DROP TABLE IF EXISTS matches_disputes_evidence;
+DROP TABLE IF EXISTS matches_disputes;
+DROP TABLE IF EXISTS matches_reports;
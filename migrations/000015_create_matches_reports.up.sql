@@ -0,0 +1,73 @@
+CREATE TABLE IF NOT EXISTS matches_reports (
+    reports_id bigserial PRIMARY KEY,
+    matches_id bigint NOT NULL REFERENCES matches (matches_id) ON DELETE CASCADE,
+    participants_id bigint NOT NULL REFERENCES tournaments_participants ON DELETE CASCADE,
+    reported_by bigint REFERENCES users ON DELETE SET NULL,
+    status text NOT NULL DEFAULT 'pending',
+    match_status text NOT NULL,
+    home_score integer NOT NULL DEFAULT 0,
+    away_score integer NOT NULL DEFAULT 0,
+    winner_participant_id bigint REFERENCES tournaments_participants ON DELETE SET NULL,
+    maps jsonb NOT NULL DEFAULT '[]',
+    extras jsonb NOT NULL DEFAULT '{}',
+    confirm_by timestamp(0) with time zone NOT NULL,
+    confirmed_by bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    decided_at timestamp(0) with time zone,
+    CHECK (status IN ('pending', 'confirmed', 'auto_accepted', 'disputed', 'upheld', 'overturned', 'voided')),
+    CHECK (match_status IN ('finished', 'forfeit', 'no_show')),
+    CHECK (home_score >= 0 AND away_score >= 0)
+);
+
+-- A match can only have one report waiting on the opponent or a referee.
+CREATE UNIQUE INDEX idx_matches_reports_open ON matches_reports(matches_id) WHERE status IN ('pending', 'disputed');
+CREATE INDEX idx_matches_reports_confirm_by ON matches_reports(confirm_by) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS matches_disputes (
+    disputes_id bigserial PRIMARY KEY,
+    reports_id bigint NOT NULL UNIQUE REFERENCES matches_reports ON DELETE CASCADE,
+    raised_by bigint REFERENCES users ON DELETE SET NULL,
+    reason text NOT NULL,
+    status text NOT NULL DEFAULT 'open',
+    decision text NOT NULL DEFAULT '',
+    resolution text NOT NULL DEFAULT '',
+    referee_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    resolved_at timestamp(0) with time zone,
+    CHECK (status IN ('open', 'resolved')),
+    CHECK (decision IN ('', 'uphold', 'overturn', 'void'))
+);
+
+CREATE INDEX idx_matches_disputes_status ON matches_disputes(status, created_at);
+
+CREATE TABLE IF NOT EXISTS matches_disputes_evidence (
+    evidence_id bigserial PRIMARY KEY,
+    disputes_id bigint NOT NULL REFERENCES matches_disputes ON DELETE CASCADE,
+    submitted_by bigint REFERENCES users ON DELETE SET NULL,
+    url text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS matches_audit (
+    id bigserial PRIMARY KEY,
+    matches_id bigint NOT NULL REFERENCES matches (matches_id) ON DELETE CASCADE,
+    users_id bigint REFERENCES users ON DELETE SET NULL,
+    action text NOT NULL,
+    details jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_matches_audit_matches_id ON matches_audit(matches_id, created_at);
+
+INSERT INTO permissions (code)
+VALUES ('referee');
+
+-- Admins have been settling results so far, keep letting them do so.
+INSERT INTO users_permissions
+SELECT up.user_id, referee.id
+FROM users_permissions up
+INNER JOIN permissions admin ON admin.id = up.permission_id AND admin.code = 'admin'
+CROSS JOIN permissions referee
+WHERE referee.code = 'referee'
+ON CONFLICT DO NOTHING;
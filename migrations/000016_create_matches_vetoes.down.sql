@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS matches_vetoes_actions;
+DROP TABLE IF EXISTS matches_vetoes;
+
+ALTER TABLE games DROP COLUMN IF EXISTS veto_sequence;
+ALTER TABLE games DROP COLUMN IF EXISTS map_pool;
@@ -0,0 +1,34 @@
+ALTER TABLE games ADD COLUMN IF NOT EXISTS map_pool text[] NOT NULL DEFAULT '{}';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS veto_sequence jsonb NOT NULL DEFAULT '[]';
+
+CREATE TABLE IF NOT EXISTS matches_vetoes (
+    vetoes_id bigserial PRIMARY KEY,
+    matches_id bigint NOT NULL REFERENCES matches (matches_id) ON DELETE CASCADE,
+    sequence jsonb NOT NULL,
+    map_pool text[] NOT NULL,
+    turn_seconds integer NOT NULL,
+    status text NOT NULL DEFAULT 'in_progress',
+    step integer NOT NULL DEFAULT 0,
+    turn_started_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1,
+    CHECK (status IN ('in_progress', 'completed', 'cancelled')),
+    CHECK (turn_seconds > 0)
+);
+
+-- Only one veto per match can be running or finished; cancelled ones may be
+-- restarted.
+CREATE UNIQUE INDEX idx_matches_vetoes_active ON matches_vetoes(matches_id) WHERE status <> 'cancelled';
+
+CREATE TABLE IF NOT EXISTS matches_vetoes_actions (
+    vetoes_id bigint NOT NULL REFERENCES matches_vetoes ON DELETE CASCADE,
+    step integer NOT NULL,
+    action text NOT NULL,
+    participants_id bigint REFERENCES tournaments_participants ON DELETE SET NULL,
+    map_name text NOT NULL,
+    auto boolean NOT NULL DEFAULT false,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (vetoes_id, step),
+    CHECK (action IN ('ban', 'pick', 'decider'))
+);
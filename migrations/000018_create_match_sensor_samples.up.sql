@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS match_sensor_samples (
+    matches_id bigint NOT NULL REFERENCES matches (matches_id) ON DELETE CASCADE,
+    users_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    sampled_at timestamp with time zone NOT NULL,
+    heart_rate real NOT NULL,
+    stress real NOT NULL,
+    humidity real NOT NULL,
+    temperature real NOT NULL,
+    pressure real NOT NULL,
+    PRIMARY KEY (matches_id, users_id, sampled_at)
+);
+
+CREATE INDEX idx_match_sensor_samples_user ON match_sensor_samples(users_id, sampled_at);
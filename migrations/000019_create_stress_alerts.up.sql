@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS stress_alerts (
+    alerts_id bigserial PRIMARY KEY,
+    matches_id bigint NOT NULL REFERENCES matches (matches_id) ON DELETE CASCADE,
+    users_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    raised_at timestamp with time zone NOT NULL,
+    stress real NOT NULL,
+    baseline real NOT NULL,
+    std_dev real NOT NULL,
+    z_score real NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_stress_alerts_match ON stress_alerts(matches_id, raised_at);
+CREATE INDEX idx_stress_alerts_user ON stress_alerts(users_id);
@@ -0,0 +1,16 @@
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS venue text NOT NULL DEFAULT '';
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS station text NOT NULL DEFAULT '';
+
+UPDATE matches m
+SET venue = v.venues_name, station = s.stations_name
+FROM stations s
+INNER JOIN venues v ON v.venues_id = s.venues_id
+WHERE s.stations_id = m.stations_id;
+
+DROP INDEX IF EXISTS idx_matches_station;
+ALTER TABLE matches DROP COLUMN IF EXISTS stations_id;
+
+DROP TABLE IF EXISTS stations_alerts;
+DROP TABLE IF EXISTS stations_readings;
+DROP TABLE IF EXISTS stations;
+DROP TABLE IF EXISTS venues;
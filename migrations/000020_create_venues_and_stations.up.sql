@@ -0,0 +1,74 @@
+CREATE TABLE IF NOT EXISTS venues (
+    venues_id bigserial PRIMARY KEY,
+    venues_name text NOT NULL UNIQUE,
+    address text NOT NULL DEFAULT '',
+    time_zone text NOT NULL DEFAULT 'UTC',
+    min_temperature real,
+    max_temperature real,
+    min_humidity real,
+    max_humidity real,
+    min_pressure real,
+    max_pressure real,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS stations (
+    stations_id bigserial PRIMARY KEY,
+    venues_id bigint NOT NULL REFERENCES venues ON DELETE CASCADE,
+    stations_name text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (venues_id, stations_name)
+);
+
+CREATE TABLE IF NOT EXISTS stations_readings (
+    stations_id bigint NOT NULL REFERENCES stations ON DELETE CASCADE,
+    read_at timestamp with time zone NOT NULL,
+    humidity real NOT NULL,
+    temperature real NOT NULL,
+    pressure real NOT NULL,
+    PRIMARY KEY (stations_id, read_at)
+);
+
+CREATE TABLE IF NOT EXISTS stations_alerts (
+    alerts_id bigserial PRIMARY KEY,
+    stations_id bigint NOT NULL REFERENCES stations ON DELETE CASCADE,
+    metric text NOT NULL,
+    kind text NOT NULL,
+    value real NOT NULL,
+    threshold real NOT NULL,
+    raised_at timestamp with time zone NOT NULL,
+    resolved_at timestamp with time zone,
+    CHECK (metric IN ('temperature', 'humidity', 'pressure')),
+    CHECK (kind IN ('above', 'below'))
+);
+
+-- A station has at most one open alert per metric.
+CREATE UNIQUE INDEX idx_stations_alerts_open ON stations_alerts(stations_id, metric) WHERE resolved_at IS NULL;
+
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS stations_id bigint REFERENCES stations ON DELETE SET NULL;
+
+-- Turn the free-form venue and station names into entities. Matches that
+-- only named a venue are put on a station called "main" there.
+INSERT INTO venues (venues_name, time_zone)
+SELECT venue, min(time_zone)
+FROM matches
+WHERE venue <> ''
+GROUP BY venue;
+
+INSERT INTO stations (venues_id, stations_name)
+SELECT DISTINCT v.venues_id, CASE WHEN m.station = '' THEN 'main' ELSE m.station END
+FROM matches m
+INNER JOIN venues v ON v.venues_name = m.venue;
+
+UPDATE matches m
+SET stations_id = s.stations_id
+FROM venues v
+INNER JOIN stations s ON s.venues_id = v.venues_id
+WHERE v.venues_name = m.venue
+AND s.stations_name = CASE WHEN m.station = '' THEN 'main' ELSE m.station END;
+
+ALTER TABLE matches DROP COLUMN IF EXISTS venue;
+ALTER TABLE matches DROP COLUMN IF EXISTS station;
+
+CREATE INDEX idx_matches_station ON matches(stations_id);
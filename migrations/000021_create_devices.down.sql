@@ -0,0 +1,7 @@
+ALTER TABLE stations_readings DROP COLUMN IF EXISTS quarantined;
+ALTER TABLE stations_readings DROP COLUMN IF EXISTS devices_id;
+
+ALTER TABLE match_sensor_samples DROP COLUMN IF EXISTS quarantined;
+ALTER TABLE match_sensor_samples DROP COLUMN IF EXISTS devices_id;
+
+DROP TABLE IF EXISTS devices;
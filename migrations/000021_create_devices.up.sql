@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS devices (
+    devices_id bigserial PRIMARY KEY,
+    serial text NOT NULL UNIQUE,
+    device_type text NOT NULL,
+    firmware text NOT NULL DEFAULT '',
+    venues_id bigint REFERENCES venues ON DELETE SET NULL,
+    stations_id bigint REFERENCES stations ON DELETE SET NULL,
+    heart_rate_offset real NOT NULL DEFAULT 0,
+    stress_offset real NOT NULL DEFAULT 0,
+    humidity_offset real NOT NULL DEFAULT 0,
+    temperature_offset real NOT NULL DEFAULT 0,
+    pressure_offset real NOT NULL DEFAULT 0,
+    calibrated_at timestamp(0) with time zone,
+    last_seen_at timestamp(0) with time zone,
+    quarantined_at timestamp(0) with time zone,
+    quarantine_reason text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CHECK (device_type IN ('wearable', 'environment'))
+);
+
+CREATE INDEX idx_devices_venue ON devices(venues_id);
+
+-- Provenance: the device each sample and reading came from, if known, and
+-- whether it has been set aside as untrustworthy.
+ALTER TABLE match_sensor_samples ADD COLUMN IF NOT EXISTS devices_id bigint REFERENCES devices ON DELETE SET NULL;
+ALTER TABLE match_sensor_samples ADD COLUMN IF NOT EXISTS quarantined boolean NOT NULL DEFAULT false;
+
+ALTER TABLE stations_readings ADD COLUMN IF NOT EXISTS devices_id bigint REFERENCES devices ON DELETE SET NULL;
+ALTER TABLE stations_readings ADD COLUMN IF NOT EXISTS quarantined boolean NOT NULL DEFAULT false;
+
+CREATE INDEX idx_match_sensor_samples_device ON match_sensor_samples(devices_id, sampled_at);
+CREATE INDEX idx_stations_readings_device ON stations_readings(devices_id, read_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS biometric_consents_history;
+DROP TABLE IF EXISTS biometric_consents;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS biometric_consents (
+    users_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    data_category text NOT NULL,
+    audience text NOT NULL,
+    granted boolean NOT NULL,
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (users_id, data_category, audience),
+    CHECK (data_category IN ('heart_rate', 'stress')),
+    CHECK (audience IN ('self', 'team_staff', 'tournament_staff', 'public_aggregate'))
+);
+
+CREATE TABLE IF NOT EXISTS biometric_consents_history (
+    history_id bigserial PRIMARY KEY,
+    users_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    data_category text NOT NULL,
+    audience text NOT NULL,
+    granted boolean NOT NULL,
+    changed_by bigint REFERENCES users ON DELETE SET NULL,
+    changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_biometric_consents_history_user ON biometric_consents_history(users_id, changed_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS retention_runs (
+    runs_id bigserial PRIMARY KEY,
+    started_at timestamp with time zone NOT NULL,
+    finished_at timestamp with time zone NOT NULL,
+    dry_run boolean NOT NULL,
+    triggered_by bigint REFERENCES users ON DELETE SET NULL,
+    results jsonb NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX idx_retention_runs_started ON retention_runs(dry_run, started_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ratings_history;
+DROP TABLE IF EXISTS ratings;
+
+ALTER TABLE matches DROP COLUMN IF EXISTS finished_at;
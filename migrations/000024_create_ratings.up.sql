@@ -0,0 +1,46 @@
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS finished_at timestamp(0) with time zone;
+
+-- Matches finished before this migration have no record of when. Take the
+-- end of their schedule, or failing that the start of their tournament.
+UPDATE matches m
+SET finished_at = COALESCE(m.scheduled_at + m.estimated_minutes * interval '1 minute', t.start_date::timestamptz)
+FROM tournaments t
+WHERE t.tournaments_id = m.tournaments_id AND m.status = 'finished';
+
+CREATE TABLE IF NOT EXISTS ratings (
+    games_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    rating_system text NOT NULL,
+    users_id bigint REFERENCES users ON DELETE CASCADE,
+    teams_id bigint REFERENCES teams ON DELETE CASCADE,
+    rating double precision NOT NULL,
+    deviation double precision NOT NULL DEFAULT 0,
+    volatility double precision NOT NULL DEFAULT 0,
+    matches integer NOT NULL DEFAULT 0,
+    last_played_at timestamp(0) with time zone NOT NULL,
+    CHECK (rating_system IN ('elo', 'glicko2')),
+    CHECK ((teams_id IS NULL) <> (users_id IS NULL)),
+    UNIQUE (games_id, rating_system, users_id),
+    UNIQUE (games_id, rating_system, teams_id)
+);
+
+CREATE INDEX idx_ratings_users ON ratings(users_id);
+CREATE INDEX idx_ratings_teams ON ratings(teams_id);
+
+CREATE TABLE IF NOT EXISTS ratings_history (
+    history_id bigserial PRIMARY KEY,
+    games_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    rating_system text NOT NULL,
+    users_id bigint REFERENCES users ON DELETE CASCADE,
+    teams_id bigint REFERENCES teams ON DELETE CASCADE,
+    matches_id bigint NOT NULL REFERENCES matches (matches_id) ON DELETE CASCADE,
+    played_at timestamp(0) with time zone NOT NULL,
+    rating double precision NOT NULL,
+    deviation double precision NOT NULL DEFAULT 0,
+    volatility double precision NOT NULL DEFAULT 0,
+    delta double precision NOT NULL
+);
+
+CREATE INDEX idx_ratings_history_users ON ratings_history(users_id, games_id, rating_system);
+CREATE INDEX idx_ratings_history_teams ON ratings_history(teams_id, games_id, rating_system);
+CREATE INDEX idx_ratings_history_games ON ratings_history(games_id, played_at, matches_id);
+CREATE INDEX idx_ratings_history_matches ON ratings_history(matches_id);
@@ -0,0 +1,2 @@
+DROP MATERIALIZED VIEW IF EXISTS leaderboards;
+DROP TABLE IF EXISTS seasons;
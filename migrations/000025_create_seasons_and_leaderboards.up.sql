@@ -0,0 +1,120 @@
+CREATE TABLE IF NOT EXISTS seasons (
+    seasons_id bigserial PRIMARY KEY,
+    seasons_name text NOT NULL,
+    games_id bigint REFERENCES games ON DELETE CASCADE,
+    start_date date NOT NULL,
+    end_date date NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    CHECK (start_date <= end_date)
+);
+
+CREATE INDEX idx_seasons_games ON seasons(games_id);
+
+-- One row per player or team, game and season, with season 0 standing for all
+-- time. Ratings are as they stood after the entity's last match in the
+-- season; placements and prize money come from the tournaments completed in
+-- it. A team's prize money is shared equally between the players who played
+-- the tournament for it, and participants tied on a placement share the
+-- prizes of the places they tie for.
+CREATE MATERIALIZED VIEW IF NOT EXISTS leaderboards AS
+WITH periods AS (
+    SELECT 0::bigint AS seasons_id, NULL::bigint AS games_id,
+        '-infinity'::timestamptz AS starts_at, 'infinity'::timestamptz AS ends_at
+    UNION ALL
+    SELECT seasons_id, games_id, start_date::timestamptz, (end_date + 1)::timestamptz
+    FROM seasons
+),
+placed AS (
+    SELECT p.participants_id, p.tournaments_id, p.teams_id, p.users_id, p.placement,
+        t.games_id, t.start_date::timestamptz AS starts_at,
+        count(*) OVER (PARTITION BY p.tournaments_id, p.placement) AS tied
+    FROM tournaments_participants p
+    INNER JOIN tournaments t ON t.tournaments_id = p.tournaments_id
+    WHERE p.placement IS NOT NULL AND t.status IN ('completed', 'archived')
+),
+results AS (
+    SELECT placed.*, COALESCE((
+        SELECT sum(pp.money)
+        FROM tournaments_prize_pool pp
+        WHERE pp.tournaments_id = placed.tournaments_id
+        AND pp.place BETWEEN placed.placement AND placed.placement + placed.tied - 1
+    ), 0)::double precision / placed.tied AS prize_money
+    FROM placed
+),
+entries AS (
+    SELECT 'team' AS entity_type, teams_id AS entity_id, games_id, starts_at, placement, prize_money
+    FROM results
+    WHERE teams_id IS NOT NULL
+    UNION ALL
+    SELECT 'player', users_id, games_id, starts_at, placement, prize_money
+    FROM results
+    WHERE users_id IS NOT NULL
+    UNION ALL
+    SELECT 'player', lineup.users_id, r.games_id, r.starts_at, r.placement,
+        r.prize_money / count(*) OVER (PARTITION BY r.participants_id)
+    FROM results r
+    INNER JOIN LATERAL (
+        SELECT DISTINCT um.users_id
+        FROM users_matches um
+        INNER JOIN teams_users tu ON tu.user_id = um.users_id AND tu.teams_id = r.teams_id
+        WHERE um.tournaments_id = r.tournaments_id
+    ) lineup ON TRUE
+    WHERE r.teams_id IS NOT NULL
+),
+placements AS (
+    SELECT e.entity_type, e.entity_id, e.games_id, pr.seasons_id,
+        count(*) AS tournaments,
+        count(*) FILTER (WHERE e.placement = 1) AS wins,
+        min(e.placement) AS best_placement,
+        sum(e.prize_money) AS prize_money
+    FROM entries e
+    INNER JOIN periods pr ON e.starts_at >= pr.starts_at AND e.starts_at < pr.ends_at
+        AND (pr.games_id IS NULL OR pr.games_id = e.games_id)
+    GROUP BY 1, 2, 3, 4
+),
+rated AS (
+    SELECT DISTINCT ON (pr.seasons_id, h.games_id, h.rating_system, h.users_id, h.teams_id)
+        CASE WHEN h.teams_id IS NULL THEN 'player' ELSE 'team' END AS entity_type,
+        COALESCE(h.users_id, h.teams_id) AS entity_id, h.games_id, pr.seasons_id, h.rating_system, h.rating,
+        count(*) OVER (PARTITION BY pr.seasons_id, h.games_id, h.rating_system, h.users_id, h.teams_id) AS matches
+    FROM ratings_history h
+    INNER JOIN periods pr ON h.played_at >= pr.starts_at AND h.played_at < pr.ends_at
+        AND (pr.games_id IS NULL OR pr.games_id = h.games_id)
+    ORDER BY pr.seasons_id, h.games_id, h.rating_system, h.users_id, h.teams_id, h.played_at DESC, h.matches_id DESC
+),
+rating_totals AS (
+    SELECT entity_type, entity_id, games_id, seasons_id,
+        max(rating) FILTER (WHERE rating_system = 'elo') AS elo_rating,
+        max(rating) FILTER (WHERE rating_system = 'glicko2') AS glicko2_rating,
+        max(matches) AS matches
+    FROM rated
+    GROUP BY 1, 2, 3, 4
+)
+SELECT COALESCE(r.entity_type, p.entity_type) AS entity_type,
+    COALESCE(r.entity_id, p.entity_id) AS entity_id,
+    COALESCE(r.games_id, p.games_id) AS games_id,
+    COALESCE(r.seasons_id, p.seasons_id) AS seasons_id,
+    COALESCE(u.users_name, t.teams_name, '') AS name,
+    COALESCE(u.nationality, t.teams_region, '') AS region,
+    r.elo_rating,
+    r.glicko2_rating,
+    COALESCE(r.matches, 0) AS matches,
+    COALESCE(p.tournaments, 0) AS tournaments,
+    COALESCE(p.wins, 0) AS wins,
+    p.best_placement,
+    COALESCE(p.prize_money, 0) AS prize_money
+FROM rating_totals r
+FULL JOIN placements p ON p.entity_type = r.entity_type AND p.entity_id = r.entity_id
+    AND p.games_id = r.games_id AND p.seasons_id = r.seasons_id
+LEFT JOIN users u ON COALESCE(r.entity_type, p.entity_type) = 'player' AND u.users_id = COALESCE(r.entity_id, p.entity_id)
+LEFT JOIN teams t ON COALESCE(r.entity_type, p.entity_type) = 'team' AND t.teams_id = COALESCE(r.entity_id, p.entity_id);
+
+-- The unique index lets the view be refreshed concurrently, without blocking
+-- reads. The others match the orders leaderboards are read in.
+CREATE UNIQUE INDEX idx_leaderboards_entity ON leaderboards(entity_type, games_id, seasons_id, entity_id);
+CREATE INDEX idx_leaderboards_elo ON leaderboards(entity_type, games_id, seasons_id, elo_rating DESC, entity_id)
+    WHERE elo_rating IS NOT NULL;
+CREATE INDEX idx_leaderboards_glicko2 ON leaderboards(entity_type, games_id, seasons_id, glicko2_rating DESC, entity_id)
+    WHERE glicko2_rating IS NOT NULL;
+CREATE INDEX idx_leaderboards_prize_money ON leaderboards(entity_type, games_id, seasons_id, prize_money DESC, entity_id);
+CREATE INDEX idx_leaderboards_wins ON leaderboards(entity_type, games_id, seasons_id, wins DESC, entity_id);
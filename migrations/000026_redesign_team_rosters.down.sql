@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS idx_teams_users_team;
+
+ALTER TABLE teams_users DROP CONSTRAINT IF EXISTS teams_users_no_overlap;
+ALTER TABLE teams_users DROP COLUMN IF EXISTS games_id;
+DROP EXTENSION IF EXISTS btree_gist;
+
+ALTER TABLE teams_users DROP CONSTRAINT IF EXISTS teams_users_dates_check;
+ALTER TABLE teams_users DROP CONSTRAINT IF EXISTS teams_users_role_check;
+
+UPDATE teams_users SET leave_date = join_date WHERE leave_date IS NULL;
+
+ALTER TABLE teams_users ALTER COLUMN join_date SET DEFAULT NOW();
+ALTER TABLE teams_users ALTER COLUMN leave_date SET DEFAULT NOW();
+ALTER TABLE teams_users ALTER COLUMN leave_date SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_teams_games;
+
+ALTER TABLE teams DROP COLUMN IF EXISTS games_id;
@@ -0,0 +1,74 @@
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS games_id bigint REFERENCES games ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_teams_games ON teams(games_id);
+
+-- Active members have no leave date. Rows that left on the day they joined
+-- are what the old NOW() default recorded for members who never left.
+ALTER TABLE teams_users ALTER COLUMN leave_date DROP NOT NULL;
+ALTER TABLE teams_users ALTER COLUMN leave_date DROP DEFAULT;
+ALTER TABLE teams_users ALTER COLUMN join_date SET DEFAULT CURRENT_DATE;
+
+UPDATE teams_users SET leave_date = NULL WHERE leave_date = join_date;
+UPDATE teams_users SET leave_date = join_date WHERE leave_date < join_date;
+
+-- That also reopens every team a player has since moved on from. Only their
+-- latest spell in a game is current; the ones before it end the day before
+-- the next one starts. Teams have no game yet, so that is their latest
+-- spell in any team.
+UPDATE teams_users tu
+SET leave_date = GREATEST(spells.next_join - 1, tu.join_date)
+FROM (
+    SELECT s.user_id, s.teams_id, s.join_date,
+        lead(s.join_date) OVER (
+            PARTITION BY s.user_id, t.games_id
+            ORDER BY s.join_date, s.teams_id
+        ) AS next_join
+    FROM teams_users s
+    INNER JOIN teams t ON t.teams_id = s.teams_id
+) spells
+WHERE spells.user_id = tu.user_id AND spells.teams_id = tu.teams_id AND spells.join_date = tu.join_date
+AND spells.next_join IS NOT NULL
+AND tu.leave_date IS NULL;
+
+-- Spells that still overlap, such as two starting on the same day, can't be
+-- told apart and have to be sorted out by hand.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM teams_users a
+        INNER JOIN teams ta ON ta.teams_id = a.teams_id
+        INNER JOIN teams_users b ON b.user_id = a.user_id
+            AND (b.teams_id, b.join_date) <> (a.teams_id, a.join_date)
+        INNER JOIN teams tb ON tb.teams_id = b.teams_id
+        WHERE ta.games_id IS NOT DISTINCT FROM tb.games_id
+        AND a.join_date <= COALESCE(b.leave_date, 'infinity')
+        AND b.join_date <= COALESCE(a.leave_date, 'infinity')
+    ) THEN
+        RAISE EXCEPTION 'teams_users has players with overlapping memberships; resolve them before migrating';
+    END IF;
+END $$;
+
+UPDATE teams_users SET role = lower(trim(role));
+UPDATE teams_users SET role = 'player'
+WHERE role NOT IN ('player', 'captain', 'substitute', 'coach', 'analyst', 'manager');
+
+ALTER TABLE teams_users ADD CONSTRAINT teams_users_role_check
+    CHECK (role IN ('player', 'captain', 'substitute', 'coach', 'analyst', 'manager'));
+ALTER TABLE teams_users ADD CONSTRAINT teams_users_dates_check
+    CHECK (leave_date IS NULL OR leave_date >= join_date);
+
+CREATE INDEX IF NOT EXISTS idx_teams_users_team ON teams_users(teams_id);
+
+-- The database holds players to one team per game at a time as well. Teams
+-- without a game count as a game of their own, 0, and each membership
+-- carries its team's game so that the constraint can see it.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE teams_users ADD COLUMN IF NOT EXISTS games_id bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE teams_users ADD CONSTRAINT teams_users_no_overlap EXCLUDE USING gist (
+    user_id WITH =,
+    games_id WITH =,
+    daterange(join_date, leave_date, '[]') WITH &&
+);
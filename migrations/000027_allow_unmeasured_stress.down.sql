@@ -0,0 +1,2 @@
+UPDATE users_matches SET average_stress = 0 WHERE average_stress IS NULL;
+ALTER TABLE users_matches ALTER COLUMN average_stress SET NOT NULL;
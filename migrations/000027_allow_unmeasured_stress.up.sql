@@ -0,0 +1,2 @@
+-- A record whose samples have all been quarantined has no stress average left.
+ALTER TABLE users_matches ALTER COLUMN average_stress DROP NOT NULL;